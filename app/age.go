@@ -0,0 +1,54 @@
+// age.go
+// This file contains the reporting of how old the served feed data is.
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feedAge returns the age of the data a request will be served for a feed.
+// Data that has to be fetched for the request is fresh.
+//
+// Parameters:
+// - feed: The feed being served.
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The age of the feed's data.
+func (s *server) feedAge(feed FeedConfig, opts aggregateOptions) time.Duration {
+	if opts.bypassCache {
+		return 0
+	}
+	age, _ := s.cache.age(feed.request().Key())
+	return age
+}
+
+// feedAgesHeader describes the age of every selected feed's data, logging a
+// warning for any older than the configured threshold.
+//
+// Parameters:
+// - ctx: The context of the request being served, used for logging.
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The X-Feed-Age-Seconds value, e.g. "Colombia=12, Canada=0".
+func (s *server) feedAgesHeader(ctx context.Context, opts aggregateOptions) string {
+	threshold := time.Duration(s.cfg.Cache.WarnAgeSeconds) * time.Second
+	var ages []string
+	for _, feed := range s.cfg.Feeds {
+		if !opts.includesFeed(feed) {
+			continue
+		}
+		age := s.feedAge(feed, opts)
+		if threshold > 0 && age > threshold {
+			logf(ctx, "Serving %s data that is %s old, past the %s warning threshold", feed.Name, age.Round(time.Second), threshold)
+		}
+		ages = append(ages, feed.Name+"="+strconv.Itoa(int(age.Seconds())))
+	}
+	return strings.Join(ages, ", ")
+}
+
+// End, age.go
@@ -0,0 +1,564 @@
+// aggregate.go
+// This file contains the pipeline that loads, processes, and merges the feeds.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+
+	"github.com/appliedmedia/calendar-feed-aggregator/fetcher"
+)
+
+// aggregateOptions holds the per-request settings of an aggregation.
+type aggregateOptions struct {
+	// bypassCache fetches every feed afresh.
+	bypassCache bool
+	// countries keeps only events belonging to the listed country codes.
+	countries []string
+	// sortBy orders the aggregate instead of streaming it in arrival order; "" streams.
+	sortBy string
+	// as is the component type events are output as; "" keeps VEVENTs.
+	as string
+	// feeds keeps only the named feeds; empty keeps every feed.
+	feeds []string
+	// warningsHeader reports the number of parse warnings in X-Parse-Warnings.
+	warningsHeader bool
+	// pins serves the feeds owning these content hashes from their history.
+	pins []string
+	// ifModifiedSince is the RFC 3339 time of the client's copy; "" always serves.
+	ifModifiedSince string
+	// weekdays keeps only events starting on the named days of the week.
+	weekdays []string
+	// location keeps only events whose LOCATION contains it, ignoring case.
+	location string
+	// only keeps only events whose SUMMARY matches one of the names, in place
+	// of the configured only list.
+	only []string
+	// from and to keep only events overlapping the window, each an RFC 3339
+	// time or a date; "" leaves that side open.
+	from, to string
+}
+
+// parseAggregateOptions reads the aggregation settings from the query string.
+//
+// Parameters:
+// - c: The request context.
+//
+// Returns:
+// - The options requested by the client.
+func parseAggregateOptions(c *gin.Context) aggregateOptions {
+	return aggregateOptions{
+		bypassCache:     queryBool(c, "nocache"),
+		countries:       parseList(c.Query("country")),
+		sortBy:          c.Query("sort"),
+		as:              c.Query("as"),
+		feeds:           parseList(c.Query("feed")),
+		warningsHeader:  c.Query("warnings") == "header",
+		pins:            parseList(c.Query("pin")),
+		ifModifiedSince: c.Query("if_modified_since"),
+		weekdays:        parseList(c.Query("weekday")),
+		location:        c.Query("location"),
+		only:            parseList(c.Query("only")),
+		from:            c.Query("from"),
+		to:              c.Query("to"),
+	}
+}
+
+// includesFeed reports whether the request selects a feed. Disabled feeds are
+// never selected.
+//
+// Parameters:
+// - feed: The feed to check.
+//
+// Returns:
+// - True if the feed is enabled and no feeds were named or it is one of them.
+func (opts aggregateOptions) includesFeed(feed FeedConfig) bool {
+	if !feed.enabled() {
+		return false
+	}
+	if len(opts.feeds) == 0 {
+		return true
+	}
+	for _, name := range opts.feeds {
+		if strings.EqualFold(name, feed.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the requested options are supported. Collections are
+// held to maxFeeds when the config loads, so only a ?feed selection fails it.
+//
+// Parameters:
+// - maxFeeds: The most feeds a ?feed selection may name; 0 or less is unlimited.
+//
+// Returns:
+// - An error describing the first unsupported option.
+func (opts aggregateOptions) validate(maxFeeds int) error {
+	if maxFeeds > 0 {
+		named := map[string]bool{}
+		for _, name := range opts.feeds {
+			named[strings.ToLower(name)] = true
+		}
+		if len(named) > maxFeeds {
+			return fmt.Errorf("feed must name at most %d feeds", maxFeeds)
+		}
+	}
+	if opts.sortBy != "" && opts.sortBy != sortByStart && opts.sortBy != sortBySummary {
+		return fmt.Errorf("sort must be %s or %s", sortByStart, sortBySummary)
+	}
+	if opts.as != "" && opts.as != asVTodo && opts.as != asVJournal {
+		return fmt.Errorf("as must be %s or %s", asVTodo, asVJournal)
+	}
+	for _, day := range opts.weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+	}
+	for name, value := range map[string]string{"from": opts.from, "to": opts.to} {
+		if _, err := parseWindowTime(value); value != "" && err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 time or a date", name)
+		}
+	}
+	if opts.ifModifiedSince != "" {
+		if _, err := time.Parse(time.RFC3339, opts.ifModifiedSince); err != nil {
+			return fmt.Errorf("if_modified_since must be an RFC 3339 time")
+		}
+	}
+	return nil
+}
+
+// window returns the from and to bounds of the request, as validated by
+// validate.
+//
+// Returns:
+// - The start of the window, or the zero time if it is open.
+// - The end of the window, or the zero time if it is open.
+func (opts aggregateOptions) window() (time.Time, time.Time) {
+	var from, to time.Time
+	if opts.from != "" {
+		from, _ = parseWindowTime(opts.from)
+	}
+	if opts.to != "" {
+		to, _ = parseWindowTime(opts.to)
+	}
+	return from, to
+}
+
+// feedBody returns the calendar data of a feed, serving it from the cache when
+// possible and storing any freshly fetched data for later requests. Fetches
+// sooner than the feed's minimum refresh interval reuse the latest body.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed to load.
+// - bypassCache: Whether to fetch even if a valid cache entry exists.
+//
+// Returns:
+// - A string containing the calendar data.
+// - An error if the feed had to be fetched and the fetch failed.
+func (s *server) feedBody(ctx context.Context, feed FeedConfig, bypassCache bool) (string, error) {
+	req := feed.request()
+	if !bypassCache {
+		if body, ok := s.cache.get(req.Key()); ok {
+			return body, nil
+		}
+	}
+
+	interval := feed.minRefresh(s.cfg.Cache.MinRefreshSeconds)
+	fetchCtx := ctx
+	if interval > 0 {
+		// Other requests may wait on this fetch, so it outlives this request,
+		// bounded by the feed's timeout per attempt, and spends its own retries.
+		fetchCtx = withRetryBudget(context.WithoutCancel(ctx), s.cfg.Retry.Budget)
+	}
+	body, err := s.fetches.fetch(ctx, req.Key(), interval, func() (string, error) {
+		logf(fetchCtx, "Fetching %s", feed.Name)
+		return s.fetchWithRetries(fetchCtx, feed)
+	})
+	if err != nil {
+		return "", err
+	}
+	s.cache.set(req.Key(), body)
+	return body, nil
+}
+
+// feedEvents loads a feed and returns its events after the configured
+// validation passes. A body that parses is recorded in the feed's history, and
+// with track_sequence changed events have their SEQUENCE raised.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed to load.
+// - bypassCache: Whether to fetch even if a valid cache entry exists.
+//
+// Returns:
+// - The feed's events, in source order.
+// - An error if the feed could not be fetched or parsed.
+func (s *server) feedEvents(ctx context.Context, feed FeedConfig, bypassCache bool) ([]*ics.VEvent, error) {
+	body, err := s.feedBody(ctx, feed, bypassCache)
+	if err != nil {
+		return nil, err
+	}
+	return s.bodyEvents(ctx, feed, body)
+}
+
+// bodyEvents parses a loaded feed body as described for feedEvents.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed the body belongs to.
+// - body: The calendar data of the feed.
+//
+// Returns:
+// - The feed's events, in source order.
+// - An error if the body could not be parsed.
+func (s *server) bodyEvents(ctx context.Context, feed FeedConfig, body string) ([]*ics.VEvent, error) {
+	events, err := s.parseFeed(ctx, feed, body)
+	if err != nil {
+		return nil, err
+	}
+	s.history.add(feed.Name, body)
+	if s.cfg.TrackSequence {
+		s.sequences.apply(feed.Name, events)
+	}
+	return events, nil
+}
+
+// parseFeed parses a feed body and returns its events after the configured
+// validation passes. A feed with strict parsing fails on its first validation
+// error; advisory warnings don't fail it.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed the body belongs to.
+// - body: The calendar data of the feed.
+//
+// Returns:
+// - The feed's events, in source order.
+// - An error if the body could not be parsed.
+func (s *server) parseFeed(ctx context.Context, feed FeedConfig, body string) ([]*ics.VEvent, error) {
+	if s.cfg.EnforceVersion {
+		if err := checkVersion(feed, body); err != nil {
+			return nil, err
+		}
+	} else {
+		body = upgradeVersion(body)
+	}
+	if s.cfg.CalScale == calScaleReject {
+		if err := checkCalScale(feed, body); err != nil {
+			return nil, err
+		}
+	}
+	if feed.DateFormat != "" {
+		body = fetcher.NormalizeDates(body, feed.DateFormat)
+	}
+
+	cal, err := parseCalendar(body, s.cfg.Parse)
+	if err != nil && s.cfg.Parse.Sanitize {
+		if sanitized := sanitizeCalendar(body); sanitized != body {
+			if retried, retryErr := parseCalendar(sanitized, s.cfg.Parse); retryErr == nil {
+				warnf(ctx, "Feed %s only parsed after sanitizing: %v", feed.Name, err)
+				cal, err = retried, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", feed.Name, err)
+	}
+
+	strict := feed.Parsing == parsingStrict
+	var feedWarnings *parseWarnings
+	if strict {
+		// The feed's own validation errors are collected apart, as any of them
+		// fails it; every message still reaches the request's collector.
+		parent, _ := ctx.Value(warningsKey{}).(*parseWarnings)
+		feedWarnings = &parseWarnings{parent: parent}
+		ctx = withWarnings(ctx, feedWarnings)
+	}
+	var events []*ics.VEvent
+	for _, event := range cal.Events() {
+		if event == nil {
+			// The parser yields a nil event for one cut off before its END.
+			invalidf(ctx, "Feed %s ends in the middle of an event; skipping it", feed.Name)
+			continue
+		}
+		if s.cfg.Strict || strict {
+			if err := checkRequiredProperties(event); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", feed.Name, err)
+			}
+		}
+		if s.cfg.RecurrenceOverrides == recurrenceOverridesDrop && recurrenceID(event) != "" {
+			continue
+		}
+		checkUnknownProperties(ctx, event)
+		dropRepeatedProperties(ctx, event)
+		decodeQuotedPrintable(ctx, event)
+		if excludedSummary(feed.ExcludeSummaries, propertyValue(event, ics.ComponentPropertySummary)) {
+			continue
+		}
+		if feed.ForceValueType != "" {
+			forceValueType(event, feed.ForceValueType)
+		}
+		if feed.AssumeTZ != "" {
+			assumeTimezone(event, feed.AssumeTZ)
+		}
+		if s.cfg.MidnightAllDay {
+			allDayFromMidnight(event)
+		}
+		if !fixInvertedDates(ctx, event, s.cfg.InvertedDates) {
+			continue
+		}
+		if !fixMissingSummary(event, s.cfg.MissingSummary, s.cfg.DefaultSummary) {
+			continue
+		}
+		fixPriority(event, s.cfg.Priority, s.cfg.PriorityFloor)
+		setClass(event, s.cfg.Class, s.cfg.ClassOverride)
+		if s.cfg.MarkFree {
+			markFree(event)
+		}
+		if feed.Color != "" {
+			event.SetProperty(propertyColor, strings.ToLower(feed.Color))
+		}
+		if s.cfg.DeriveCategories {
+			addCategories{categories: feed.derivedCategories()}.Transform(event)
+		}
+		if s.titleTemplate != nil {
+			applyTitleTemplate(ctx, s.titleTemplate, feed, event)
+		}
+		event, keep := s.transforms.TransformFeed(feed, event)
+		if !keep {
+			continue
+		}
+		filterProperties(event, s.cfg)
+		events = append(events, event)
+	}
+	if strict {
+		if invalid := feedWarnings.errors(); len(invalid) > 0 {
+			return nil, fmt.Errorf("parsing %s strictly: %s", feed.Name, invalid[0])
+		}
+	}
+	return events, nil
+}
+
+// selectedEvents loads a feed and returns the events the request selects.
+// While the background refresh is failing, the feed's body from the last good
+// refresh is used instead of loading it. With
+// empty_feed_placeholder, a feed without events is given its placeholder. A
+// feed missing its deadline fails with errFeedDeadline and is recorded in the
+// request's missed deadlines.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed to load.
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The feed's selected events, in source order.
+// - An error if the feed could not be loaded.
+func (s *server) selectedEvents(ctx context.Context, feed FeedConfig, opts aggregateOptions) ([]*ics.VEvent, error) {
+	loadCtx := ctx
+	deadline := feed.deadline(s.cfg.FeedDeadlineSeconds)
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		loadCtx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	var events []*ics.VEvent
+	var err error
+	if body, ok := s.history.pinned(feed.Name, opts.pins); ok {
+		events, err = s.parseFeed(loadCtx, feed, body)
+	} else if body, ok := s.staleBody(feed); ok {
+		events, err = s.parseFeed(loadCtx, feed, body)
+	} else {
+		events, err = s.feedEvents(loadCtx, feed, opts.bypassCache)
+	}
+	if errors.Is(err, fetcher.ErrTooLarge) {
+		// Skipped rather than failed, so strict mode serves the other feeds.
+		logf(ctx, "Skipping %s: %v", feed.Name, err)
+		recordSkipped(ctx, feed)
+		return nil, nil
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(loadCtx.Err(), context.DeadlineExceeded) {
+		recordMissedDeadline(ctx, feed)
+		return nil, fmt.Errorf("%s %w of %v: %v", feed.Name, errFeedDeadline, deadline, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 && s.cfg.EmptyFeedPlaceholder {
+		events = []*ics.VEvent{placeholderEvent(feed, time.Now())}
+	}
+	from, to := opts.window()
+	only := opts.only
+	if len(only) == 0 {
+		only = s.cfg.Only
+	}
+	var selected []*ics.VEvent
+	for _, event := range events {
+		if matchesCountry(feed, event, opts.countries) && matchesWeekday(event, opts.weekdays, s.weekdayLocation) && matchesLocation(event, opts.location) && matchesOnly(event, only, s.cfg.OnlyMatch) && matchesWindow(event, from, to) {
+			selected = append(selected, event)
+		}
+	}
+	return selected, nil
+}
+
+// collectEvents loads every feed concurrently and returns their selected events
+// once all are done, for responses that need the whole aggregate at once.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The selected events of each feed, in feed order; feeds that failed are empty.
+// - The parse warnings of each feed, in feed order; feeds not selected have none.
+// - The error each feed failed with, in feed order; nil for feeds that loaded.
+func (s *server) collectEvents(ctx context.Context, opts aggregateOptions) ([][]*ics.VEvent, []*parseWarnings, []error) {
+	feedEvents := make([][]*ics.VEvent, len(s.cfg.Feeds))
+	warnings := make([]*parseWarnings, len(s.cfg.Feeds))
+	errs := make([]error, len(s.cfg.Feeds))
+	var wg sync.WaitGroup
+
+	for i, feed := range s.cfg.Feeds {
+		warnings[i] = &parseWarnings{}
+		if !opts.includesFeed(feed) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, feed FeedConfig) {
+			defer wg.Done()
+			events, err := s.selectedEvents(withWarnings(ctx, warnings[i]), feed, opts)
+			if err != nil {
+				logf(ctx, "Error loading %s: %v", feed.Name, err)
+				errs[i] = err
+				return
+			}
+			feedEvents[i] = events
+		}(i, feed)
+	}
+	wg.Wait()
+
+	return feedEvents, warnings, errs
+}
+
+// strictFailure returns the first problem, in feed order, that fails a
+// request in strict mode: a feed that could not be loaded, or one with a
+// validation error that lenient parsing skipped. Advisory warnings, such as
+// vendor X- properties, don't fail it.
+//
+// Parameters:
+// - warnings: The parse warnings of each feed, as returned by collectEvents.
+// - errs: The error of each feed, as returned by collectEvents.
+//
+// Returns:
+// - An error naming the feed, or nil if every feed is clean.
+func (s *server) strictFailure(warnings []*parseWarnings, errs []error) error {
+	for i, feed := range s.cfg.Feeds {
+		if errs[i] != nil {
+			return fmt.Errorf("loading %s: %w", feed.Name, errs[i])
+		}
+		if invalid := warnings[i].errors(); len(invalid) > 0 {
+			return fmt.Errorf("validating %s: %s", feed.Name, invalid[0])
+		}
+	}
+	return nil
+}
+
+// aggregateEvents loads every feed concurrently and sends each selected event,
+// serialized, to the returned channel. The channel is buffered by the configured
+// event_buffer so that feeds can keep processing ahead of a slow consumer, and is
+// closed once every feed is done or ctx is cancelled. Events arrive in the
+// order feeds finish loading, unless stream_order is "config".
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The channel of serialized events.
+// - The number of events sent per feed, final once the channel is closed.
+func (s *server) aggregateEvents(ctx context.Context, opts aggregateOptions) (<-chan string, []int) {
+	warn := newLineWarner(ctx, s.cfg.WarnLineOctets)
+	return s.streamEvents(ctx, opts, func(feed FeedConfig, event *ics.VEvent) string {
+		return serializeEvent(event, opts.as, s.cfg.FoldOctets, warn)
+	})
+}
+
+// streamEvents loads every feed concurrently like aggregateEvents, sending each
+// selected event as rendered by render.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - opts: The per-request aggregation settings.
+// - render: Renders an event of a feed for the channel.
+//
+// Returns:
+// - The channel of rendered events.
+// - The number of events sent per feed, final once the channel is closed.
+func (s *server) streamEvents(ctx context.Context, opts aggregateOptions, render func(FeedConfig, *ics.VEvent) string) (<-chan string, []int) {
+	eventChan := make(chan string, s.cfg.EventBuffer)
+	counts := make([]int, len(s.cfg.Feeds))
+	var wg sync.WaitGroup
+
+	// In configured order each feed still loads concurrently, but waits for the
+	// previous one to finish sending before releasing its own events.
+	ordered := s.cfg.StreamOrder == streamOrderConfig
+	prev := make(chan struct{})
+	close(prev)
+
+	// Fetch calendars concurrently
+	for i, feed := range s.cfg.Feeds {
+		if !opts.includesFeed(feed) {
+			continue
+		}
+		done := make(chan struct{})
+		wg.Add(1)
+		go func(i int, feed FeedConfig, turn <-chan struct{}, done chan<- struct{}) {
+			defer wg.Done()
+			defer close(done)
+			events, err := s.selectedEvents(ctx, feed, opts)
+			if ordered {
+				select {
+				case <-turn:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				// Once the request has ended nobody is left to tell.
+				if ctx.Err() == nil {
+					logf(ctx, "Error loading %s: %v", feed.Name, err)
+				}
+				return
+			}
+			for _, event := range events {
+				select {
+				case eventChan <- render(feed, event):
+					counts[i]++
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i, feed, prev, done)
+		prev = done
+	}
+
+	// Close the channel once all goroutines are done
+	go func() {
+		wg.Wait()
+		close(eventChan)
+	}()
+
+	return eventChan, counts
+}
+
+// End, aggregate.go
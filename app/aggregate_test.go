@@ -0,0 +1,148 @@
+// aggregate_test.go
+// This file contains tests and benchmarks for the aggregation pipeline.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syntheticCalendar returns calendar data holding n all-day events.
+func syntheticCalendar(name string, n int) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n")
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "BEGIN:VEVENT\r\nUID:%s-%d\r\nSUMMARY:%s Holiday %d\r\nDTSTART;VALUE=DATE:%s\r\nEND:VEVENT\r\n",
+			name, i, name, i, start.AddDate(0, 0, i%365).Format("20060102"))
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// newCachedServer returns a server whose feeds are already in the cache, so
+// aggregating them involves no network access.
+func newCachedServer(feeds, eventsPerFeed, buffer int) *server {
+	cfg := defaultConfig()
+	cfg.EventBuffer = buffer
+	cfg.Feeds = nil
+	for i := 0; i < feeds; i++ {
+		cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: fmt.Sprintf("Feed%d", i), URL: fmt.Sprintf("http://feed%d.invalid/", i)})
+	}
+
+	s := newServer(cfg)
+	for _, feed := range cfg.Feeds {
+		s.cache.set(feed.request().Key(), syntheticCalendar(feed.Name, eventsPerFeed))
+	}
+	return s
+}
+
+// TestAggregateEventsBuffered tests that feeds run ahead of the consumer when buffered.
+func TestAggregateEventsBuffered(t *testing.T) {
+	s := newCachedServer(2, 3, 16)
+	eventChan, _ := s.aggregateEvents(context.Background(), aggregateOptions{})
+
+	// Without reading, both feeds should be able to queue all their events.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(eventChan) < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := len(eventChan); got != 6 {
+		t.Fatalf("Expected 6 queued events before reading, got %d", got)
+	}
+
+	received := 0
+	for range eventChan {
+		received++
+	}
+	if received != 6 {
+		t.Errorf("Expected 6 events, got %d", received)
+	}
+}
+
+// TestAggregateEventsConfigOrder tests that stream_order: config releases feeds
+// in their configured order even when earlier feeds are slower.
+func TestAggregateEventsConfigOrder(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.StreamOrder = streamOrderConfig
+	cfg.Feeds = nil
+	for i, delay := range []time.Duration{60 * time.Millisecond, 0, 30 * time.Millisecond} {
+		name := fmt.Sprintf("Feed%d", i)
+		body := syntheticCalendar(name, 2)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			io.WriteString(w, body)
+		}))
+		defer upstream.Close()
+		cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: name, URL: upstream.URL})
+	}
+
+	eventChan, _ := newServer(cfg).aggregateEvents(context.Background(), aggregateOptions{})
+	var uids []string
+	for event := range eventChan {
+		for _, line := range strings.Split(event, "\r\n") {
+			if uid, ok := strings.CutPrefix(line, "UID:"); ok {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	want := "Feed0-0,Feed0-1,Feed1-0,Feed1-1,Feed2-0,Feed2-1"
+	if got := strings.Join(uids, ","); got != want {
+		t.Errorf("Expected events in configured order %s, got %s", want, got)
+	}
+}
+
+// TestAggregateEventsCancelled tests that cancelling the request stops blocked feeds.
+func TestAggregateEventsCancelled(t *testing.T) {
+	s := newCachedServer(2, 3, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	eventChan, _ := s.aggregateEvents(ctx, aggregateOptions{})
+	<-eventChan
+	cancel()
+
+	select {
+	case <-drain(eventChan):
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the channel to close after cancellation")
+	}
+}
+
+// drain reads eventChan until it is closed and then closes the returned channel.
+func drain(eventChan <-chan string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range eventChan {
+		}
+		close(done)
+	}()
+	return done
+}
+
+// BenchmarkAggregateEvents compares streaming throughput with and without
+// buffering. The consumer gzips each event, as the compression middleware does,
+// so that writing costs about as much as producing.
+func BenchmarkAggregateEvents(b *testing.B) {
+	for _, buffer := range []int{0, 256} {
+		b.Run(fmt.Sprintf("buffer=%d", buffer), func(b *testing.B) {
+			s := newCachedServer(8, 500, buffer)
+			zw := gzip.NewWriter(io.Discard)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				eventChan, _ := s.aggregateEvents(context.Background(), aggregateOptions{})
+				for event := range eventChan {
+					io.WriteString(zw, event)
+					zw.Flush()
+				}
+			}
+		})
+	}
+}
+
+// End, aggregate_test.go
@@ -0,0 +1,152 @@
+// aggregatejson.go
+// This file contains the plain JSON rendering of the aggregate.
+package main
+
+import (
+	"net/http"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// dateFormatRFC3339 writes times as RFC 3339 strings.
+	dateFormatRFC3339 = "rfc3339"
+	// dateFormatUnix writes times as Unix timestamps in seconds.
+	dateFormatUnix = "unix"
+	// dateFormatDate writes times as their YYYY-MM-DD date.
+	dateFormatDate = "date"
+)
+
+// groupBySource groups the /aggregate_json events under the name of their feed.
+const groupBySource = "source"
+
+// jsonEvent is an event as served by /aggregate_json.
+type jsonEvent struct {
+	Feed        string `json:"feed"`
+	UID         string `json:"uid,omitempty"`
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	// Resources lists the event's ATTACH links and URL.
+	Resources []string `json:"resources,omitempty"`
+	// Start and End are formatted by formatEventTime; End is omitted for
+	// events without a DTEND or DURATION.
+	Start any `json:"start,omitempty"`
+	End   any `json:"end,omitempty"`
+}
+
+// formatEventTime renders a time in the requested date_format.
+//
+// Parameters:
+// - t: The time to render.
+// - format: One of "rfc3339", "unix", or "date".
+//
+// Returns:
+// - A string, or an int64 for "unix".
+func formatEventTime(t time.Time, format string) any {
+	switch format {
+	case dateFormatUnix:
+		return t.Unix()
+	case dateFormatDate:
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// jsonEventFor describes an event for /aggregate_json.
+//
+// Parameters:
+// - feed: The feed the event came from.
+// - event: The event to describe.
+// - dateFormat: The date_format of start and end.
+// - loc: The zone floating times and all-day dates are read in.
+//
+// Returns:
+// - The description.
+func jsonEventFor(feed FeedConfig, event *ics.VEvent, dateFormat string, loc *time.Location) jsonEvent {
+	described := jsonEvent{
+		Feed:        feed.Name,
+		UID:         event.Id(),
+		Summary:     propertyValue(event, ics.ComponentPropertySummary),
+		Description: propertyValue(event, ics.ComponentPropertyDescription),
+		Location:    propertyValue(event, ics.ComponentPropertyLocation),
+		Resources:   eventResources(event),
+	}
+	if start, err := eventStartIn(event, loc); err == nil {
+		described.Start = formatEventTime(start, dateFormat)
+	}
+	if end, err := eventEndIn(event, loc); err == nil {
+		described.End = formatEventTime(end, dateFormat)
+	}
+	return described
+}
+
+// aggregateJSON serves the aggregate as a JSON object listing events ordered
+// by DTSTART. date_format=unix|rfc3339|date controls how start and end are
+// written, rfc3339 by default, and each event's ATTACH links and URL are
+// collected into its resources. group=source instead maps each selected feed's
+// name to its events, filtered but neither deduplicated nor merged, in source
+// order. It accepts the feed selection parameters of aggregateICS and, like it,
+// fails with a 502 in strict mode.
+func (s *server) aggregateJSON(c *gin.Context) {
+	opts := parseAggregateOptions(c)
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dateFormat := c.Query("date_format")
+	switch dateFormat {
+	case "":
+		dateFormat = dateFormatRFC3339
+	case dateFormatRFC3339, dateFormatUnix, dateFormatDate:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_format must be unix, rfc3339, or date"})
+		return
+	}
+	group := c.Query("group")
+	if group != "" && group != groupBySource {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group must be " + groupBySource})
+		return
+	}
+
+	feedEvents, warnings, errs := s.collectEvents(c.Request.Context(), opts)
+	if s.cfg.Strict {
+		if err := s.strictFailure(warnings, errs); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if group == groupBySource {
+		sources := map[string][]jsonEvent{}
+		for i, feed := range s.cfg.Feeds {
+			if !opts.includesFeed(feed) {
+				continue
+			}
+			sources[feed.Name] = []jsonEvent{}
+			for _, event := range feedEvents[i] {
+				sources[feed.Name] = append(sources[feed.Name], jsonEventFor(feed, event, dateFormat, s.floatingLocation))
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"sources": sources})
+		return
+	}
+	if s.cfg.Dedup.Enabled {
+		feedEvents = dedupEvents(feedEvents, s.cfg.Dedup)
+	}
+	described := map[*ics.VEvent]jsonEvent{}
+	for i, events := range feedEvents {
+		for _, event := range events {
+			described[event] = jsonEventFor(s.cfg.Feeds[i], event, dateFormat, s.floatingLocation)
+		}
+	}
+
+	list := []jsonEvent{}
+	for _, event := range orderEvents(feedEvents, s.cfg.Sort.Concurrency, sortByStart) {
+		list = append(list, described[event])
+	}
+	c.JSON(http.StatusOK, gin.H{"events": list})
+}
+
+// End, aggregatejson.go
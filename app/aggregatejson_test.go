@@ -0,0 +1,140 @@
+// aggregatejson_test.go
+// This file contains tests for the plain JSON output.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAggregateJSONDateFormat tests that each date_format renders the start
+// and end of the same event as expected.
+func TestAggregateJSONDateFormat(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds = cfg.Feeds[1:]
+	cfg.Feeds[0].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:Canada Day\nDTSTART:20230701T160000Z\nDTEND:20230701T180000Z\nEND:VEVENT\nEND:VCALENDAR\n").URL
+	s := newServer(cfg)
+	s.floatingLocation = time.UTC
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	tests := []struct {
+		format     string
+		start, end any
+	}{
+		{"", "2023-07-01T16:00:00Z", "2023-07-01T18:00:00Z"},
+		{"rfc3339", "2023-07-01T16:00:00Z", "2023-07-01T18:00:00Z"},
+		{"unix", float64(1688227200), float64(1688234400)},
+		{"date", "2023-07-01", "2023-07-01"},
+	}
+	for _, tt := range tests {
+		var doc struct {
+			Events []struct {
+				Summary string `json:"summary"`
+				Start   any    `json:"start"`
+				End     any    `json:"end"`
+			} `json:"events"`
+		}
+		if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/aggregate_json?date_format="+tt.format)), &doc); err != nil {
+			t.Fatalf("%q: error decoding events: %v", tt.format, err)
+		}
+		if len(doc.Events) != 1 || doc.Events[0].Summary != "Canada Day" {
+			t.Fatalf("%q: expected the Canada Day event, got %+v", tt.format, doc.Events)
+		}
+		if got := doc.Events[0]; got.Start != tt.start || got.End != tt.end {
+			t.Errorf("%q: expected start %v and end %v, got %v and %v", tt.format, tt.start, tt.end, got.Start, got.End)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_json?date_format=iso")
+	if err != nil {
+		t.Fatalf("Error requesting events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown date_format, got %d", resp.StatusCode)
+	}
+}
+
+// TestAggregateJSONGroupBySource tests that group=source lists each feed's
+// events under its name, in source order.
+func TestAggregateJSONGroupBySource(t *testing.T) {
+	cfg := newTestConfig(t)
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	var doc struct {
+		Sources map[string][]struct {
+			Feed    string `json:"feed"`
+			Summary string `json:"summary"`
+		} `json:"sources"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/aggregate_json?group=source")), &doc); err != nil {
+		t.Fatalf("Error decoding sources: %v", err)
+	}
+	want := map[string][]string{
+		"Colombia": {"Colombian New Year", "Colombian Independence Day"},
+		"Canada":   {"Canadian New Year", "Canada Day"},
+	}
+	if len(doc.Sources) != len(want) {
+		t.Fatalf("Expected %d sources, got %+v", len(want), doc.Sources)
+	}
+	for name, summaries := range want {
+		events := doc.Sources[name]
+		if len(events) != len(summaries) {
+			t.Fatalf("Expected %d events under %s, got %+v", len(summaries), name, events)
+		}
+		for i, event := range events {
+			if event.Feed != name || event.Summary != summaries[i] {
+				t.Errorf("Expected %q from %s at %d, got %q from %s", summaries[i], name, i, event.Summary, event.Feed)
+			}
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_json?group=country")
+	if err != nil {
+		t.Fatalf("Error requesting events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown group, got %d", resp.StatusCode)
+	}
+}
+
+// TestAggregateJSONResources tests that an event's two ATTACH links are listed
+// in its resources, that inline binary attachments are not, and that events
+// without links have none.
+func TestAggregateJSONResources(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, strings.Replace(mockCanadianCalendar, "SUMMARY:Canada Day", "SUMMARY:Canada Day\nATTACH:https://www.canada.ca/en/canadian-heritage/services/important-commemorative-days/canada-day.html\nATTACH;FMTTYPE=application/pdf:https://example.com/canada-day.pdf\nATTACH;ENCODING=BASE64;VALUE=BINARY:aGVsbG8=", 1)).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	var doc struct {
+		Events []struct {
+			Summary   string   `json:"summary"`
+			Resources []string `json:"resources"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/aggregate_json")), &doc); err != nil {
+		t.Fatalf("Error decoding events: %v", err)
+	}
+	want := []string{"https://www.canada.ca/en/canadian-heritage/services/important-commemorative-days/canada-day.html", "https://example.com/canada-day.pdf"}
+	for _, event := range doc.Events {
+		if event.Summary != "Canada Day" {
+			if len(event.Resources) != 0 {
+				t.Errorf("Expected no resources for %s, got %v", event.Summary, event.Resources)
+			}
+			continue
+		}
+		if strings.Join(event.Resources, " ") != strings.Join(want, " ") {
+			t.Errorf("Expected resources %v, got %v", want, event.Resources)
+		}
+	}
+}
+
+// End, aggregatejson_test.go
@@ -0,0 +1,73 @@
+// allowlist.go
+// This file contains the allowed_properties filter guaranteeing minimal feeds.
+package main
+
+import (
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// propertyAllowed reports whether allowed_properties lets a property through.
+// Without an allowlist every property is allowed.
+//
+// Parameters:
+// - name: The property name, in any case.
+//
+// Returns:
+// - True if the property may be served.
+func (cfg *Config) propertyAllowed(name string) bool {
+	if len(cfg.AllowedProperties) == 0 {
+		return true
+	}
+	for _, allowed := range cfg.AllowedProperties {
+		if strings.EqualFold(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarMethod returns the METHOD of the combined calendar, which is omitted
+// when allowed_properties doesn't list it. VERSION and PRODID are mandatory
+// and always written.
+//
+// Returns:
+// - The configured METHOD, or "" to omit it.
+func (cfg *Config) calendarMethod() string {
+	if !cfg.propertyAllowed(string(ics.PropertyMethod)) {
+		return ""
+	}
+	return cfg.Method
+}
+
+// filterProperties removes the properties of an event that allowed_properties
+// doesn't list. The properties RFC 5545 requires are always retained.
+//
+// Parameters:
+// - event: The event to edit.
+// - cfg: The configuration holding the allowlist.
+func filterProperties(event *ics.VEvent, cfg *Config) {
+	if len(cfg.AllowedProperties) == 0 {
+		return
+	}
+	kept := event.Properties[:0]
+	for _, prop := range event.Properties {
+		if cfg.propertyAllowed(prop.IANAToken) || isRequiredProperty(prop.IANAToken) {
+			kept = append(kept, prop)
+		}
+	}
+	event.Properties = kept
+}
+
+// isRequiredProperty reports whether RFC 5545 requires an event property.
+func isRequiredProperty(name string) bool {
+	for _, required := range requiredProperties {
+		if strings.EqualFold(string(required), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// End, allowlist.go
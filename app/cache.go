@@ -0,0 +1,180 @@
+// cache.go
+// This file contains the in-memory cache of fetched feed bodies.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a feed body along with the time it was fetched.
+type cacheEntry struct {
+	body      string
+	fetchedAt time.Time
+	// lastModified is the newest LAST-MODIFIED in body.
+	lastModified time.Time
+}
+
+// feedCache stores fetched feed bodies for a limited time, keyed by request.
+type feedCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+// newFeedCache creates an empty cache.
+//
+// Parameters:
+// - ttl: How long a fetched body stays valid; zero or less disables caching.
+//
+// Returns:
+// - A ready-to-use feedCache.
+func newFeedCache(ttl time.Duration) *feedCache {
+	return &feedCache{
+		ttl:     ttl,
+		entries: map[string]cacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// get returns the cached body for key if it has not expired.
+//
+// Parameters:
+// - key: The request key of the feed.
+//
+// Returns:
+// - The cached body.
+// - True if a valid entry was found.
+func (fc *feedCache) get(key string) (string, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	entry, ok := fc.entries[key]
+	if !ok || fc.now().Sub(entry.fetchedAt) >= fc.ttl {
+		return "", false
+	}
+	return entry.body, true
+}
+
+// set stores a freshly fetched body for key.
+//
+// Parameters:
+// - key: The request key of the feed.
+// - body: The fetched calendar data.
+func (fc *feedCache) set(key, body string) {
+	if fc.ttl <= 0 {
+		return
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.entries[key] = cacheEntry{body: body, fetchedAt: fc.now(), lastModified: latestModified(body)}
+}
+
+// age returns how long ago the body cached for key was fetched, if it is still valid.
+//
+// Parameters:
+// - key: The request key of the feed.
+//
+// Returns:
+// - The age of the cached body.
+// - True if a valid entry was found.
+func (fc *feedCache) age(key string) (time.Duration, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	entry, ok := fc.entries[key]
+	if !ok {
+		return 0, false
+	}
+	age := fc.now().Sub(entry.fetchedAt)
+	if age >= fc.ttl {
+		return 0, false
+	}
+	return age, true
+}
+
+// lastModified returns the newest LAST-MODIFIED of the body cached for key, if
+// it is still valid.
+//
+// Parameters:
+// - key: The request key of the feed.
+//
+// Returns:
+// - The newest LAST-MODIFIED, or the zero time if the body has none.
+// - True if a valid entry was found.
+func (fc *feedCache) lastModified(key string) (time.Time, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	entry, ok := fc.entries[key]
+	if !ok || fc.now().Sub(entry.fetchedAt) >= fc.ttl {
+		return time.Time{}, false
+	}
+	return entry.lastModified, true
+}
+
+// persistedEntry is a cache entry as saved to cache.persist_path.
+type persistedEntry struct {
+	Body      string    `json:"body"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// save atomically writes the cache's entries to a JSON file.
+//
+// Parameters:
+// - path: The file to replace.
+//
+// Returns:
+// - An error if the file could not be written.
+func (fc *feedCache) save(path string) error {
+	fc.mu.Lock()
+	entries := make(map[string]persistedEntry, len(fc.entries))
+	for key, entry := range fc.entries {
+		entries[key] = persistedEntry{Body: entry.body, FetchedAt: entry.fetchedAt}
+	}
+	fc.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(path, data)
+}
+
+// load adds the unexpired entries of a file written by save. Entries keep the
+// time they were originally fetched, so they expire as if never persisted.
+//
+// Parameters:
+// - path: The file to read.
+//
+// Returns:
+// - The number of entries loaded.
+// - An error if the file could not be read or is corrupt, leaving the cache as it was.
+func (fc *feedCache) load(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var entries map[string]persistedEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	loaded := 0
+	for key, entry := range entries {
+		if fc.now().Sub(entry.FetchedAt) >= fc.ttl {
+			continue
+		}
+		fc.entries[key] = cacheEntry{body: entry.Body, fetchedAt: entry.FetchedAt, lastModified: latestModified(entry.Body)}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// End, cache.go
@@ -0,0 +1,50 @@
+// cache_test.go
+// This file contains tests for the feed cache.
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCachePersist tests that a cache saved by a refresh is loaded by the next
+// server, which then serves the feeds without fetching them.
+func TestCachePersist(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Cache.PersistPath = filepath.Join(t.TempDir(), "cache.json")
+	upstream := newFeedServer(t, mockCanadianCalendar)
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL}}
+
+	if err := newServer(cfg).refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+	// The feed can't be fetched from here on.
+	upstream.Close()
+
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	if !strings.Contains(body, "SUMMARY:Canada Day") {
+		t.Errorf("Expected the persisted Canadian events, got:\n%s", body)
+	}
+}
+
+// TestCacheLoadCorrupt tests that a corrupt cache file is ignored.
+func TestCacheLoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig(t)
+	cfg.Cache.PersistPath = path
+	cfg.Refresh.IntervalSeconds = 60
+	if s := newServer(cfg); s.ready.Load() || len(s.cache.entries) != 0 {
+		t.Errorf("Expected a corrupt cache file to be ignored")
+	}
+}
+
+// End, cache_test.go
@@ -0,0 +1,71 @@
+// checksum.go
+// This file contains the X-Content-SHA256 checksum of the served calendars.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checksumHeader carries the hex SHA-256 of the calendar bytes a handler wrote,
+// before any gzip compression, so that monitoring can notice unexpected changes.
+const checksumHeader = "X-Content-SHA256"
+
+// checksumWriter hashes everything written through it on its way to w, for
+// streamed responses whose checksum is only known at the end.
+type checksumWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+// newChecksumWriter returns a checksumWriter passing its writes on to w.
+//
+// Parameters:
+// - w: The destination of the calendar data.
+//
+// Returns:
+// - The hashing writer.
+func newChecksumWriter(w io.Writer) *checksumWriter {
+	return &checksumWriter{w: w, h: sha256.New()}
+}
+
+// Write passes p on to the destination and hashes the bytes it accepted.
+//
+// Parameters:
+// - p: The calendar data.
+//
+// Returns:
+// - The number of bytes written.
+// - An error if the destination failed.
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.h.Write(p[:n])
+	return n, err
+}
+
+// sum returns the checksum of everything written so far.
+//
+// Returns:
+// - The lowercase hex SHA-256.
+func (cw *checksumWriter) sum() string {
+	return hex.EncodeToString(cw.h.Sum(nil))
+}
+
+// serveCalendar writes a fully rendered calendar with a 200 status, the
+// configured content type, and its checksum in X-Content-SHA256.
+//
+// Parameters:
+// - c: The request context.
+// - body: The calendar, exactly as it is to be written.
+func (s *server) serveCalendar(c *gin.Context, body []byte) {
+	sum := sha256.Sum256(body)
+	c.Header(checksumHeader, hex.EncodeToString(sum[:]))
+	c.Data(http.StatusOK, s.cfg.ContentType, body)
+}
+
+// End, checksum.go
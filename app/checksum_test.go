@@ -0,0 +1,42 @@
+// checksum_test.go
+// This file contains tests for the X-Content-SHA256 checksum.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAggregateICSChecksum tests that X-Content-SHA256 matches the served body,
+// as a header when buffering and a trailer when streaming, with and without
+// the blank-line cleanup rewriting the output.
+func TestAggregateICSChecksum(t *testing.T) {
+	cfg := newTestConfig(t)
+	for _, dropBlankLines := range []bool{false, true} {
+		cfg.DropBlankLines = dropBlankLines
+		srv := httptest.NewServer(newRouter(cfg))
+
+		for _, path := range []string{"/aggregate_ics?sort=start", "/aggregate_ics"} {
+			resp, err := http.Get(srv.URL + path)
+			if err != nil {
+				t.Fatalf("Error requesting %s: %v", path, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			sum := sha256.Sum256(body)
+			want := hex.EncodeToString(sum[:])
+			got := resp.Header.Get(checksumHeader) + resp.Trailer.Get(checksumHeader)
+			if got != want {
+				t.Errorf("%s (drop_blank_lines %v): Expected %s %s, got %q", path, dropBlankLines, checksumHeader, want, got)
+			}
+		}
+		srv.Close()
+	}
+}
+
+// End, checksum_test.go
@@ -0,0 +1,72 @@
+// cleanup.go
+// This file contains the removal of blank lines from assembled calendars.
+package main
+
+import "io"
+
+// blankLineWriter drops empty lines from the calendar written through it. RFC
+// 5545 allows none between content lines, and strict parsers reject a calendar
+// whose header, events, and footer were joined with stray line breaks.
+type blankLineWriter struct {
+	w io.Writer
+	// midLine is set once the current line has content.
+	midLine bool
+	// cr holds back a CR starting a line until it is known not to end a blank one.
+	cr bool
+}
+
+// Write passes p on without the empty lines it contains, keeping track of
+// lines split across calls.
+//
+// Parameters:
+// - p: The calendar data.
+//
+// Returns:
+// - The number of bytes consumed, which is all of p unless writing failed.
+// - An error if the underlying writer failed.
+func (b *blankLineWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+1)
+	for _, c := range p {
+		if !b.midLine {
+			switch {
+			case c == '\r' && !b.cr:
+				b.cr = true
+				continue
+			case c == '\n':
+				// A bare LF or CRLF with nothing before it.
+				b.cr = false
+				continue
+			}
+			if b.cr {
+				out = append(out, '\r')
+				b.cr = false
+			}
+			b.midLine = true
+		}
+		out = append(out, c)
+		if c == '\n' {
+			b.midLine = false
+		}
+	}
+	if _, err := b.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// outputWriter wraps the destination of an assembled calendar with the
+// configured cleanup.
+//
+// Parameters:
+// - w: The destination of the calendar data.
+//
+// Returns:
+// - A writer dropping blank lines, or w itself if drop_blank_lines is off.
+func (cfg *Config) outputWriter(w io.Writer) io.Writer {
+	if !cfg.DropBlankLines {
+		return w
+	}
+	return &blankLineWriter{w: w}
+}
+
+// End, cleanup.go
@@ -0,0 +1,64 @@
+// cleanup_test.go
+// This file contains tests for the removal of blank lines from assembled calendars.
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestBlankLineWriter tests that blank lines inserted between the header,
+// events, and footer are removed, however the writes are split, and that the
+// result parses cleanly.
+func TestBlankLineWriter(t *testing.T) {
+	parts := []string{
+		calendarStart(defaultConfig()),
+		"\r\n",
+		"BEGIN:VEVENT\r\nUID:new-year@test\r\nDTSTAMP:20230101T000000Z\r\nDTSTART;VALUE=DATE:20230101\r\nSUMMARY:New Year\r\nEND:VEVENT\r\n\r\n\n",
+		"BEGIN:VEVENT\r\nUID:canada-day@test\r\nDTSTAMP:20230101T000000Z\r\n\r\nDTSTART;VALUE=DATE:20230701\r\nSUMMARY:Canada Day\r\nEND:VEVENT\r\n",
+		"\r\n\r\n",
+		calendarFooter,
+	}
+	assembled := strings.Join(parts, "")
+
+	for name, chunk := range map[string]int{"whole": len(assembled), "bytewise": 1, "split": 7} {
+		var b strings.Builder
+		w := defaultConfig().outputWriter(&b)
+		for rest := assembled; rest != ""; {
+			n := min(chunk, len(rest))
+			if _, err := w.Write([]byte(rest[:n])); err != nil {
+				t.Fatalf("%s: Error writing: %v", name, err)
+			}
+			rest = rest[n:]
+		}
+		got := b.String()
+		if want := strings.NewReplacer("\r\n\r\n\n", "\r\n", "\r\n\r\n\r\n", "\r\n", "\r\n\r\n", "\r\n").Replace(assembled); got != want {
+			t.Errorf("%s: Expected:\n%q\ngot:\n%q", name, want, got)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+			if line == "" {
+				t.Errorf("%s: Expected no blank lines, got:\n%s", name, got)
+				break
+			}
+		}
+		cal, err := ics.ParseCalendar(strings.NewReader(got))
+		if err != nil {
+			t.Fatalf("%s: Error parsing cleaned calendar: %v", name, err)
+		}
+		if len(cal.Events()) != 2 {
+			t.Errorf("%s: Expected 2 events, got %d", name, len(cal.Events()))
+		}
+	}
+
+	cfg := defaultConfig()
+	cfg.DropBlankLines = false
+	var b strings.Builder
+	cfg.outputWriter(&b).Write([]byte(assembled))
+	if b.String() != assembled {
+		t.Errorf("Expected drop_blank_lines: false to leave the calendar alone, got:\n%q", b.String())
+	}
+}
+
+// End, cleanup_test.go
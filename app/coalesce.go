@@ -0,0 +1,110 @@
+// coalesce.go
+// This file contains the minimum interval between fetches of a feed, which
+// keeps ?nocache and the refresher from hammering upstreams.
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// recentFetch is a fetch of a feed, in flight until done is closed and then
+// its result until the feed's minimum refresh interval has passed.
+type recentFetch struct {
+	// done is closed once body and err are set.
+	done      chan struct{}
+	body      string
+	err       error
+	fetchedAt time.Time
+}
+
+// recentFetches coalesces the fetches of each feed that come sooner than the
+// feed's minimum refresh interval, keyed by request.
+type recentFetches struct {
+	mu      sync.Mutex
+	entries map[string]*recentFetch
+	now     func() time.Time
+}
+
+// newRecentFetches creates an empty set of recent fetches.
+//
+// Returns:
+// - A ready-to-use recentFetches.
+func newRecentFetches() *recentFetches {
+	return &recentFetches{entries: map[string]*recentFetch{}, now: time.Now}
+}
+
+// fetch returns the body fetched for key within the last interval, waits for
+// a fetch in progress, and starts fetch otherwise. Waiting stops when ctx is
+// done, the caller that started the fetch included, while the fetch runs on
+// for the others; fetch must therefore not depend on any caller's context. A
+// body is dropped once the interval has passed, so only recent ones are held.
+//
+// Parameters:
+// - ctx: The context of the caller, bounding how long it waits.
+// - key: The request key of the feed.
+// - interval: The minimum time between fetches; zero or less calls fetch every time.
+// - fetch: Fetches the feed afresh, shared by every caller within the interval.
+//
+// Returns:
+// - The recent or freshly fetched body.
+// - The error of the fetch waited for, which is not remembered, or of ctx.
+func (rf *recentFetches) fetch(ctx context.Context, key string, interval time.Duration, fetch func() (string, error)) (string, error) {
+	if interval <= 0 {
+		return fetch()
+	}
+	rf.mu.Lock()
+	entry, ok := rf.entries[key]
+	if ok && !entry.fetchedAt.IsZero() && rf.now().Sub(entry.fetchedAt) >= interval {
+		ok = false
+	}
+	if !ok {
+		entry = &recentFetch{done: make(chan struct{})}
+		rf.entries[key] = entry
+		go rf.run(key, interval, entry, fetch)
+	}
+	rf.mu.Unlock()
+	select {
+	case <-entry.done:
+		return entry.body, entry.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// run performs a shared fetch and publishes its result to the waiters.
+//
+// Parameters:
+// - key: The request key of the feed.
+// - interval: How long a successful body is kept.
+// - entry: The fetch in progress.
+// - fetch: Fetches the feed afresh.
+func (rf *recentFetches) run(key string, interval time.Duration, entry *recentFetch, fetch func() (string, error)) {
+	body, err := fetch()
+	rf.mu.Lock()
+	entry.body, entry.err, entry.fetchedAt = body, err, rf.now()
+	if err != nil {
+		delete(rf.entries, key)
+	} else {
+		time.AfterFunc(interval, func() { rf.forget(key, entry) })
+	}
+	rf.mu.Unlock()
+	close(entry.done)
+}
+
+// forget drops a fetch whose interval has passed, unless a newer one has
+// replaced it.
+//
+// Parameters:
+// - key: The request key of the feed.
+// - entry: The fetch to drop.
+func (rf *recentFetches) forget(key string, entry *recentFetch) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.entries[key] == entry {
+		delete(rf.entries, key)
+	}
+}
+
+// End, coalesce.go
@@ -0,0 +1,117 @@
+// coalesce_test.go
+// This file contains tests for coalescing fetches sooner than the minimum
+// refresh interval.
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRecentFetchesWaiterContext tests that a caller waiting on another's slow
+// fetch gives up when its own context is done, while the fetch still finishes
+// for the caller that started it.
+func TestRecentFetchesWaiterContext(t *testing.T) {
+	rf := newRecentFetches()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	result := make(chan string)
+	go func() {
+		body, _ := rf.fetch(context.Background(), "feed", time.Minute, func() (string, error) {
+			close(started)
+			<-release
+			return "body", nil
+		})
+		result <- body
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := rf.fetch(ctx, "feed", time.Minute, func() (string, error) { return "second", nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the waiter to stop at its deadline, got %v", err)
+	}
+	close(release)
+	if got := <-result; got != "body" {
+		t.Errorf("Expected the slow fetch to finish with body, got %q", got)
+	}
+}
+
+// TestFeedBodyLeaderCancelled tests that the request starting a coalesced
+// fetch can be cancelled without failing another request waiting on it.
+func TestFeedBodyLeaderCancelled(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer upstream.Close()
+	cfg := newTestConfig(t)
+	cfg.Cache.MinRefreshSeconds = 60
+	cfg.Feeds[1].URL = upstream.URL
+	s := newServer(cfg)
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := s.feedBody(leaderCtx, cfg.Feeds[1], true)
+		leader <- err
+	}()
+	<-started
+	waiter := make(chan string, 1)
+	go func() {
+		body, err := s.feedBody(context.Background(), cfg.Feeds[1], true)
+		if err != nil {
+			t.Errorf("Expected the waiter to get the body, got %v", err)
+		}
+		waiter <- body
+	}()
+
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the leader to stop when cancelled, got %v", err)
+	}
+	close(release)
+	if body := <-waiter; !strings.Contains(body, "Canada Day") {
+		t.Errorf("Expected the waiter to get the feed, got %q", body)
+	}
+}
+
+// TestRecentFetchesExpire tests that a body is reused within the interval and
+// dropped once it has passed.
+func TestRecentFetchesExpire(t *testing.T) {
+	rf := newRecentFetches()
+	calls := 0
+	fetch := func() (string, error) {
+		calls++
+		return "body", nil
+	}
+	interval := 20 * time.Millisecond
+	rf.fetch(context.Background(), "feed", interval, fetch)
+	rf.fetch(context.Background(), "feed", interval, fetch)
+	if calls != 1 {
+		t.Errorf("Expected 1 fetch within the interval, got %d", calls)
+	}
+
+	time.Sleep(2 * interval)
+	rf.mu.Lock()
+	held := len(rf.entries)
+	rf.mu.Unlock()
+	if held != 0 {
+		t.Errorf("Expected the body to be dropped after the interval, got %d entries", held)
+	}
+	rf.fetch(context.Background(), "feed", interval, fetch)
+	if calls != 2 {
+		t.Errorf("Expected a new fetch after the interval, got %d", calls)
+	}
+}
+
+// End, coalesce_test.go
@@ -0,0 +1,27 @@
+// collection.go
+// This file contains the endpoints serving curated collections of feeds.
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collection serves the combined calendar of the feeds in the named
+// collection. It accepts the query parameters of aggregateICS, except that the
+// feeds are the collection's members. Unknown collections are a 404.
+func (s *server) collection(c *gin.Context) {
+	name := c.Param("name")
+	members, ok := s.cfg.Collections[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no collection named " + name})
+		return
+	}
+
+	opts := parseAggregateOptions(c)
+	opts.feeds = members
+	s.serveAggregate(c, opts)
+}
+
+// End, collection.go
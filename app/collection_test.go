@@ -0,0 +1,38 @@
+// collection_test.go
+// This file contains tests for the collection endpoints.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCollection tests that a collection serves only its member feeds' events
+// and that unknown collections are a 404.
+func TestCollection(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Collections = map[string][]string{"north-america": {"canada"}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/collection/north-america")
+	if !strings.Contains(body, "SUMMARY:Canada Day") || !strings.Contains(body, "SUMMARY:Canadian New Year") {
+		t.Errorf("Expected the Canadian events, got:\n%s", body)
+	}
+	if strings.Contains(body, "Colombia") {
+		t.Errorf("Expected no events from feeds outside the collection, got:\n%s", body)
+	}
+
+	resp, err := http.Get(srv.URL + "/collection/europe")
+	if err != nil {
+		t.Fatalf("Error requesting collection: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown collection, got %d", resp.StatusCode)
+	}
+}
+
+// End, collection_test.go
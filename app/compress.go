@@ -0,0 +1,111 @@
+// compress.go
+// This file contains the gzip response compression middleware.
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriter compresses everything the handler writes before passing it on to
+// the underlying gin.ResponseWriter. Content-Encoding is only announced with
+// the first bytes of a body, so that responses without one go out unencoded.
+type gzipWriter struct {
+	gin.ResponseWriter
+	zw *gzip.Writer
+	// written is set once the compressed body has started.
+	written bool
+}
+
+// Write compresses data into the response body. Until the body starts,
+// writes that can't start one, being empty, after the headers went out, or
+// for a status without a body, pass through as they are.
+func (g *gzipWriter) Write(data []byte) (int, error) {
+	if !g.written {
+		if len(data) == 0 || g.ResponseWriter.Written() || !bodyAllowedForStatus(g.Status()) {
+			return g.ResponseWriter.Write(data)
+		}
+		// Any Content-Length set by the handler describes the uncompressed body.
+		g.Header().Del("Content-Length")
+		g.Header().Set("Content-Encoding", "gzip")
+		g.written = true
+	}
+	return g.zw.Write(data)
+}
+
+// WriteString compresses s into the response body.
+func (g *gzipWriter) WriteString(s string) (int, error) {
+	return g.Write([]byte(s))
+}
+
+// Flush pushes the compressed bytes written so far to the client, so streamed
+// responses keep arriving incrementally.
+func (g *gzipWriter) Flush() {
+	if g.written {
+		_ = g.zw.Flush()
+	}
+	g.ResponseWriter.Flush()
+}
+
+// bodyAllowedForStatus reports whether a response with the given status may
+// carry a body.
+//
+// Parameters:
+// - status: The HTTP status code.
+//
+// Returns:
+// - False for 1xx, 204, and 304 responses.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status < 200, status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// acceptsGzip reports whether the request advertises gzip support.
+//
+// Parameters:
+// - req: The incoming HTTP request.
+//
+// Returns:
+// - True if the Accept-Encoding header lists gzip.
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(name, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipMiddleware compresses responses for clients that accept gzip. HEAD
+// requests, whose bodies are discarded, are left alone.
+//
+// Returns:
+// - A gin middleware wrapping the response writer in a gzip stream.
+func gzipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.Request) {
+			c.Next()
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: c.Writer, zw: gzip.NewWriter(c.Writer)}
+		c.Writer = gw
+		defer func() {
+			if gw.written {
+				_ = gw.zw.Close()
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// End, compress.go
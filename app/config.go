@@ -0,0 +1,901 @@
+// config.go
+// This file contains the configuration loaded from conf.yaml.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"gopkg.in/yaml.v3"
+
+	"github.com/appliedmedia/calendar-feed-aggregator/fetcher"
+)
+
+const (
+	// streamOrderCompletion streams each feed's events as soon as it has loaded.
+	streamOrderCompletion = "completion"
+	// streamOrderConfig streams feeds in their configured order.
+	streamOrderConfig = "config"
+)
+
+const (
+	// duplicateFeedsWarn logs duplicate feeds and keeps only the first.
+	duplicateFeedsWarn = "warn"
+	// duplicateFeedsError rejects configurations with duplicate feeds.
+	duplicateFeedsError = "error"
+)
+
+// Config holds the aggregator settings read from conf.yaml.
+type Config struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string `yaml:"addr"`
+	// FeedsManifestURL, when set, is a JSON manifest listing the feeds as
+	// [{"name": ..., "url": ...}], served instead of the feeds setting.
+	FeedsManifestURL string `yaml:"feeds_manifest_url"`
+	// FeedsManifestRefreshSeconds is how often the feeds manifest is reloaded;
+	// 0 loads it only at startup.
+	FeedsManifestRefreshSeconds int `yaml:"feeds_manifest_refresh_seconds"`
+	// Server holds the HTTP server's connection timeouts.
+	Server ServerConfig `yaml:"server"`
+	// RequestIDHeader is the header carrying the request ID; incoming values
+	// are honored and missing ones generated.
+	RequestIDHeader string `yaml:"request_id_header"`
+	// NoIndex serves a disallow-all /robots.txt and marks every response with
+	// X-Robots-Tag: noindex, keeping feed URLs out of search engines.
+	NoIndex bool `yaml:"noindex"`
+	// Preview serves POST /preview, which runs posted events through the
+	// configured passes without fetching anything.
+	Preview bool `yaml:"preview"`
+	// ConfigToken is the bearer token GET /config requires; "" disables the
+	// endpoint.
+	ConfigToken string `yaml:"config_token"`
+	// Compression enables gzip responses for clients sending Accept-Encoding: gzip.
+	Compression bool `yaml:"compression"`
+	// Limit caps the requests served at once.
+	Limit LimitConfig `yaml:"limit"`
+	// MaxFeedsPerRequest caps how many feeds a ?feed selection may name;
+	// requests over it get a 400, and larger collections fail to load. 0 is
+	// unlimited.
+	MaxFeedsPerRequest int `yaml:"max_feeds_per_request"`
+	// FreeBusy controls the /freebusy summary.
+	FreeBusy FreeBusyConfig `yaml:"freebusy"`
+	// Proxy controls the /transform proxy.
+	Proxy ProxyConfig `yaml:"proxy"`
+	// ProdIDBase is the PRODID of the combined calendar, to which the build
+	// version is added, e.g. "-//appliedmedia//Calendar Feed Aggregator 1.4.0//EN".
+	ProdIDBase string `yaml:"prodid_base"`
+	// ContentType is the Content-Type of the calendar responses, for clients
+	// insisting on e.g. "text/plain; charset=utf-8".
+	ContentType string `yaml:"content_type"`
+	// Method is the iTIP METHOD of the combined calendar, "PUBLISH" by default
+	// so clients don't treat it as an invitation; empty omits it. The METHOD of
+	// source calendars is never carried over.
+	Method string `yaml:"method"`
+	// HTTPTimeoutSeconds bounds each feed fetch unless the feed sets its own timeout.
+	HTTPTimeoutSeconds float64 `yaml:"http_timeout_seconds"`
+	// FeedDeadlineSeconds bounds loading each feed for a request, retries
+	// included; feeds missing it are left out of the response, which names them
+	// in X-Timed-Out-Feeds. 0 sets no deadline.
+	FeedDeadlineSeconds float64 `yaml:"feed_deadline_seconds"`
+	// SkipFeedsOverBytes leaves feeds larger than this many bytes out of
+	// responses, which name them in X-Skipped-Feeds, rather than reading them
+	// whole. 0 skips none.
+	SkipFeedsOverBytes int64 `yaml:"skip_feeds_over_bytes"`
+	// Retry controls how failed feed fetches are retried.
+	Retry RetryConfig `yaml:"retry"`
+	// Cache controls how long fetched feeds are reused.
+	Cache CacheConfig `yaml:"cache"`
+	// Refresh controls the background refresher.
+	Refresh RefreshConfig `yaml:"refresh"`
+	// Webhooks are notified when the refresher finds a feed's events changed.
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// Snapshot controls the on-disk snapshot written by the refresher.
+	Snapshot SnapshotConfig `yaml:"snapshot"`
+	// Dedup controls the collapsing of the same event served by several feeds.
+	Dedup DedupConfig `yaml:"dedup"`
+	// Sort controls how sorted aggregates are ordered.
+	Sort SortConfig `yaml:"sort"`
+	// Parse controls the concurrent parse of large feeds.
+	Parse ParseConfig `yaml:"parse"`
+	// AllowedProperties, when set, is the only event and calendar properties
+	// served; the ones RFC 5545 requires are always kept.
+	AllowedProperties []string `yaml:"allowed_properties"`
+	// MaxOutputBytes caps the serialized size of aggregated calendars by
+	// dropping their furthest-future events; 0 is unlimited.
+	MaxOutputBytes int `yaml:"max_output_bytes"`
+	// MaxEventsPerDay caps the events served for each start date, keeping the
+	// first ones in the requested sort order, or by DTSTART; 0 is unlimited.
+	MaxEventsPerDay int `yaml:"max_events_per_day"`
+	// CalScale is the policy for feeds declaring a CALSCALE other than
+	// GREGORIAN: "reject" to skip them, or "ignore" to combine them anyway.
+	CalScale string `yaml:"calscale"`
+	// EnforceVersion skips feeds declaring a VERSION other than 2.0; without
+	// it they are upgraded to 2.0 and combined.
+	EnforceVersion bool `yaml:"enforce_version"`
+	// WeekdayTimezone is the IANA time zone ?weekday judges UTC and zoned
+	// start times in; "" is UTC.
+	WeekdayTimezone string `yaml:"weekday_timezone"`
+	// Only, when set, keeps just the events whose SUMMARY matches one of these
+	// names, ignoring case; ?only replaces the list for a request.
+	Only []string `yaml:"only"`
+	// OnlyMatch is how only names are compared with a SUMMARY: "exact" for
+	// the whole of it, or "substring" for any part of it.
+	OnlyMatch string `yaml:"only_match"`
+	// Strict fails a whole aggregation request with a 502 when any feed can't
+	// be loaded, lacks a property RFC 5545 requires, or has another validation
+	// error such as a cut-off event, instead of skipping the problem and
+	// serving the rest. Advisory warnings don't fail it.
+	Strict bool `yaml:"strict"`
+	// RecurrenceOverrides is the policy for events overriding one instance of
+	// a series with a RECURRENCE-ID: "attach" or "drop".
+	RecurrenceOverrides string `yaml:"recurrence_overrides"`
+	// InvertedDates is the policy for events whose DTEND precedes DTSTART:
+	// "swap", "drop_end", "exclude", or "keep".
+	InvertedDates string `yaml:"inverted_dates"`
+	// MissingSummary is the policy for events without a SUMMARY: "keep",
+	// "drop", or "default" to assign DefaultSummary.
+	MissingSummary string `yaml:"missing_summary"`
+	// DefaultSummary is the SUMMARY given to untitled events under the "default" policy.
+	DefaultSummary string `yaml:"default_summary"`
+	// Priority is the policy for PRIORITY: "keep", "strip", or "clamp" to
+	// PriorityFloor.
+	Priority string `yaml:"priority"`
+	// PriorityFloor is the most urgent PRIORITY kept under the "clamp" policy.
+	PriorityFloor int `yaml:"priority_floor"`
+	// Class is the CLASS given to events without one, "PUBLIC" by default;
+	// empty leaves CLASS alone.
+	Class string `yaml:"class"`
+	// ClassOverride applies Class to every event, replacing source values.
+	ClassOverride bool `yaml:"class_override"`
+	// TitleTemplate is a Go template rewriting every SUMMARY, with the fields
+	// Source, Country, Summary, Year, and Date; "" keeps summaries as they are.
+	TitleTemplate string `yaml:"title_template"`
+	// MarkFree marks every event as free time, setting TRANSP:TRANSPARENT and
+	// X-MICROSOFT-CDO-BUSYSTATUS:FREE so holidays don't block calendars.
+	MarkFree bool `yaml:"mark_free"`
+	// DeriveCategories adds each feed's country, region, and categories to the
+	// CATEGORIES of its events, keeping the ones they already list.
+	DeriveCategories bool `yaml:"derive_categories"`
+	// MidnightAllDay turns events starting at midnight UTC and lasting whole
+	// days into all-day events, for feeds that emit holidays as timed events.
+	MidnightAllDay bool `yaml:"midnight_all_day"`
+	// StreamOrder is the order feeds are streamed in: "completion" as they
+	// finish loading, or "config" in their configured order.
+	StreamOrder string `yaml:"stream_order"`
+	// EventBuffer is the number of serialized events feeds may queue ahead of
+	// the streaming writer.
+	EventBuffer int `yaml:"event_buffer"`
+	// TrackSequence raises an event's SEQUENCE whenever its content changes
+	// between loads, so clients treat it as an update of the same UID.
+	TrackSequence bool `yaml:"track_sequence"`
+	// Transforms lists the per-event transforms applied to every feed, in order.
+	Transforms []TransformConfig `yaml:"transforms"`
+	// UppercaseTokens lists words written in capitals wherever they appear in a
+	// SUMMARY, e.g. "uk" for "UK bank holiday", after every other rewrite.
+	UppercaseTokens []string `yaml:"uppercase_tokens"`
+	// DropBlankLines removes empty lines from assembled calendars, which RFC
+	// 5545 doesn't allow between content lines.
+	DropBlankLines bool `yaml:"drop_blank_lines"`
+	// FoldOctets is the width, in UTF-8 octets, at which output lines are folded;
+	// RFC 5545 allows at most 75.
+	FoldOctets int `yaml:"fold_octets"`
+	// WarnLineOctets logs the output content lines longer than this before
+	// folding, e.g. 75 to catch transforms producing overlong lines, once per
+	// property and response; 0 disables the check.
+	WarnLineOctets int `yaml:"warn_line_octets"`
+	// IndexEvent adds a synthetic event on today's date, ahead of the feeds'
+	// events, listing the number of events contributed by each feed. The
+	// counts need every feed loaded, so the response is no longer streamed.
+	IndexEvent bool `yaml:"index_event"`
+	// EmptyFeedPlaceholder stands an all-day "No holidays from <feed>" event on
+	// today's date in for each feed that loads without events.
+	EmptyFeedPlaceholder bool `yaml:"empty_feed_placeholder"`
+	// DuplicateFeeds is the policy for feeds fetched the same way as an earlier
+	// one: "warn" logs and drops them, "error" rejects the configuration.
+	DuplicateFeeds string `yaml:"duplicate_feeds"`
+	// Feeds lists the calendar feeds combined by the aggregation endpoints.
+	Feeds []FeedConfig `yaml:"feeds"`
+	// Collections maps collection names to the names of their member feeds,
+	// each collection served at /collection/<name>.
+	Collections map[string][]string `yaml:"collections"`
+}
+
+// ServerConfig holds the HTTP server's connection timeouts, which keep slow
+// clients from holding connections open; 0 disables a timeout.
+type ServerConfig struct {
+	// ReadTimeoutSeconds bounds reading a whole request, headers included.
+	ReadTimeoutSeconds int `yaml:"read_timeout_seconds"`
+	// WriteTimeoutSeconds bounds the time from reading a request's headers to
+	// writing the last of its response.
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"`
+	// IdleTimeoutSeconds is how long a keep-alive connection waits for its next request.
+	IdleTimeoutSeconds int `yaml:"idle_timeout_seconds"`
+	// ExemptStreams lifts the write timeout from /aggregate/stream, whose
+	// responses last as long as feeds keep loading.
+	ExemptStreams bool `yaml:"exempt_streams"`
+}
+
+// RetryConfig holds the feed fetch retry settings.
+type RetryConfig struct {
+	// MaxRetries is the number of times a failed fetch of a feed is retried; 0 disables retries.
+	MaxRetries int `yaml:"max_retries"`
+	// Budget is the total number of retries across every feed of one request
+	// or refresh, bounding how long failing feeds can hold it up.
+	Budget int `yaml:"budget"`
+	// BackoffMS is the pause before each retry, in milliseconds.
+	BackoffMS int `yaml:"backoff_ms"`
+}
+
+// CacheConfig holds the feed cache settings.
+type CacheConfig struct {
+	// TTLSeconds is how long a fetched feed is served from the cache; 0 disables caching.
+	TTLSeconds int `yaml:"ttl_seconds"`
+	// WarnAgeSeconds is the age past which serving a feed's data logs a
+	// warning; 0 disables the warning.
+	WarnAgeSeconds int `yaml:"warn_age_seconds"`
+	// PersistPath is the file the cache is saved to after every background
+	// refresh and loaded from at startup; "" keeps the cache in memory only.
+	PersistPath string `yaml:"persist_path"`
+	// MinRefreshSeconds is the minimum time between fetches of a feed, unless
+	// the feed sets its own; fetches forced sooner by ?nocache or the refresher
+	// wait for the one in progress or reuse the latest body. 0 disables it.
+	MinRefreshSeconds float64 `yaml:"min_refresh_seconds"`
+}
+
+// LimitConfig holds the settings of the in-flight request limit.
+type LimitConfig struct {
+	// MaxInFlight is the number of requests served at once; 0 is unlimited.
+	MaxInFlight int `yaml:"max_in_flight"`
+	// RetryAfterSeconds is the Retry-After sent with requests over the limit.
+	RetryAfterSeconds int `yaml:"retry_after_seconds"`
+}
+
+// FreeBusyConfig holds the settings of the /freebusy summary.
+type FreeBusyConfig struct {
+	// FBType is the FBTYPE events are marked as: "BUSY", "FREE",
+	// "BUSY-UNAVAILABLE", or "BUSY-TENTATIVE".
+	FBType string `yaml:"fbtype"`
+}
+
+// ProxyConfig holds the settings of the /transform proxy.
+type ProxyConfig struct {
+	// AllowedHosts lists the hosts the proxy may fetch, exactly or as
+	// "*.example.com"; empty refuses every URL.
+	AllowedHosts []string `yaml:"allowed_hosts"`
+	// MaxBytes is the largest feed the proxy reads; larger ones are answered
+	// with a 502 rather than buffered whole.
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+// WebhookConfig describes an endpoint notified of feed changes.
+type WebhookConfig struct {
+	// URL receives a JSON POST describing each change.
+	URL string `yaml:"url"`
+}
+
+// RefreshConfig holds the background refresher settings.
+type RefreshConfig struct {
+	// IntervalSeconds is the time between refreshes; 0 disables the refresher.
+	IntervalSeconds int `yaml:"interval_seconds"`
+}
+
+// SnapshotConfig holds the snapshot settings.
+type SnapshotConfig struct {
+	// Path is the .ics file rewritten after each refresh; empty disables snapshots.
+	Path string `yaml:"path"`
+	// History is the number of good versions of each feed kept in memory, by
+	// content hash, for ?pin; 0 disables the history.
+	History int `yaml:"history"`
+}
+
+// DedupConfig holds the settings for collapsing duplicate events.
+type DedupConfig struct {
+	// Enabled collapses events sharing a dedup key into the first one.
+	Enabled bool `yaml:"enabled"`
+	// Key is the strategy identifying the same event: "uid", "summary_date",
+	// or "summary_date_location".
+	Key string `yaml:"key"`
+	// DateToleranceDays lets the dated keys match start dates up to this many
+	// days apart, for feeds that disagree on when a holiday is observed.
+	DateToleranceDays int `yaml:"date_tolerance_days"`
+	// Merge combines the distinct DESCRIPTIONs of collapsed events and keeps
+	// the longest SUMMARY.
+	Merge bool `yaml:"merge"`
+	// Separator is placed between combined DESCRIPTIONs.
+	Separator string `yaml:"separator"`
+}
+
+// SortConfig holds the settings for sorting the aggregate.
+type SortConfig struct {
+	// Concurrency is the number of feeds sorted at once before their events are
+	// merged; 1 sorts all events on one goroutine, 0 uses GOMAXPROCS.
+	Concurrency int `yaml:"concurrency"`
+}
+
+// ParseConfig holds the settings for parsing feed bodies.
+type ParseConfig struct {
+	// Concurrency is the number of chunks a large feed is split into at VEVENT
+	// boundaries and parsed at once; 1 parses every feed whole, 0 uses GOMAXPROCS.
+	Concurrency int `yaml:"concurrency"`
+	// MinEvents is the number of events a feed needs before it is split.
+	MinEvents int `yaml:"min_events"`
+	// Sanitize retries a feed that fails to parse once its line endings,
+	// control characters, and broken lines have been cleaned up.
+	Sanitize bool `yaml:"sanitize"`
+}
+
+// TransformConfig describes one step of the transform pipeline.
+type TransformConfig struct {
+	// Type selects the transform: "prefix_summary", "add_categories",
+	// "strip_alarms", "set_transp", "mark_free", "set_tz", or "alt_desc".
+	Type string `yaml:"type"`
+	// Value is the transform's argument, e.g. the prefix or the categories.
+	Value string `yaml:"value"`
+}
+
+// FeedConfig describes a single upstream calendar feed.
+type FeedConfig struct {
+	// Name identifies the feed in logs and responses.
+	Name string `yaml:"name"`
+	// URL is the location of the feed in iCalendar format; file URLs read local
+	// files, gzipped or not.
+	URL string `yaml:"url"`
+	// Enabled includes the feed in aggregation; it defaults to true, and false
+	// keeps a feed configured without fetching it.
+	Enabled *bool `yaml:"enabled"`
+	// Country is the ISO 3166 country code the feed's events belong to.
+	Country string `yaml:"country"`
+	// Region is the region within the country the feed covers, e.g. "Ontario".
+	Region string `yaml:"region"`
+	// Categories are added to the CATEGORIES of the feed's events, along with
+	// its country and region, when derive_categories is on.
+	Categories []string `yaml:"categories"`
+	// TimeoutSeconds overrides the global HTTP timeout for this feed; 0 uses the global one.
+	TimeoutSeconds float64 `yaml:"timeout_seconds"`
+	// DeadlineSeconds overrides the global feed deadline for this feed; 0 uses the global one.
+	DeadlineSeconds float64 `yaml:"deadline_seconds"`
+	// MinRefreshSeconds overrides cache.min_refresh_seconds for this feed; 0 uses the global one.
+	MinRefreshSeconds float64 `yaml:"min_refresh_seconds"`
+	// Color is the CSS3 color name set as the COLOR of the feed's events, e.g. "red".
+	Color string `yaml:"color"`
+	// DateFormat is the Go time layout of the feed's non-standard DTSTART and
+	// DTEND values, e.g. "2006/01/02"; they are normalized before parsing.
+	DateFormat string `yaml:"date_format"`
+	// Method is the HTTP method used to fetch the feed; defaults to GET.
+	Method string `yaml:"method"`
+	// Body is sent as the request body, for providers that expect a POST payload.
+	Body string `yaml:"body"`
+	// Form is sent URL-encoded as the request body, taking precedence over Body.
+	Form map[string]string `yaml:"form"`
+	// ExcludeSummaries removes the feed's events whose SUMMARY matches one of
+	// these patterns, e.g. "Clock change" or "Bank holiday*", ignoring case.
+	ExcludeSummaries []string `yaml:"exclude_summaries"`
+	// AssumeTZ is the IANA time zone of the feed's floating times, stamped on
+	// them as a TZID, e.g. "America/Bogota".
+	AssumeTZ string `yaml:"assume_tz"`
+	// ForceValueType coerces the feed's DTSTART and DTEND to "date" or
+	// "datetime"; "" leaves them as published.
+	ForceValueType string `yaml:"force_value_type"`
+	// Parsing is how forgiving the feed's parse is: "lenient", the default,
+	// skips what it can't use, while "strict" fails the feed on any validation
+	// error; advisory warnings are served either way.
+	Parsing string `yaml:"parsing"`
+	// DownloadFilename is the Content-Disposition filename of responses serving
+	// only this feed; it defaults to the slugified name, e.g. "canada.ics".
+	DownloadFilename string `yaml:"download_filename"`
+}
+
+// enabled reports whether the feed takes part in aggregation.
+func (f FeedConfig) enabled() bool {
+	return f.Enabled == nil || *f.Enabled
+}
+
+// downloadFilename returns the filename responses serving only this feed are
+// downloaded as.
+//
+// Returns:
+// - The configured download_filename, or the slugified name with an .ics extension.
+func (f FeedConfig) downloadFilename() string {
+	if f.DownloadFilename != "" {
+		return f.DownloadFilename
+	}
+	slug := slugify(f.Name)
+	if slug == "" {
+		slug = "feed"
+	}
+	return slug + ".ics"
+}
+
+// request returns the fetcher request described by the feed.
+//
+// Returns:
+// - A fetcher.Request carrying the feed's URL, method, and payload.
+func (f FeedConfig) request() fetcher.Request {
+	return fetcher.Request{
+		URL:    f.URL,
+		Method: f.Method,
+		Body:   f.Body,
+		Form:   f.Form,
+	}
+}
+
+// timeout returns how long a fetch of the feed may take.
+//
+// Parameters:
+// - globalSeconds: The global HTTP timeout in seconds.
+//
+// Returns:
+// - The feed's own timeout if set, otherwise the global one.
+func (f FeedConfig) timeout(globalSeconds float64) time.Duration {
+	seconds := globalSeconds
+	if f.TimeoutSeconds > 0 {
+		seconds = f.TimeoutSeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// deadline returns how long loading the feed may take for a request.
+//
+// Parameters:
+// - globalSeconds: The global feed deadline in seconds.
+//
+// Returns:
+// - The feed's own deadline if set, otherwise the global one; 0 is none.
+func (f FeedConfig) deadline(globalSeconds float64) time.Duration {
+	seconds := globalSeconds
+	if f.DeadlineSeconds > 0 {
+		seconds = f.DeadlineSeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// derivedCategories returns the categories derive_categories adds to the
+// feed's events.
+//
+// Returns:
+// - The feed's country, region, and categories, leaving out unset ones.
+func (f FeedConfig) derivedCategories() []string {
+	var categories []string
+	for _, category := range append([]string{f.Country, f.Region}, f.Categories...) {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// minRefresh returns the minimum time between fetches of the feed.
+//
+// Parameters:
+// - globalSeconds: The global minimum refresh interval in seconds.
+//
+// Returns:
+// - The feed's own interval if set, otherwise the global one; 0 is none.
+func (f FeedConfig) minRefresh(globalSeconds float64) time.Duration {
+	seconds := globalSeconds
+	if f.MinRefreshSeconds > 0 {
+		seconds = f.MinRefreshSeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// envReference matches ${VAR} and ${VAR:-default} references in config values.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the environment variable references in a config value.
+// ${VAR:-default} falls back to default when VAR is unset or empty.
+//
+// Parameters:
+// - value: The value to expand.
+//
+// Returns:
+// - The value with every reference replaced.
+// - An error naming the first variable that is unset and has no default.
+func expandEnv(value string) (string, error) {
+	var missing string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		match := envReference.FindStringSubmatch(ref)
+		if env := os.Getenv(match[1]); env != "" {
+			return env
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		if _, ok := os.LookupEnv(match[1]); !ok && missing == "" {
+			missing = match[1]
+		}
+		return ""
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return expanded, nil
+}
+
+// expandEnvNodes expands the environment variable references in every scalar
+// of a parsed YAML document, leaving keys and comments untouched.
+//
+// Parameters:
+// - node: The document or node to expand in place.
+//
+// Returns:
+// - An error naming the first variable that is unset and has no default.
+func expandEnvNodes(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		return nil
+	}
+	for i, child := range node.Content {
+		// Mapping keys sit at even positions.
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := expandEnvNodes(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultConfig returns the configuration used when no conf.yaml is present.
+//
+// Returns:
+// - A Config serving the Colombian and Canadian holiday feeds on :8080.
+func defaultConfig() *Config {
+	return &Config{
+		Addr:                        ":8080",
+		FeedsManifestRefreshSeconds: 300,
+		Server:                      ServerConfig{ReadTimeoutSeconds: 30, WriteTimeoutSeconds: 120, IdleTimeoutSeconds: 120, ExemptStreams: true},
+		RequestIDHeader:             "X-Request-ID",
+		NoIndex:                     true,
+		Preview:                     true,
+		ProdIDBase:                  "-//appliedmedia//Calendar Feed Aggregator//EN",
+		ContentType:                 "text/calendar; charset=utf-8",
+		Compression:                 true,
+		Method:                      "PUBLISH",
+		Limit:                       LimitConfig{RetryAfterSeconds: 1},
+		FreeBusy:                    FreeBusyConfig{FBType: "BUSY"},
+		Proxy:                       ProxyConfig{MaxBytes: 10 << 20},
+		HTTPTimeoutSeconds:          30,
+		Retry:                       RetryConfig{Budget: 4, BackoffMS: 200},
+		Cache:                       CacheConfig{TTLSeconds: 300},
+		Snapshot:                    SnapshotConfig{History: 5},
+		Dedup:                       DedupConfig{Key: dedupKeySummaryDate, Separator: "\n\n"},
+		Parse:                       ParseConfig{Concurrency: 1, MinEvents: 5000},
+		DropBlankLines:              true,
+		EnforceVersion:              true,
+		CalScale:                    calScaleReject,
+		InvertedDates:               invertedDatesSwap,
+		RecurrenceOverrides:         recurrenceOverridesAttach,
+		MissingSummary:              missingSummaryKeep,
+		DefaultSummary:              "(Untitled)",
+		WeekdayTimezone:             "UTC",
+		OnlyMatch:                   onlyMatchExact,
+		Priority:                    priorityKeep,
+		PriorityFloor:               5,
+		Class:                       string(ics.ClassificationPublic),
+		EventBuffer:                 64,
+		StreamOrder:                 streamOrderCompletion,
+		FoldOctets:                  maxFoldOctets,
+		DuplicateFeeds:              duplicateFeedsWarn,
+		Feeds: []FeedConfig{
+			{Name: "Colombia", URL: ColombianHolidaysURL, Country: "CO"},
+			{Name: "Canada", URL: CanadianHolidaysURL, Country: "CA"},
+		},
+	}
+}
+
+// loadConfig reads the configuration from the given path, falling back to the
+// defaults for any setting the file leaves out. Values may reference
+// environment variables as ${VAR} or ${VAR:-default}.
+//
+// Parameters:
+// - path: The path to the YAML configuration file.
+//
+// Returns:
+// - The loaded Config, or the defaults if the file does not exist.
+// - An error if the file could not be read or parsed.
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := expandEnvNodes(&doc); err != nil {
+		return nil, fmt.Errorf("expanding %s: %w", path, err)
+	}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	// Duplicates are dropped first, so collections can't name a feed that
+	// isn't served.
+	if err := cfg.dedupeFeeds(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// validate checks that the configuration values are usable.
+//
+// Returns:
+// - An error describing the first invalid setting found.
+func (cfg *Config) validate() error {
+	if cfg.RequestIDHeader == "" {
+		return fmt.Errorf("request_id_header must not be empty")
+	}
+	switch cfg.Method {
+	case "", "PUBLISH", "REQUEST", "REPLY", "ADD", "CANCEL", "REFRESH", "COUNTER", "DECLINECOUNTER":
+	default:
+		return fmt.Errorf("unknown method %q", cfg.Method)
+	}
+	if cfg.HTTPTimeoutSeconds <= 0 {
+		return fmt.Errorf("http_timeout_seconds must be positive")
+	}
+	if cfg.FeedsManifestURL != "" {
+		if u, err := url.Parse(cfg.FeedsManifestURL); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file") {
+			return fmt.Errorf("feeds_manifest_url %q must be an http, https, or file URL", cfg.FeedsManifestURL)
+		}
+	}
+	if cfg.FeedsManifestRefreshSeconds < 0 {
+		return fmt.Errorf("feeds_manifest_refresh_seconds must not be negative")
+	}
+	for _, feed := range cfg.Feeds {
+		if feed.TimeoutSeconds < 0 {
+			return fmt.Errorf("feed %s: timeout_seconds must not be negative", feed.Name)
+		}
+		if feed.DeadlineSeconds < 0 {
+			return fmt.Errorf("feed %s: deadline_seconds must not be negative", feed.Name)
+		}
+		if feed.MinRefreshSeconds < 0 {
+			return fmt.Errorf("feed %s: min_refresh_seconds must not be negative", feed.Name)
+		}
+		if feed.Color != "" && !isCSSColor(feed.Color) {
+			return fmt.Errorf("feed %s: color %q is not a CSS3 color name", feed.Name, feed.Color)
+		}
+		for _, pattern := range feed.ExcludeSummaries {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("feed %s: exclude_summaries pattern %q: %w", feed.Name, pattern, err)
+			}
+		}
+		if feed.AssumeTZ != "" {
+			if _, err := time.LoadLocation(feed.AssumeTZ); err != nil {
+				return fmt.Errorf("feed %s: assume_tz: %w", feed.Name, err)
+			}
+		}
+		switch feed.ForceValueType {
+		case "", valueTypeDate, valueTypeDateTime:
+		default:
+			return fmt.Errorf("feed %s: force_value_type must be %s or %s", feed.Name, valueTypeDate, valueTypeDateTime)
+		}
+		switch feed.Parsing {
+		case "", parsingLenient, parsingStrict:
+		default:
+			return fmt.Errorf("feed %s: unknown parsing %q", feed.Name, feed.Parsing)
+		}
+	}
+	if strings.TrimSpace(cfg.ProdIDBase) == "" {
+		return fmt.Errorf("prodid_base must not be empty")
+	}
+	if _, _, err := mime.ParseMediaType(cfg.ContentType); err != nil {
+		return fmt.Errorf("content_type %q is not a media type: %v", cfg.ContentType, err)
+	}
+	if cfg.MaxOutputBytes < 0 {
+		return fmt.Errorf("max_output_bytes must not be negative")
+	}
+	if cfg.MaxEventsPerDay < 0 {
+		return fmt.Errorf("max_events_per_day must not be negative")
+	}
+	if cfg.EventBuffer < 0 {
+		return fmt.Errorf("event_buffer must not be negative")
+	}
+	// A continuation line must fit its leading space and a 4-octet character.
+	if cfg.FoldOctets < 5 || cfg.FoldOctets > maxFoldOctets {
+		return fmt.Errorf("fold_octets must be between 5 and %d", maxFoldOctets)
+	}
+	if cfg.WarnLineOctets < 0 {
+		return fmt.Errorf("warn_line_octets must not be negative")
+	}
+	if cfg.Dedup.DateToleranceDays < 0 {
+		return fmt.Errorf("dedup.date_tolerance_days must not be negative")
+	}
+	if _, ok := dedupStrategies[cfg.Dedup.Key]; !ok {
+		return fmt.Errorf("unknown dedup.key %q", cfg.Dedup.Key)
+	}
+	if cfg.Cache.WarnAgeSeconds < 0 {
+		return fmt.Errorf("cache.warn_age_seconds must not be negative")
+	}
+	if cfg.Cache.MinRefreshSeconds < 0 {
+		return fmt.Errorf("cache.min_refresh_seconds must not be negative")
+	}
+	if cfg.Snapshot.History < 0 {
+		return fmt.Errorf("snapshot.history must not be negative")
+	}
+	if cfg.Retry.MaxRetries < 0 || cfg.Retry.Budget < 0 || cfg.Retry.BackoffMS < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	if cfg.Limit.MaxInFlight < 0 {
+		return fmt.Errorf("limit.max_in_flight must not be negative")
+	}
+	if cfg.Limit.RetryAfterSeconds < 0 {
+		return fmt.Errorf("limit.retry_after_seconds must not be negative")
+	}
+	if cfg.MaxFeedsPerRequest < 0 {
+		return fmt.Errorf("max_feeds_per_request must not be negative")
+	}
+	for _, webhook := range cfg.Webhooks {
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook url %q must be an http or https URL", webhook.URL)
+		}
+	}
+	if !freeBusyTypes[cfg.FreeBusy.FBType] {
+		return fmt.Errorf("unknown freebusy.fbtype %q", cfg.FreeBusy.FBType)
+	}
+	if cfg.FeedDeadlineSeconds < 0 {
+		return fmt.Errorf("feed_deadline_seconds must not be negative")
+	}
+	if cfg.SkipFeedsOverBytes < 0 {
+		return fmt.Errorf("skip_feeds_over_bytes must not be negative")
+	}
+	if cfg.Proxy.MaxBytes <= 0 {
+		return fmt.Errorf("proxy.max_bytes must be positive")
+	}
+	if cfg.Server.ReadTimeoutSeconds < 0 || cfg.Server.WriteTimeoutSeconds < 0 || cfg.Server.IdleTimeoutSeconds < 0 {
+		return fmt.Errorf("server timeouts must not be negative")
+	}
+	if cfg.Sort.Concurrency < 0 {
+		return fmt.Errorf("sort.concurrency must not be negative")
+	}
+	if cfg.Parse.Concurrency < 0 {
+		return fmt.Errorf("parse.concurrency must not be negative")
+	}
+	if cfg.Parse.MinEvents < 0 {
+		return fmt.Errorf("parse.min_events must not be negative")
+	}
+	if cfg.Refresh.IntervalSeconds < 0 {
+		return fmt.Errorf("refresh.interval_seconds must not be negative")
+	}
+	switch cfg.CalScale {
+	case calScaleReject, calScaleIgnore:
+	default:
+		return fmt.Errorf("unknown calscale policy %q", cfg.CalScale)
+	}
+	switch cfg.RecurrenceOverrides {
+	case recurrenceOverridesAttach, recurrenceOverridesDrop:
+	default:
+		return fmt.Errorf("unknown recurrence_overrides policy %q", cfg.RecurrenceOverrides)
+	}
+	switch cfg.InvertedDates {
+	case invertedDatesSwap, invertedDatesDropEnd, invertedDatesExclude, invertedDatesKeep:
+	default:
+		return fmt.Errorf("unknown inverted_dates policy %q", cfg.InvertedDates)
+	}
+	switch cfg.MissingSummary {
+	case missingSummaryKeep, missingSummaryDrop, missingSummaryDefault:
+	default:
+		return fmt.Errorf("unknown missing_summary policy %q", cfg.MissingSummary)
+	}
+	switch cfg.OnlyMatch {
+	case onlyMatchExact, onlyMatchSubstring:
+	default:
+		return fmt.Errorf("unknown only_match %q", cfg.OnlyMatch)
+	}
+	if _, err := time.LoadLocation(cfg.WeekdayTimezone); err != nil {
+		return fmt.Errorf("weekday_timezone: %w", err)
+	}
+	switch cfg.Priority {
+	case priorityKeep, priorityStrip, priorityClamp:
+	default:
+		return fmt.Errorf("unknown priority policy %q", cfg.Priority)
+	}
+	if cfg.PriorityFloor < 1 || cfg.PriorityFloor > 9 {
+		return fmt.Errorf("priority_floor must be between 1 and 9")
+	}
+	switch ics.Classification(cfg.Class) {
+	case "", ics.ClassificationPublic, ics.ClassificationPrivate, ics.ClassificationConfidential:
+	default:
+		return fmt.Errorf("unknown class %q", cfg.Class)
+	}
+	if _, err := parseTitleTemplate(cfg.TitleTemplate); err != nil {
+		return fmt.Errorf("title_template: %w", err)
+	}
+	for _, token := range cfg.UppercaseTokens {
+		if strings.TrimSpace(token) == "" {
+			return fmt.Errorf("uppercase_tokens must not contain empty words")
+		}
+	}
+	if _, err := newPipeline(cfg.Transforms); err != nil {
+		return err
+	}
+	switch cfg.StreamOrder {
+	case streamOrderCompletion, streamOrderConfig:
+	default:
+		return fmt.Errorf("unknown stream_order %q", cfg.StreamOrder)
+	}
+	switch cfg.DuplicateFeeds {
+	case duplicateFeedsWarn, duplicateFeedsError:
+	default:
+		return fmt.Errorf("unknown duplicate_feeds policy %q", cfg.DuplicateFeeds)
+	}
+	names := map[string]bool{}
+	for _, feed := range cfg.Feeds {
+		names[strings.ToLower(feed.Name)] = true
+	}
+	for collection, members := range cfg.Collections {
+		if len(members) == 0 {
+			return fmt.Errorf("collection %q has no feeds", collection)
+		}
+		distinct := map[string]bool{}
+		for _, member := range members {
+			if !names[strings.ToLower(member)] {
+				return fmt.Errorf("collection %q names unknown feed %q", collection, member)
+			}
+			distinct[strings.ToLower(member)] = true
+		}
+		if cfg.MaxFeedsPerRequest > 0 && len(distinct) > cfg.MaxFeedsPerRequest {
+			return fmt.Errorf("collection %q names more than max_feeds_per_request of %d feeds", collection, cfg.MaxFeedsPerRequest)
+		}
+	}
+	if _, err := newSlugRoutes(cfg); err != nil {
+		return err
+	}
+	return nil
+}
+
+// dedupeFeeds finds feeds requesting the same URL with the same method and
+// payload as an earlier feed, which would otherwise be fetched and combined
+// twice, and applies the duplicate_feeds policy to them.
+//
+// Returns:
+// - An error naming the first duplicate under the "error" policy.
+func (cfg *Config) dedupeFeeds() error {
+	seen := map[string]string{}
+	var feeds []FeedConfig
+	for _, feed := range cfg.Feeds {
+		// Disabled feeds are never fetched, so they can't duplicate anything.
+		if !feed.enabled() {
+			feeds = append(feeds, feed)
+			continue
+		}
+		key := feed.request().Key()
+		first, dup := seen[key]
+		if !dup {
+			seen[key] = feed.Name
+			feeds = append(feeds, feed)
+			continue
+		}
+		if cfg.DuplicateFeeds == duplicateFeedsError {
+			return fmt.Errorf("feed %s duplicates feed %s (%s)", feed.Name, first, feed.URL)
+		}
+		log.Printf("Ignoring feed %s: it duplicates feed %s (%s)", feed.Name, first, feed.URL)
+	}
+	cfg.Feeds = feeds
+	return nil
+}
+
+// End, config.go
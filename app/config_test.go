@@ -0,0 +1,115 @@
+// config_test.go
+// This file contains tests for loading the configuration.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a conf.yaml with the given contents and returns its path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "conf.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+	return path
+}
+
+// TestLoadConfigEnvInterpolation tests that values reference environment variables.
+func TestLoadConfigEnvInterpolation(t *testing.T) {
+	t.Setenv("FEED_TOKEN", "s3cret")
+	cfg, err := loadConfig(writeConfig(t, `
+# ${NOT_EXPANDED} in a comment is left alone.
+request_id_header: ${REQUEST_HEADER:-X-Correlation-ID}
+feeds:
+  - name: Private
+    url: https://example.com/feed.ics?token=${FEED_TOKEN}
+`))
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	if cfg.Feeds[0].URL != "https://example.com/feed.ics?token=s3cret" {
+		t.Errorf("Expected the token to be interpolated, got %s", cfg.Feeds[0].URL)
+	}
+	if cfg.RequestIDHeader != "X-Correlation-ID" {
+		t.Errorf("Expected the default header X-Correlation-ID, got %s", cfg.RequestIDHeader)
+	}
+}
+
+// TestLoadConfigEnvMissing tests that an unset variable without a default is an error.
+func TestLoadConfigEnvMissing(t *testing.T) {
+	os.Unsetenv("MISSING_FEED_TOKEN")
+	_, err := loadConfig(writeConfig(t, `
+feeds:
+  - name: Private
+    url: https://example.com/feed.ics?token=${MISSING_FEED_TOKEN}
+`))
+	if err == nil || !strings.Contains(err.Error(), "MISSING_FEED_TOKEN") {
+		t.Errorf("Expected an error naming MISSING_FEED_TOKEN, got %v", err)
+	}
+}
+
+// TestLoadConfigDuplicateFeeds tests that a repeated URL is dropped under the
+// warn policy and rejected under the error policy.
+func TestLoadConfigDuplicateFeeds(t *testing.T) {
+	const feeds = `
+feeds:
+  - name: Canada
+    url: https://example.com/ca.ics
+  - name: Colombia
+    url: https://example.com/co.ics
+  - name: Canada again
+    url: https://example.com/ca.ics
+`
+	cfg, err := loadConfig(writeConfig(t, "duplicate_feeds: warn\n"+feeds))
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if len(cfg.Feeds) != 2 || cfg.Feeds[0].Name != "Canada" || cfg.Feeds[1].Name != "Colombia" {
+		t.Errorf("Expected the duplicate to be dropped, got %+v", cfg.Feeds)
+	}
+
+	_, err = loadConfig(writeConfig(t, "duplicate_feeds: error\n"+feeds))
+	if err == nil || !strings.Contains(err.Error(), "Canada again") {
+		t.Errorf("Expected an error naming the duplicate feed, got %v", err)
+	}
+}
+
+// TestLoadConfigCollections tests that collections must name configured feeds.
+func TestLoadConfigCollections(t *testing.T) {
+	const feeds = `
+feeds:
+  - name: Canada
+    url: https://example.com/ca.ics
+`
+	if _, err := loadConfig(writeConfig(t, "collections:\n  north-america: [Canada]\n"+feeds)); err != nil {
+		t.Errorf("Expected a collection of configured feeds to load, got %v", err)
+	}
+
+	_, err := loadConfig(writeConfig(t, "collections:\n  north-america: [Canada, Mexico]\n"+feeds))
+	if err == nil || !strings.Contains(err.Error(), "Mexico") {
+		t.Errorf("Expected an error naming the unknown feed, got %v", err)
+	}
+
+	// A duplicate feed is dropped, so a collection can't name it.
+	_, err = loadConfig(writeConfig(t, "collections:\n  north-america: [Canada, Kanada]\n"+feeds+"  - name: Kanada\n    url: https://example.com/ca.ics\n"))
+	if err == nil || !strings.Contains(err.Error(), "Kanada") {
+		t.Errorf("Expected an error naming the dropped duplicate, got %v", err)
+	}
+
+	// A collection can't hold more feeds than a request may name.
+	_, err = loadConfig(writeConfig(t, "max_feeds_per_request: 1\ncollections:\n  north-america: [Canada, Mexico]\n"+feeds+"  - name: Mexico\n    url: https://example.com/mx.ics\n"))
+	if err == nil || !strings.Contains(err.Error(), "max_feeds_per_request") {
+		t.Errorf("Expected an error naming max_feeds_per_request, got %v", err)
+	}
+	if _, err := loadConfig(writeConfig(t, "max_feeds_per_request: 1\ncollections:\n  north-america: [Canada, canada]\n"+feeds)); err != nil {
+		t.Errorf("Expected a collection repeating one feed to load, got %v", err)
+	}
+}
+
+// End, config_test.go
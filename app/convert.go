@@ -0,0 +1,101 @@
+// convert.go
+// This file contains the conversion of events into other component types.
+package main
+
+import (
+	ics "github.com/arran4/golang-ical"
+)
+
+const (
+	// asVTodo outputs every event as a VTODO.
+	asVTodo = "vtodo"
+	// asVJournal outputs every event as a VJOURNAL.
+	asVJournal = "vjournal"
+)
+
+// todoOmittedProperties lists the VEVENT properties with no VTODO equivalent.
+// DURATION is dropped because a VTODO may not carry both DUE and DURATION.
+var todoOmittedProperties = map[ics.ComponentProperty]bool{
+	ics.ComponentPropertyDtEnd:  true,
+	"DURATION":                  true,
+	ics.ComponentPropertyTransp: true,
+	propertyBusyStatus:          true,
+}
+
+// todoFromEvent converts an event into a to-do due when the event starts,
+// keeping its SUMMARY and other properties.
+//
+// Parameters:
+// - event: The event to convert.
+//
+// Returns:
+// - A VTODO whose DUE carries the event's DTSTART value and parameters.
+func todoFromEvent(event *ics.VEvent) *ics.VTodo {
+	todo := &ics.VTodo{}
+	todo.Components = event.Components
+	for _, prop := range event.Properties {
+		if todoOmittedProperties[ics.ComponentProperty(prop.IANAToken)] {
+			continue
+		}
+		if prop.IANAToken == string(ics.ComponentPropertyDtStart) {
+			prop.IANAToken = string(ics.ComponentPropertyDue)
+		}
+		todo.Properties = append(todo.Properties, prop)
+	}
+	return todo
+}
+
+// journalOmittedProperties lists the VEVENT properties RFC 5545 doesn't allow
+// in a VJOURNAL, which records a moment rather than occupying time.
+var journalOmittedProperties = map[ics.ComponentProperty]bool{
+	ics.ComponentPropertyDtEnd:     true,
+	"DURATION":                     true,
+	ics.ComponentPropertyTransp:    true,
+	propertyBusyStatus:             true,
+	ics.ComponentPropertyLocation:  true,
+	ics.ComponentPropertyGeo:       true,
+	ics.ComponentPropertyPriority:  true,
+	ics.ComponentPropertyResources: true,
+}
+
+// journalFromEvent converts an event into a journal entry dated when the event
+// starts, keeping its SUMMARY, DESCRIPTION, and other allowed properties.
+// Alarms are dropped, as a VJOURNAL can't carry them.
+//
+// Parameters:
+// - event: The event to convert.
+//
+// Returns:
+// - A VJOURNAL with the event's DTSTART.
+func journalFromEvent(event *ics.VEvent) *ics.VJournal {
+	journal := &ics.VJournal{}
+	for _, prop := range event.Properties {
+		if !journalOmittedProperties[ics.ComponentProperty(prop.IANAToken)] {
+			journal.Properties = append(journal.Properties, prop)
+		}
+	}
+	return journal
+}
+
+// serializeEvent serializes an event as the requested component type, folded
+// at the given octet width.
+//
+// Parameters:
+// - event: The event to serialize.
+// - as: The component type to output; "" keeps the VEVENT.
+// - octets: The maximum octets per physical line.
+// - warn: The check of overlong lines, as for foldContent; nil disables it.
+//
+// Returns:
+// - The serialized component.
+func serializeEvent(event *ics.VEvent, as string, octets int, warn *lineWarner) string {
+	switch as {
+	case asVTodo:
+		return foldContent(todoFromEvent(event).Serialize(), octets, warn)
+	case asVJournal:
+		return foldContent(journalFromEvent(event).Serialize(), octets, warn)
+	}
+	return foldContent(event.Serialize(), octets, warn)
+}
+
+// End, convert.go
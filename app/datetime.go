@@ -0,0 +1,147 @@
+// datetime.go
+// This file contains the tolerant parsing of event times for sorting and filtering.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// tolerantDateTime matches the DATE-TIME variants some feeds emit beyond RFC
+// 5545: fractional seconds, and numeric offsets such as +0530, +05:30, or +05
+// in place of a TZID.
+var tolerantDateTime = regexp.MustCompile(`^(\d{8}T\d{6})(?:[.,]\d+)?(Z|([+-])(\d{2}):?(\d{2})?)?$`)
+
+// floatingValue matches the DATE and DATE-TIME values tied to no zone.
+var floatingValue = regexp.MustCompile(`^\d{8}(T\d{6}([.,]\d+)?)?$`)
+
+// parseDateTime parses a date property with tolerantDateTime. Values without an
+// offset are read in their TZID, or in the local zone when floating.
+//
+// Parameters:
+// - prop: The property to parse.
+//
+// Returns:
+// - The time, normalized to its zone.
+// - An error if the value isn't a recognized DATE-TIME.
+func parseDateTime(prop *ics.IANAProperty) (time.Time, error) {
+	if prop == nil {
+		return time.Time{}, fmt.Errorf("property not found")
+	}
+	matched := tolerantDateTime.FindStringSubmatch(prop.Value)
+	if matched == nil {
+		return time.Time{}, fmt.Errorf("unrecognized DATE-TIME %q", prop.Value)
+	}
+
+	loc := time.Local
+	switch {
+	case matched[2] == "Z":
+		loc = time.UTC
+	case matched[2] != "":
+		hours, _ := strconv.Atoi(matched[4])
+		minutes, _ := strconv.Atoi(matched[5])
+		offset := (hours*60 + minutes) * 60
+		if matched[3] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	default:
+		if tzid := prop.ICalParameters[string(ics.ParameterTzid)]; len(tzid) == 1 {
+			zone, err := time.LoadLocation(tzid[0])
+			if err != nil {
+				return time.Time{}, err
+			}
+			loc = zone
+		}
+	}
+	return time.ParseInLocation(floatingLayout, matched[1], loc)
+}
+
+// eventStart returns an event's DTSTART, falling back to parseDateTime for
+// values golang-ical rejects.
+//
+// Parameters:
+// - event: The event to inspect.
+//
+// Returns:
+// - The start time.
+// - An error if DTSTART is missing or unparsable.
+func eventStart(event *ics.VEvent) (time.Time, error) {
+	if start, err := event.GetStartAt(); err == nil {
+		return start, nil
+	}
+	return parseDateTime(event.GetProperty(ics.ComponentPropertyDtStart))
+}
+
+// eventEnd returns an event's DTEND like eventStart.
+//
+// Parameters:
+// - event: The event to inspect.
+//
+// Returns:
+// - The end time.
+// - An error if DTEND is missing or unparsable.
+func eventEnd(event *ics.VEvent) (time.Time, error) {
+	if end, err := event.GetEndAt(); err == nil {
+		return end, nil
+	}
+	return parseDateTime(event.GetProperty(ics.ComponentPropertyDtEnd))
+}
+
+// inFloatingZone reads the wall clock of a floating DATE or DATE-TIME in the
+// given zone, leaving times with a TZID, an offset, or in UTC as they are.
+//
+// Parameters:
+// - t: The time parsed from prop.
+// - prop: The property t was parsed from.
+// - loc: The zone floating times are read in.
+//
+// Returns:
+// - The time in loc if floating, otherwise t.
+func inFloatingZone(t time.Time, prop *ics.IANAProperty, loc *time.Location) time.Time {
+	if prop == nil || len(prop.ICalParameters[string(ics.ParameterTzid)]) > 0 || !floatingValue.MatchString(prop.Value) {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// eventStartIn returns an event's DTSTART like eventStart, with a floating
+// start read in the given zone.
+//
+// Parameters:
+// - event: The event to inspect.
+// - loc: The zone floating times are read in.
+//
+// Returns:
+// - The start time.
+// - An error if DTSTART is missing or unparsable.
+func eventStartIn(event *ics.VEvent, loc *time.Location) (time.Time, error) {
+	start, err := eventStart(event)
+	if err != nil {
+		return start, err
+	}
+	return inFloatingZone(start, event.GetProperty(ics.ComponentPropertyDtStart), loc), nil
+}
+
+// eventEndIn returns an event's DTEND like eventStartIn.
+//
+// Parameters:
+// - event: The event to inspect.
+// - loc: The zone floating times are read in.
+//
+// Returns:
+// - The end time.
+// - An error if DTEND is missing or unparsable.
+func eventEndIn(event *ics.VEvent, loc *time.Location) (time.Time, error) {
+	end, err := eventEnd(event)
+	if err != nil {
+		return end, err
+	}
+	return inFloatingZone(end, event.GetProperty(ics.ComponentPropertyDtEnd), loc), nil
+}
+
+// End, datetime.go
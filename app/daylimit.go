@@ -0,0 +1,39 @@
+// daylimit.go
+// This file contains the cap on the number of events served for each date.
+package main
+
+import ics "github.com/arran4/golang-ical"
+
+// capPerDay keeps at most max events starting on each date: the first ones in
+// the given order, dropping the rest.
+//
+// Parameters:
+// - feedEvents: The events of each feed, in feed order.
+// - ordered: The same events in the order deciding which are kept.
+// - max: The most events kept for a date.
+//
+// Returns:
+// - The kept events of each feed, in their original order.
+func capPerDay(feedEvents [][]*ics.VEvent, ordered []*ics.VEvent, max int) [][]*ics.VEvent {
+	perDay := map[string]int{}
+	kept := map[*ics.VEvent]bool{}
+	for _, event := range ordered {
+		date := eventDate(event)
+		if perDay[date] < max {
+			perDay[date]++
+			kept[event] = true
+		}
+	}
+
+	capped := make([][]*ics.VEvent, len(feedEvents))
+	for i, events := range feedEvents {
+		for _, event := range events {
+			if kept[event] {
+				capped[i] = append(capped[i], event)
+			}
+		}
+	}
+	return capped
+}
+
+// End, daylimit.go
@@ -0,0 +1,49 @@
+// daylimit_test.go
+// This file contains tests for the cap on events per date.
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMaxEventsPerDay tests that only the first max_events_per_day events of
+// a crowded date remain, in either sort order, while other dates are untouched.
+func TestMaxEventsPerDay(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.MaxEventsPerDay = 2
+	cfg.Feeds = cfg.Feeds[1:]
+	cfg.Feeds[0].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\n"+
+		"BEGIN:VEVENT\nUID:fireworks\nSUMMARY:Fireworks\nDTSTART:20230701T220000Z\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nUID:parade\nSUMMARY:Parade\nDTSTART:20230701T100000Z\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nUID:concert\nSUMMARY:Concert\nDTSTART:20230701T180000Z\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nUID:brunch\nSUMMARY:Brunch\nDTSTART:20230701T120000Z\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nUID:cleanup\nSUMMARY:Cleanup\nDTSTART:20230702T090000Z\nEND:VEVENT\n"+
+		"END:VCALENDAR\n").URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?sort=start", []string{"Parade", "Brunch", "Cleanup"}},
+		{"?sort=summary", []string{"Brunch", "Cleanup", "Concert"}},
+		{"", []string{"Parade", "Brunch", "Cleanup"}},
+	}
+	for _, tt := range tests {
+		body := getBody(t, srv.URL+"/aggregate_ics"+tt.query)
+		var got []string
+		for _, line := range strings.Split(body, "\r\n") {
+			if summary, ok := strings.CutPrefix(line, "SUMMARY:"); ok {
+				got = append(got, summary)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: Expected %v, got %v", tt.query, tt.want, got)
+		}
+	}
+}
+
+// End, daylimit_test.go
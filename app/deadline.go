@@ -0,0 +1,85 @@
+// deadline.go
+// This file contains the per-feed load deadlines and the reporting of the
+// feeds that missed them.
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// timedOutHeader names the feeds left out of a response for missing their deadline.
+const timedOutHeader = "X-Timed-Out-Feeds"
+
+// errFeedDeadline marks a feed load abandoned at the feed's deadline.
+var errFeedDeadline = errors.New("missed its deadline")
+
+// deadlinesKey is the context key under which the missed deadlines are stored.
+type deadlinesKey struct{}
+
+// feedNames collects the names of the feeds left out of a response, such as
+// those that missed their deadline, while serving a request.
+type feedNames struct {
+	mu    sync.Mutex
+	feeds []string
+}
+
+// add notes that a feed was left out.
+//
+// Parameters:
+// - feed: The feed left out.
+func (d *feedNames) add(feed FeedConfig) {
+	d.mu.Lock()
+	d.feeds = append(d.feeds, feed.Name)
+	d.mu.Unlock()
+}
+
+// withDeadlines returns a copy of ctx recording missed deadlines into d.
+//
+// Parameters:
+// - ctx: The parent context.
+// - d: The collector receiving the feed names.
+//
+// Returns:
+// - The derived context.
+func withDeadlines(ctx context.Context, d *feedNames) context.Context {
+	return context.WithValue(ctx, deadlinesKey{}, d)
+}
+
+// recordMissedDeadline notes that a feed missed its deadline in the collector
+// carried by ctx, if any.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed that timed out.
+func recordMissedDeadline(ctx context.Context, feed FeedConfig) {
+	if d, ok := ctx.Value(deadlinesKey{}).(*feedNames); ok {
+		d.add(feed)
+	}
+}
+
+// header returns the collected names as a header value, in configured feed order.
+//
+// Parameters:
+// - feeds: The configured feeds.
+//
+// Returns:
+// - The comma-separated names of the feeds left out, or "" if there are none.
+func (d *feedNames) header(feeds []FeedConfig) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var names []string
+	for _, feed := range feeds {
+		for _, name := range d.feeds {
+			if name == feed.Name {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// End, deadline.go
@@ -0,0 +1,67 @@
+// deadline_test.go
+// This file contains tests for the per-feed load deadlines.
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFeedDeadline tests that a feed past its deadline is left out of the
+// aggregate and named in X-Timed-Out-Feeds, as a header when buffering and a
+// trailer when streaming, while the fast feed is served.
+func TestFeedDeadline(t *testing.T) {
+	cfg := newTestConfig(t)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer slow.Close()
+	defer close(release)
+	cfg.Feeds[1].URL = slow.URL
+	cfg.Feeds[1].DeadlineSeconds = 0.1
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	for _, path := range []string{"/aggregate_ics?sort=start", "/aggregate_ics"} {
+		start := time.Now()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: Expected the slow feed to be abandoned at its deadline, took %v", path, elapsed)
+		}
+		if !strings.Contains(string(body), "SUMMARY:Colombian New Year") || strings.Contains(string(body), "Canada") {
+			t.Errorf("%s: Expected only Colombia's events, got:\n%s", path, body)
+		}
+		got := resp.Header.Get(timedOutHeader) + resp.Trailer.Get(timedOutHeader)
+		if got != "Canada" {
+			t.Errorf("%s: Expected %s to name Canada, got %q", path, timedOutHeader, got)
+		}
+	}
+
+	fast := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer fast.Close()
+	resp, err := http.Get(fast.URL + "/aggregate_ics?sort=start")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(timedOutHeader); got != "" {
+		t.Errorf("Expected no %s when every feed loads, got %q", timedOutHeader, got)
+	}
+}
+
+// End, deadline_test.go
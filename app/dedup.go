@@ -0,0 +1,233 @@
+// dedup.go
+// This file contains the keys used to recognize the same event across feeds.
+package main
+
+import (
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// normalizeSummary lowercases a summary and collapses its whitespace, so that
+// cosmetic differences between feeds don't hide a match.
+//
+// Parameters:
+// - summary: The SUMMARY value to normalize.
+//
+// Returns:
+// - The normalized summary.
+func normalizeSummary(summary string) string {
+	return strings.ToLower(strings.Join(strings.Fields(summary), " "))
+}
+
+// eventDate returns the calendar date of an event's DTSTART as YYYYMMDD.
+//
+// Parameters:
+// - event: The event to inspect.
+//
+// Returns:
+// - The date part of DTSTART, or "" if the event has none.
+func eventDate(event *ics.VEvent) string {
+	start := propertyValue(event, ics.ComponentPropertyDtStart)
+	if len(start) < 8 {
+		return start
+	}
+	return start[:8]
+}
+
+const (
+	// dedupKeyUID identifies events by UID alone.
+	dedupKeyUID = "uid"
+	// dedupKeySummaryDate identifies events by normalized SUMMARY and start date.
+	dedupKeySummaryDate = "summary_date"
+	// dedupKeySummaryDateLocation also requires the same normalized LOCATION.
+	dedupKeySummaryDateLocation = "summary_date_location"
+)
+
+// dedupStrategy is how a dedup.key strategy recognizes the same event.
+type dedupStrategy struct {
+	// base identifies an event apart from its start date; "" marks an event
+	// that can't be matched and is never collapsed.
+	base func(*ics.VEvent) string
+	// dated also requires the start dates to be within the date tolerance.
+	dated bool
+}
+
+// dedupStrategies maps each dedup.key strategy to how it matches events.
+var dedupStrategies = map[string]dedupStrategy{
+	dedupKeyUID: {base: func(event *ics.VEvent) string {
+		return event.Id()
+	}},
+	dedupKeySummaryDate: {base: func(event *ics.VEvent) string {
+		return normalizeSummary(propertyValue(event, ics.ComponentPropertySummary))
+	}, dated: true},
+	dedupKeySummaryDateLocation: {base: func(event *ics.VEvent) string {
+		return normalizeSummary(propertyValue(event, ics.ComponentPropertySummary)) + "|" + normalizeSummary(propertyValue(event, ics.ComponentPropertyLocation))
+	}, dated: true},
+}
+
+// dedupStrategyFor returns the strategy of a dedup.key setting.
+//
+// Parameters:
+// - key: The dedup.key setting.
+//
+// Returns:
+// - The strategy, summary_date when key is unset or unknown.
+func dedupStrategyFor(key string) dedupStrategy {
+	if strategy, ok := dedupStrategies[key]; ok {
+		return strategy
+	}
+	return dedupStrategies[dedupKeySummaryDate]
+}
+
+// key identifies an event exactly under the strategy: by its base key and,
+// for the dated strategies, its start date.
+//
+// Parameters:
+// - event: The event to identify.
+//
+// Returns:
+// - The key of the event.
+func (st dedupStrategy) key(event *ics.VEvent) string {
+	if st.dated {
+		return st.base(event) + "|" + eventDate(event)
+	}
+	return st.base(event)
+}
+
+// matches reports whether two events are the same event under the strategy.
+//
+// Parameters:
+// - a: The first event.
+// - b: The second event.
+// - toleranceDays: How many days apart the start dates of the dated strategies may be.
+//
+// Returns:
+// - True if the events match; events without a base key never do.
+func (st dedupStrategy) matches(a, b *ics.VEvent, toleranceDays int) bool {
+	base := st.base(a)
+	if base == "" || base != st.base(b) {
+		return false
+	}
+	if !st.dated {
+		return true
+	}
+	days, ok := daysApart(eventDate(a), eventDate(b))
+	return ok && days <= toleranceDays
+}
+
+// daysApart returns how many days separate two YYYYMMDD dates, as returned by
+// eventDate. Dates that don't parse are only ever 0 days from an equal value.
+//
+// Parameters:
+// - a: The first date.
+// - b: The second date.
+//
+// Returns:
+// - The number of days between the dates.
+// - False if the dates are unequal and can't be compared.
+func daysApart(a, b string) (int, bool) {
+	if a == b {
+		return 0, true
+	}
+	dayA, errA := time.Parse("20060102", a)
+	dayB, errB := time.Parse("20060102", b)
+	if errA != nil || errB != nil {
+		return 0, false
+	}
+	days := int(dayA.Sub(dayB).Hours() / 24)
+	if days < 0 {
+		days = -days
+	}
+	return days, true
+}
+
+// dedupEvents collapses events sharing a dedup key across and within feeds,
+// keeping the first occurrence in feed order, so that earlier feeds take
+// priority. The key is chosen by dedup.key, summary_date when unset, and the
+// dated strategies match start dates up to dedup.date_tolerance_days apart.
+// RECURRENCE-ID overrides are never collapsed on their own: they are kept
+// with their series, or dropped along with it.
+//
+// Parameters:
+// - feedEvents: The events of each feed, in feed order.
+// - cfg: The dedup settings.
+//
+// Returns:
+// - The events of each feed with duplicates removed.
+func dedupEvents(feedEvents [][]*ics.VEvent, cfg DedupConfig) [][]*ics.VEvent {
+	strategy := dedupStrategyFor(cfg.Key)
+	// kept holds the events kept so far under each base key.
+	kept := map[string][]*ics.VEvent{}
+	original := func(event *ics.VEvent, key string) *ics.VEvent {
+		for _, candidate := range kept[key] {
+			if strategy.matches(candidate, event, cfg.DateToleranceDays) {
+				return candidate
+			}
+		}
+		return nil
+	}
+
+	deduped := make([][]*ics.VEvent, len(feedEvents))
+	for i, events := range feedEvents {
+		// collapsed holds the feed's events collapsed into an earlier one, and
+		// collapsedSeries their UIDs, whose RECURRENCE-ID overrides go with them.
+		collapsed := map[*ics.VEvent]bool{}
+		collapsedSeries := map[string]bool{}
+		for _, event := range events {
+			// Overrides share the key of their series and are judged with it below.
+			if recurrenceID(event) != "" {
+				continue
+			}
+			key := strategy.base(event)
+			if key == "" {
+				continue
+			}
+			if first := original(event, key); first != nil {
+				if cfg.Merge {
+					mergeDuplicate(first, event, cfg.Separator)
+				}
+				collapsed[event] = true
+				if uid := event.Id(); uid != "" {
+					collapsedSeries[uid] = true
+				}
+				continue
+			}
+			kept[key] = append(kept[key], event)
+		}
+		for _, event := range events {
+			if collapsed[event] || (recurrenceID(event) != "" && collapsedSeries[event.Id()]) {
+				continue
+			}
+			deduped[i] = append(deduped[i], event)
+		}
+	}
+	return deduped
+}
+
+// mergeDuplicate folds what a collapsed duplicate knows into the kept event:
+// DESCRIPTIONs the kept event lacks are appended, and the longer SUMMARY wins.
+//
+// Parameters:
+// - kept: The event that stays in the aggregate.
+// - dup: The duplicate being collapsed into it.
+// - separator: The text placed between combined descriptions.
+func mergeDuplicate(kept, dup *ics.VEvent, separator string) {
+	summary := strings.TrimSpace(propertyValue(kept, ics.ComponentPropertySummary))
+	if other := strings.TrimSpace(propertyValue(dup, ics.ComponentPropertySummary)); len(other) > len(summary) {
+		kept.SetSummary(other)
+	}
+
+	description := propertyValue(kept, ics.ComponentPropertyDescription)
+	other := strings.TrimSpace(propertyValue(dup, ics.ComponentPropertyDescription))
+	if other == "" || strings.Contains(description, other) {
+		return
+	}
+	if strings.TrimSpace(description) != "" {
+		other = description + separator + other
+	}
+	kept.SetDescription(other)
+}
+
+// End, dedup.go
@@ -0,0 +1,188 @@
+// dedup_test.go
+// This file contains tests for collapsing duplicate events.
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestDedupEventsMerge tests that collapsing near-duplicates keeps both
+// descriptions and the richer summary.
+func TestDedupEventsMerge(t *testing.T) {
+	colombia := parseMockEvent(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:New Year
+DTSTART;VALUE=DATE:20230101
+DESCRIPTION:Public holiday.
+END:VEVENT
+END:VCALENDAR`)
+	canada := parseMockEvent(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:NEW YEAR
+DTSTART;VALUE=DATE:20230101
+DESCRIPTION:Banks are closed.
+END:VEVENT
+END:VCALENDAR`)
+
+	deduped := dedupEvents([][]*ics.VEvent{{colombia}, {canada}}, DedupConfig{Enabled: true, Merge: true, Separator: "\n\n"})
+	if len(deduped[0]) != 1 || len(deduped[1]) != 0 {
+		t.Fatalf("Expected the Canadian duplicate to collapse into the Colombian event")
+	}
+	if got, want := propertyValue(deduped[0][0], ics.ComponentPropertyDescription), "Public holiday.\n\nBanks are closed."; got != want {
+		t.Errorf("Expected merged description %q, got %q", want, got)
+	}
+	if got := propertyValue(deduped[0][0], ics.ComponentPropertySummary); got != "New Year" {
+		t.Errorf("Expected the first summary to win a tie, got %q", got)
+	}
+
+	// Merging the same description again doesn't repeat it, and a longer summary wins.
+	duplicate := parseMockEvent(t, mockCanadianCalendar)
+	duplicate.SetSummary("New Year's Day")
+	duplicate.SetDescription("Banks are closed.")
+	mergeDuplicate(deduped[0][0], duplicate, "\n\n")
+	if got, want := propertyValue(deduped[0][0], ics.ComponentPropertyDescription), "Public holiday.\n\nBanks are closed."; got != want {
+		t.Errorf("Expected description %q, got %q", want, got)
+	}
+	if got := propertyValue(deduped[0][0], ics.ComponentPropertySummary); got != "New Year's Day" {
+		t.Errorf("Expected the longer summary to win, got %q", got)
+	}
+}
+
+// TestDedupEventsWithoutMerge tests that duplicates are dropped untouched by default.
+func TestDedupEventsWithoutMerge(t *testing.T) {
+	first := parseMockEvent(t, mockCanadianCalendar)
+	second := parseMockEvent(t, mockCanadianCalendar)
+	second.SetDescription("Extra")
+
+	deduped := dedupEvents([][]*ics.VEvent{{first}, {second}}, DedupConfig{Enabled: true})
+	if len(deduped[1]) != 0 {
+		t.Fatalf("Expected the duplicate to be dropped")
+	}
+	if got := propertyValue(deduped[0][0], ics.ComponentPropertyDescription); got != "" {
+		t.Errorf("Expected no merged description, got %q", got)
+	}
+}
+
+// TestDedupEventsKeyStrategies tests that each dedup.key strategy collapses a
+// different subset of the same events.
+func TestDedupEventsKeyStrategies(t *testing.T) {
+	feeds := [][]string{
+		{"A|New Year|20230101|Bogotá", "B|Labour Day|20230501|"},
+		{"A|New Year's Day|20230101|Bogotá", "C|new year|20230101|bogotá", "D|New Year|20230101|Ottawa", "|Labour Day|20230501|"},
+	}
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		// A collapses; events without a UID are never collapsed.
+		{key: dedupKeyUID, want: 5},
+		// C and D collapse into the first New Year, the UID-less Labour Day into B.
+		{key: dedupKeySummaryDate, want: 3},
+		// Only C shares the first New Year's location; D is in Ottawa.
+		{key: dedupKeySummaryDateLocation, want: 4},
+	}
+	for _, tt := range tests {
+		feedEvents := make([][]*ics.VEvent, len(feeds))
+		for i, specs := range feeds {
+			for _, spec := range specs {
+				parts := strings.Split(spec, "|")
+				event := ics.NewEvent(parts[0])
+				if parts[0] == "" {
+					removeProperty(event, ics.ComponentPropertyUniqueId)
+				}
+				event.SetSummary(parts[1])
+				event.SetProperty(ics.ComponentPropertyDtStart, parts[2], ics.WithValue("DATE"))
+				if parts[3] != "" {
+					event.SetLocation(parts[3])
+				}
+				feedEvents[i] = append(feedEvents[i], event)
+			}
+		}
+
+		got := 0
+		for _, events := range dedupEvents(feedEvents, DedupConfig{Enabled: true, Key: tt.key}) {
+			got += len(events)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %d events after dedup, got %d", tt.key, tt.want, got)
+		}
+	}
+}
+
+// TestDedupEventsDateTolerance tests that same-summary events a day apart only
+// collapse, into the first feed's event, under a tolerance of at least a day.
+func TestDedupEventsDateTolerance(t *testing.T) {
+	newFeeds := func() [][]*ics.VEvent {
+		feeds := [][]*ics.VEvent{}
+		for _, date := range []string{"20230703", "20230704", "20230706"} {
+			event := ics.NewEvent("independence-" + date)
+			event.SetSummary("Independence Day")
+			event.SetProperty(ics.ComponentPropertyDtStart, date, ics.WithValue("DATE"))
+			feeds = append(feeds, []*ics.VEvent{event})
+		}
+		return feeds
+	}
+
+	tests := []struct {
+		tolerance int
+		want      string
+	}{
+		{tolerance: 0, want: "independence-20230703, independence-20230704, independence-20230706"},
+		{tolerance: 1, want: "independence-20230703, independence-20230706"},
+		{tolerance: 3, want: "independence-20230703"},
+	}
+	for _, tt := range tests {
+		var uids []string
+		for _, events := range dedupEvents(newFeeds(), DedupConfig{Enabled: true, DateToleranceDays: tt.tolerance}) {
+			for _, event := range events {
+				uids = append(uids, event.Id())
+			}
+		}
+		if got := strings.Join(uids, ", "); got != tt.want {
+			t.Errorf("Tolerance %d: expected %s, got %s", tt.tolerance, tt.want, got)
+		}
+	}
+}
+
+// TestDedupEventsRecurrenceOverrides tests that a RECURRENCE-ID override is
+// kept with its series rather than collapsed into it, and that an override
+// goes along with a series collapsed into another feed's.
+func TestDedupEventsRecurrenceOverrides(t *testing.T) {
+	series := func(uid string, override bool) *ics.VEvent {
+		event := ics.NewEvent(uid)
+		event.SetSummary("Team Holiday")
+		event.SetProperty(ics.ComponentPropertyDtStart, "20230102", ics.WithValue("DATE"))
+		if override {
+			event.SetProperty(propertyRecurrenceID, "20230102", ics.WithValue("DATE"))
+			event.SetDescription("Moved indoors")
+		} else {
+			event.SetProperty(ics.ComponentPropertyRrule, "FREQ=WEEKLY;COUNT=4")
+		}
+		return event
+	}
+
+	for _, key := range []string{dedupKeyUID, dedupKeySummaryDate} {
+		feedEvents := [][]*ics.VEvent{
+			{series("a", false), series("a", true)},
+			{series("b", true), series("b", false)},
+		}
+		if key == dedupKeyUID {
+			feedEvents[1] = []*ics.VEvent{series("a", true), series("a", false)}
+		}
+		deduped := dedupEvents(feedEvents, DedupConfig{Enabled: true, Key: key})
+		if len(deduped[0]) != 2 || recurrenceID(deduped[0][1]) != "20230102" {
+			t.Errorf("%s: expected the series and its override from the first feed, got %d events", key, len(deduped[0]))
+		}
+		if len(deduped[1]) != 0 {
+			t.Errorf("%s: expected the duplicate series and its override to be dropped, got %d events", key, len(deduped[1]))
+		}
+	}
+}
+
+// End, dedup_test.go
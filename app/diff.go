@@ -0,0 +1,130 @@
+// diff.go
+// This file contains the endpoint comparing the events of two feeds.
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// diffEntry is an event listed in a feed diff.
+type diffEntry struct {
+	Summary string `json:"summary"`
+	Date    string `json:"date"`
+}
+
+// feedDiff lists the events found in only one of two feeds, or in both.
+type feedDiff struct {
+	OnlyInA []diffEntry `json:"only_in_a"`
+	OnlyInB []diffEntry `json:"only_in_b"`
+	InBoth  []diffEntry `json:"in_both"`
+}
+
+// findFeed returns the configured feed with the given name, ignoring case.
+//
+// Parameters:
+// - name: The feed name to look up.
+//
+// Returns:
+// - The feed.
+// - False if no feed has that name.
+func (s *server) findFeed(name string) (FeedConfig, bool) {
+	for _, feed := range s.cfg.Feeds {
+		if strings.EqualFold(feed.Name, name) {
+			return feed, true
+		}
+	}
+	return FeedConfig{}, false
+}
+
+// diffEvents compares two event lists, matching events as dedup does under
+// the configured dedup.key and dedup.date_tolerance_days. Each bucket lists an
+// event once, in source order; in_both uses the events of a.
+//
+// Parameters:
+// - a: The events of the first feed.
+// - b: The events of the second feed.
+// - cfg: The dedup settings.
+//
+// Returns:
+// - The events only in a, only in b, and in both.
+func diffEvents(a, b []*ics.VEvent, cfg DedupConfig) feedDiff {
+	strategy := dedupStrategyFor(cfg.Key)
+	index := func(events []*ics.VEvent) map[string][]*ics.VEvent {
+		byBase := map[string][]*ics.VEvent{}
+		for _, event := range events {
+			if base := strategy.base(event); base != "" {
+				byBase[base] = append(byBase[base], event)
+			}
+		}
+		return byBase
+	}
+	found := func(byBase map[string][]*ics.VEvent, event *ics.VEvent) bool {
+		for _, other := range byBase[strategy.base(event)] {
+			if strategy.matches(event, other, cfg.DateToleranceDays) {
+				return true
+			}
+		}
+		return false
+	}
+	inA, inB := index(a), index(b)
+
+	diff := feedDiff{OnlyInA: []diffEntry{}, OnlyInB: []diffEntry{}, InBoth: []diffEntry{}}
+	listed := map[string][]*ics.VEvent{}
+	add := func(bucket *[]diffEntry, event *ics.VEvent) {
+		if found(listed, event) {
+			return
+		}
+		if base := strategy.base(event); base != "" {
+			listed[base] = append(listed[base], event)
+		}
+		*bucket = append(*bucket, diffEntry{
+			Summary: propertyValue(event, ics.ComponentPropertySummary),
+			Date:    eventDate(event),
+		})
+	}
+	for _, event := range a {
+		if found(inB, event) {
+			add(&diff.InBoth, event)
+		} else {
+			add(&diff.OnlyInA, event)
+		}
+	}
+	for _, event := range b {
+		if !found(inA, event) {
+			add(&diff.OnlyInB, event)
+		}
+	}
+	return diff
+}
+
+// diff handles GET /diff?a=<feed>&b=<feed>, returning the events only in A,
+// only in B, and in both, matched as dedup.key matches them.
+func (s *server) diff(c *gin.Context) {
+	feedA, okA := s.findFeed(c.Query("a"))
+	feedB, okB := s.findFeed(c.Query("b"))
+	if !okA || !okB {
+		c.JSON(http.StatusNotFound, gin.H{"error": "both a and b must name configured feeds"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	opts := parseAggregateOptions(c)
+	eventsA, err := s.feedEvents(ctx, feedA, opts.bypassCache)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	eventsB, err := s.feedEvents(ctx, feedB, opts.bypassCache)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diffEvents(eventsA, eventsB, s.cfg.Dedup))
+}
+
+// End, diff.go
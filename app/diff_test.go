@@ -0,0 +1,89 @@
+// diff_test.go
+// This file contains tests for the feed diff endpoint.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestDiff tests that overlapping feeds are split into the three buckets.
+func TestDiff(t *testing.T) {
+	usCalendar := `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Canadian  new year
+DTSTART;VALUE=DATE:20230101
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Independence Day
+DTSTART;VALUE=DATE:20230704
+END:VEVENT
+END:VCALENDAR`
+	cfg := defaultConfig()
+	cfg.Feeds = []FeedConfig{
+		{Name: "Canada", URL: newFeedServer(t, mockCanadianCalendar).URL},
+		{Name: "US", URL: newFeedServer(t, usCalendar).URL},
+	}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	var diff feedDiff
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/diff?a=Canada&b=US")), &diff); err != nil {
+		t.Fatalf("Error decoding diff: %v", err)
+	}
+
+	want := feedDiff{
+		OnlyInA: []diffEntry{{Summary: "Canada Day", Date: "20230701"}},
+		OnlyInB: []diffEntry{{Summary: "Independence Day", Date: "20230704"}},
+		InBoth:  []diffEntry{{Summary: "Canadian New Year", Date: "20230101"}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected diff %+v, got %+v", want, diff)
+	}
+}
+
+// TestDiffDedupKey tests that /diff matches events under dedup.key, here by
+// UID across differing summaries.
+func TestDiffDedupKey(t *testing.T) {
+	calendar := func(summary string) string {
+		return "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:canada-day@example.com\nSUMMARY:" + summary + "\nDTSTART;VALUE=DATE:20230701\nEND:VEVENT\nEND:VCALENDAR\n"
+	}
+	cfg := defaultConfig()
+	cfg.Dedup.Key = dedupKeyUID
+	cfg.Feeds = []FeedConfig{
+		{Name: "Canada", URL: newFeedServer(t, calendar("Canada Day")).URL},
+		{Name: "Ontario", URL: newFeedServer(t, calendar("Dominion Day")).URL},
+	}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	var diff feedDiff
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/diff?a=Canada&b=Ontario")), &diff); err != nil {
+		t.Fatalf("Error decoding diff: %v", err)
+	}
+	want := feedDiff{OnlyInA: []diffEntry{}, OnlyInB: []diffEntry{}, InBoth: []diffEntry{{Summary: "Canada Day", Date: "20230701"}}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected diff %+v, got %+v", want, diff)
+	}
+}
+
+// TestDiffUnknownFeed tests that unknown feed names are rejected.
+func TestDiffUnknownFeed(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/diff?a=Canada&b=Atlantis")
+	if err != nil {
+		t.Fatalf("Error requesting diff: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown feed, got %d", resp.StatusCode)
+	}
+}
+
+// End, diff_test.go
@@ -0,0 +1,91 @@
+// events.go
+// This file contains helpers for inspecting and editing parsed events.
+package main
+
+import (
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// propertyValue returns the value of an event property, or "" if it is absent.
+//
+// Parameters:
+// - event: The event to inspect.
+// - property: The property to read.
+//
+// Returns:
+// - The property value.
+func propertyValue(event *ics.VEvent, property ics.ComponentProperty) string {
+	if prop := event.GetProperty(property); prop != nil {
+		return prop.Value
+	}
+	return ""
+}
+
+// removeProperty deletes every occurrence of a property from an event.
+//
+// Parameters:
+// - event: The event to edit.
+// - property: The property to remove.
+func removeProperty(event *ics.VEvent, property ics.ComponentProperty) {
+	kept := event.Properties[:0]
+	for _, prop := range event.Properties {
+		if prop.IANAToken != string(property) {
+			kept = append(kept, prop)
+		}
+	}
+	event.Properties = kept
+}
+
+// eventCategories returns every category listed in the event's CATEGORIES
+// properties, which may each hold a comma-separated list.
+//
+// Parameters:
+// - event: The event to inspect.
+//
+// Returns:
+// - The trimmed category names, in order of appearance.
+func eventCategories(event *ics.VEvent) []string {
+	var categories []string
+	for _, prop := range event.Properties {
+		if prop.IANAToken != string(ics.ComponentPropertyCategories) {
+			continue
+		}
+		for _, category := range strings.Split(prop.Value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories
+}
+
+// eventResources returns the links an event carries in its ATTACH properties,
+// followed by its URL, each once. Attachments inlined as binary data are not
+// links and are left out.
+//
+// Parameters:
+// - event: The event to inspect.
+//
+// Returns:
+// - The link URIs, in order of appearance.
+func eventResources(event *ics.VEvent) []string {
+	var resources []string
+	seen := map[string]bool{}
+	for _, property := range []ics.ComponentProperty{ics.ComponentPropertyAttach, ics.ComponentPropertyUrl} {
+		for _, prop := range event.Properties {
+			if prop.IANAToken != string(property) || seen[prop.Value] || prop.Value == "" {
+				continue
+			}
+			if values := prop.ICalParameters[string(ics.ParameterValue)]; len(values) > 0 && strings.EqualFold(values[0], "BINARY") {
+				continue
+			}
+			seen[prop.Value] = true
+			resources = append(resources, prop.Value)
+		}
+	}
+	return resources
+}
+
+// End, events.go
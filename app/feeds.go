@@ -0,0 +1,34 @@
+// feeds.go
+// This file contains the endpoint listing the configured feeds.
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// feedInfo is the /feeds description of a configured feed. The URL is left out
+// since it may carry credentials.
+type feedInfo struct {
+	Name    string `json:"name"`
+	Country string `json:"country,omitempty"`
+	Color   string `json:"color,omitempty"`
+	// Status is "enabled" or "disabled".
+	Status string `json:"status"`
+}
+
+// feeds lists the configured feeds in order, including disabled ones.
+func (s *server) feeds(c *gin.Context) {
+	infos := []feedInfo{}
+	for _, feed := range s.cfg.Feeds {
+		status := "enabled"
+		if !feed.enabled() {
+			status = "disabled"
+		}
+		infos = append(infos, feedInfo{Name: feed.Name, Country: feed.Country, Color: feed.Color, Status: status})
+	}
+	c.JSON(http.StatusOK, gin.H{"feeds": infos})
+}
+
+// End, feeds.go
@@ -0,0 +1,40 @@
+// feeds_test.go
+// This file contains tests for enabling and listing feeds.
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDisabledFeed tests that a disabled feed contributes no events and is
+// reported as disabled.
+func TestDisabledFeed(t *testing.T) {
+	cfg := newTestConfig(t)
+	disabled := false
+	cfg.Feeds[0].Enabled = &disabled
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	if strings.Contains(body, "Colombian") {
+		t.Errorf("Expected the disabled Colombian feed to contribute no events")
+	}
+	if !strings.Contains(body, "Canada Day") {
+		t.Errorf("Expected the enabled Canadian feed to be served")
+	}
+
+	var report struct {
+		Feeds []feedInfo `json:"feeds"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/feeds")), &report); err != nil {
+		t.Fatalf("Error decoding feeds: %v", err)
+	}
+	if len(report.Feeds) != 2 || report.Feeds[0].Status != "disabled" || report.Feeds[1].Status != "enabled" {
+		t.Errorf("Expected Colombia disabled and Canada enabled, got %+v", report.Feeds)
+	}
+}
+
+// End, feeds_test.go
@@ -0,0 +1,144 @@
+// feedsummary.go
+// This file contains the structured per-feed summary endpoint.
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sampleEdges samples the first, middle, and last events, as
+	// printCalendarSummary does.
+	sampleEdges = "edges"
+	// sampleFirst samples the first n events.
+	sampleFirst = "first"
+	// sampleLast samples the last n events.
+	sampleLast = "last"
+	// sampleEvery samples every nth event, starting with the first.
+	sampleEvery = "every"
+)
+
+// sampledEvent is an event picked for a /summary preview.
+type sampledEvent struct {
+	// Entry is the event's 1-based position in its feed.
+	Entry   int    `json:"entry"`
+	Summary string `json:"summary"`
+	// Start is the raw DTSTART value.
+	Start string `json:"start,omitempty"`
+}
+
+// feedSummary is the /summary description of one feed.
+type feedSummary struct {
+	Feed   string         `json:"feed"`
+	Events int            `json:"events"`
+	Sample []sampledEvent `json:"sample"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// sampleIndices picks the positions of the events previewed out of a feed.
+//
+// Parameters:
+// - total: The number of events in the feed.
+// - strategy: One of "edges", "first", "last", or "every".
+// - n: The number of events for "first" and "last", or the step for "every".
+//
+// Returns:
+// - The picked positions, ascending.
+func sampleIndices(total int, strategy string, n int) []int {
+	indices := []int{}
+	switch strategy {
+	case sampleFirst:
+		for i := 0; i < min(n, total); i++ {
+			indices = append(indices, i)
+		}
+	case sampleLast:
+		for i := max(0, total-n); i < total; i++ {
+			indices = append(indices, i)
+		}
+	case sampleEvery:
+		for i := 0; i < total; i += n {
+			indices = append(indices, i)
+		}
+	default:
+		if total > 0 {
+			indices = append(indices, 0)
+		}
+		if total > 2 {
+			indices = append(indices, total/2)
+		}
+		if total >= 2 {
+			indices = append(indices, total-1)
+		}
+	}
+	return indices
+}
+
+// summarizeFeed describes a feed's events with a sample of them.
+//
+// Parameters:
+// - feed: The feed the events came from.
+// - events: The feed's events, in source order.
+// - strategy: The sampling strategy, as for sampleIndices.
+// - n: The sampling count or step.
+//
+// Returns:
+// - The summary.
+func summarizeFeed(feed FeedConfig, events []*ics.VEvent, strategy string, n int) feedSummary {
+	summary := feedSummary{Feed: feed.Name, Events: len(events), Sample: []sampledEvent{}}
+	for _, i := range sampleIndices(len(events), strategy, n) {
+		summary.Sample = append(summary.Sample, sampledEvent{
+			Entry:   i + 1,
+			Summary: propertyValue(events[i], ics.ComponentPropertySummary),
+			Start:   propertyValue(events[i], ics.ComponentPropertyDtStart),
+		})
+	}
+	return summary
+}
+
+// feedSummaries serves a structured version of printCalendarSummary for each
+// selected feed: its event count and a preview sample. sample=first|last|every
+// picks the first n, the last n, or every nth event, with n=3 by default;
+// without it the first, middle, and last events are shown. It accepts the feed
+// selection parameters of aggregateICS.
+func (s *server) feedSummaries(c *gin.Context) {
+	opts := parseAggregateOptions(c)
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	strategy := c.DefaultQuery("sample", sampleEdges)
+	switch strategy {
+	case sampleEdges, sampleFirst, sampleLast, sampleEvery:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sample must be edges, first, last, or every"})
+		return
+	}
+	n := 3
+	if raw := c.Query("n"); raw != "" {
+		var err error
+		if n, err = strconv.Atoi(raw); err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "n must be a positive integer"})
+			return
+		}
+	}
+
+	feedEvents, _, errs := s.collectEvents(c.Request.Context(), opts)
+	report := []feedSummary{}
+	for i, feed := range s.cfg.Feeds {
+		if !opts.includesFeed(feed) {
+			continue
+		}
+		summary := summarizeFeed(feed, feedEvents[i], strategy, n)
+		if errs[i] != nil {
+			summary.Error = errs[i].Error()
+		}
+		report = append(report, summary)
+	}
+	c.JSON(http.StatusOK, gin.H{"feeds": report})
+}
+
+// End, feedsummary.go
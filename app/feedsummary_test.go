@@ -0,0 +1,73 @@
+// feedsummary_test.go
+// This file contains tests for the structured per-feed summary endpoint.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSampleIndices tests the positions each sampling strategy picks.
+func TestSampleIndices(t *testing.T) {
+	tests := []struct {
+		total    int
+		strategy string
+		n        int
+		want     string
+	}{
+		{10, sampleFirst, 3, "[0 1 2]"},
+		{2, sampleFirst, 3, "[0 1]"},
+		{10, sampleEvery, 3, "[0 3 6 9]"},
+		{10, sampleEvery, 1, "[0 1 2 3 4 5 6 7 8 9]"},
+		{10, sampleLast, 2, "[8 9]"},
+		{10, sampleEdges, 0, "[0 5 9]"},
+		{1, sampleEdges, 0, "[0]"},
+		{0, sampleEvery, 2, "[]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(sampleIndices(test.total, test.strategy, test.n)); got != test.want {
+			t.Errorf("Expected %s of %d with n=%d to pick %s, got %s", test.strategy, test.total, test.n, test.want, got)
+		}
+	}
+}
+
+// TestFeedSummaries tests that /summary previews each feed with the requested
+// sampling, and rejects unknown strategies.
+func TestFeedSummaries(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	var report struct {
+		Feeds []feedSummary `json:"feeds"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/summary?sample=first&n=1")), &report); err != nil {
+		t.Fatalf("Error decoding summary: %v", err)
+	}
+	want := "[{Colombia 2 [{1 Colombian New Year 20230101}] } {Canada 2 [{1 Canadian New Year 20230101}] }]"
+	if got := fmt.Sprint(report.Feeds); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/summary?sample=every&n=2&feed=Canada")), &report); err != nil {
+		t.Fatalf("Error decoding summary: %v", err)
+	}
+	if got := fmt.Sprint(report.Feeds); got != "[{Canada 2 [{1 Canadian New Year 20230101}] }]" {
+		t.Errorf("Expected every second Canadian event, got %s", got)
+	}
+
+	for _, query := range []string{"sample=random", "sample=first&n=0"} {
+		resp, err := srv.Client().Get(srv.URL + "/summary?" + query)
+		if err != nil {
+			t.Fatalf("Error requesting summary: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected with a 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+// End, feedsummary_test.go
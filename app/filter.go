@@ -0,0 +1,330 @@
+// filter.go
+// This file contains the query filters applied to aggregated events.
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// parseList splits a comma-separated query value into its trimmed, non-empty items.
+//
+// Parameters:
+// - value: The raw query value.
+//
+// Returns:
+// - The listed items, or nil if there are none.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// matchesCountry reports whether an event belongs to one of the given countries,
+// either because its feed is configured with that country or because the event
+// lists the country code in its CATEGORIES.
+//
+// Parameters:
+// - feed: The feed the event came from.
+// - event: The event to check.
+// - countries: The ISO country codes to select; empty selects everything.
+//
+// Returns:
+// - True if the event should be kept.
+func matchesCountry(feed FeedConfig, event *ics.VEvent, countries []string) bool {
+	if len(countries) == 0 {
+		return true
+	}
+	for _, country := range countries {
+		if strings.EqualFold(feed.Country, country) {
+			return true
+		}
+		for _, category := range eventCategories(event) {
+			if strings.EqualFold(category, country) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// weekdays maps the accepted ?weekday names, full and abbreviated, to their days.
+var weekdays = map[string]time.Weekday{}
+
+func init() {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		weekdays[name] = day
+		weekdays[name[:3]] = day
+	}
+}
+
+// eventWeekday returns the day of the week an event starts on. Dates and
+// floating times fall on the day they name; UTC and TZID times are converted to
+// loc first.
+//
+// Parameters:
+// - event: The event to inspect.
+// - loc: The time zone the weekday is judged in.
+//
+// Returns:
+// - The weekday of the event's DTSTART.
+// - False if the event has no parsable DTSTART.
+func eventWeekday(event *ics.VEvent, loc *time.Location) (time.Weekday, bool) {
+	prop := event.GetProperty(ics.ComponentPropertyDtStart)
+	if prop == nil {
+		return 0, false
+	}
+	if len(prop.ICalParameters[string(ics.ParameterTzid)]) == 0 && !strings.HasSuffix(prop.Value, "Z") {
+		if len(prop.Value) < len("20060102") {
+			return 0, false
+		}
+		date, err := time.Parse("20060102", prop.Value[:len("20060102")])
+		if err != nil {
+			return 0, false
+		}
+		return date.Weekday(), true
+	}
+	start, err := eventStart(event)
+	if err != nil {
+		return 0, false
+	}
+	return start.In(loc).Weekday(), true
+}
+
+// matchesWeekday reports whether an event starts on one of the given weekdays.
+//
+// Parameters:
+// - event: The event to check.
+// - days: The weekday names to select, as accepted by ?weekday; empty selects everything.
+// - loc: The time zone the weekday is judged in.
+//
+// Returns:
+// - True if the event should be kept.
+func matchesWeekday(event *ics.VEvent, days []string, loc *time.Location) bool {
+	if len(days) == 0 {
+		return true
+	}
+	weekday, ok := eventWeekday(event, loc)
+	if !ok {
+		return false
+	}
+	for _, name := range days {
+		if weekdays[strings.ToLower(name)] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesLocation reports whether an event's LOCATION contains the given
+// substring, ignoring case. Events without a LOCATION never match.
+//
+// Parameters:
+// - event: The event to check.
+// - location: The substring to look for, as passed to ?location; "" selects everything.
+//
+// Returns:
+// - True if the event should be kept.
+func matchesLocation(event *ics.VEvent, location string) bool {
+	if location == "" {
+		return true
+	}
+	value := propertyValue(event, ics.ComponentPropertyLocation)
+	return value != "" && strings.Contains(strings.ToLower(value), strings.ToLower(location))
+}
+
+const (
+	// onlyMatchExact keeps events whose whole SUMMARY is one of the only names.
+	onlyMatchExact = "exact"
+	// onlyMatchSubstring keeps events whose SUMMARY contains one of the only names.
+	onlyMatchSubstring = "substring"
+)
+
+// matchesOnly reports whether an event's SUMMARY matches one of the given
+// names. Both sides are compared as normalized by normalizeSummary.
+//
+// Parameters:
+// - event: The event to check.
+// - names: The SUMMARY names to keep; empty selects everything.
+// - match: How names are compared, onlyMatchExact or onlyMatchSubstring.
+//
+// Returns:
+// - True if the event should be kept.
+func matchesOnly(event *ics.VEvent, names []string, match string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	summary := normalizeSummary(propertyValue(event, ics.ComponentPropertySummary))
+	for _, name := range names {
+		name = normalizeSummary(name)
+		if summary == name || match == onlyMatchSubstring && strings.Contains(summary, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWindow reports whether an event's [DTSTART, DTEND) interval
+// intersects the window, so that multi-day events straddling a bound are kept.
+// All-day events without DTEND last the day, and other events without an end
+// are the instant they start.
+//
+// Parameters:
+// - event: The event to check.
+// - from: The start of the window; the zero time leaves it open.
+// - to: The end of the window, exclusive; the zero time leaves it open.
+//
+// Returns:
+// - True if the event should be kept.
+func matchesWindow(event *ics.VEvent, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	period, ok := eventPeriod(event, time.Local)
+	if !ok {
+		start, err := eventStart(event)
+		if err != nil {
+			return false
+		}
+		// An instant is in the window when it is in [from, to).
+		return !start.Before(from) && (to.IsZero() || start.Before(to))
+	}
+	return (to.IsZero() || period.start.Before(to)) && (from.IsZero() || period.end.After(from))
+}
+
+// excludedSummary reports whether a SUMMARY matches one of a feed's
+// exclude_summaries. Patterns are shell globs as matched by matchGlob, so
+// entries without wildcards match exactly; both sides are compared as
+// normalized by normalizeSummary.
+//
+// Parameters:
+// - patterns: The feed's exclude_summaries.
+// - summary: The event's SUMMARY.
+//
+// Returns:
+// - True if the event should be removed.
+func excludedSummary(patterns []string, summary string) bool {
+	summary = normalizeSummary(summary)
+	for _, pattern := range patterns {
+		if matchGlob(normalizeSummary(pattern), summary) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether text matches a shell glob of the syntax path.Match
+// accepts: * for any run of characters, ? for any one, [a-z] and [^a-z] for a
+// class, and \ to escape. Unlike path.Match, which is meant for file paths, it
+// treats / like any other character, so "Cancelled*" matches "Cancelled 1/2".
+//
+// Parameters:
+// - pattern: The glob, already checked with path.Match.
+// - text: The text to match.
+//
+// Returns:
+// - True if the whole text matches.
+func matchGlob(pattern, text string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range text {
+				if matchGlob(pattern, text[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if text == "" {
+				return false
+			}
+			_, n := utf8.DecodeRuneInString(text)
+			pattern, text = pattern[1:], text[n:]
+		case '[':
+			if text == "" {
+				return false
+			}
+			r, n := utf8.DecodeRuneInString(text)
+			matched, rest, ok := matchClass(pattern[1:], r)
+			if !ok || !matched {
+				return false
+			}
+			pattern, text = rest, text[n:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			want, wn := utf8.DecodeRuneInString(pattern)
+			got, gn := utf8.DecodeRuneInString(text)
+			if text == "" || want != got {
+				return false
+			}
+			pattern, text = pattern[wn:], text[gn:]
+		}
+	}
+	return text == ""
+}
+
+// matchClass matches a rune against the character class at the start of
+// class, the part of a glob after its opening [.
+//
+// Parameters:
+// - class: The class and the rest of the glob after it.
+// - r: The rune to match.
+//
+// Returns:
+// - Whether r is in the class.
+// - The glob after the class's closing ].
+// - False if the class is malformed.
+func matchClass(class string, r rune) (bool, string, bool) {
+	negated := strings.HasPrefix(class, "^")
+	if negated {
+		class = class[1:]
+	}
+	// next reads one possibly escaped character of the class.
+	next := func() (rune, bool) {
+		if strings.HasPrefix(class, "\\") {
+			class = class[1:]
+		}
+		if class == "" {
+			return 0, false
+		}
+		c, n := utf8.DecodeRuneInString(class)
+		class = class[n:]
+		return c, true
+	}
+	matched := false
+	for first := true; ; first = false {
+		if !first && strings.HasPrefix(class, "]") {
+			return matched != negated, class[1:], true
+		}
+		lo, ok := next()
+		if !ok {
+			return false, "", false
+		}
+		hi := lo
+		if strings.HasPrefix(class, "-") && !strings.HasPrefix(class, "-]") {
+			class = class[1:]
+			if hi, ok = next(); !ok {
+				return false, "", false
+			}
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+}
+
+// End, filter.go
@@ -0,0 +1,143 @@
+// filter_test.go
+// This file contains tests for the query filters.
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMatchesCountryCategories tests that events are matched by their CATEGORIES.
+func TestMatchesCountryCategories(t *testing.T) {
+	event := parseMockEvent(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Shared Holiday
+DTSTART;VALUE=DATE:20230101
+CATEGORIES:Holiday,CA
+END:VEVENT
+END:VCALENDAR`)
+	feed := FeedConfig{Name: "Mixed"}
+
+	if !matchesCountry(feed, event, []string{"ca"}) {
+		t.Errorf("Expected event tagged CA to match country=ca")
+	}
+	if matchesCountry(feed, event, []string{"CO"}) {
+		t.Errorf("Expected event tagged CA not to match country=CO")
+	}
+	if !matchesCountry(feed, event, nil) {
+		t.Errorf("Expected every event to match when no country is given")
+	}
+}
+
+// TestMatchesWeekday tests that only events starting on the requested weekdays
+// are kept, with UTC times judged in the configured time zone.
+func TestMatchesWeekday(t *testing.T) {
+	bogota, err := time.LoadLocation("America/Bogota")
+	if err != nil {
+		t.Fatalf("Error loading time zone: %v", err)
+	}
+	events := map[string]string{
+		"Sunday date":                  "DTSTART;VALUE=DATE:20230101",
+		"Monday date":                  "DTSTART;VALUE=DATE:20230102",
+		"Tuesday date":                 "DTSTART;VALUE=DATE:20230103",
+		"Friday floating time":         "DTSTART:20230106T090000",
+		"Monday UTC, Sunday in Bogota": "DTSTART:20230102T030000Z",
+		"Monday in Bogota":             "DTSTART;TZID=America/Bogota:20230102T220000",
+	}
+
+	var kept []string
+	for summary, start := range events {
+		event := parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:"+summary+"\n"+start+"\nEND:VEVENT\nEND:VCALENDAR")
+		if matchesWeekday(event, []string{"Monday", "fri"}, bogota) {
+			kept = append(kept, summary)
+		}
+		if !matchesWeekday(event, nil, bogota) {
+			t.Errorf("Expected %s to match when no weekday is given", summary)
+		}
+	}
+	sort.Strings(kept)
+
+	want := "Friday floating time, Monday date, Monday in Bogota"
+	if got := strings.Join(kept, ", "); got != want {
+		t.Errorf("Expected %s to be kept, got %s", want, got)
+	}
+}
+
+// TestMatchesLocation tests that only events whose LOCATION contains the
+// substring, in any case, are kept, and that events without one are dropped.
+func TestMatchesLocation(t *testing.T) {
+	events := map[string]string{
+		"Toronto":   "LOCATION:Toronto\\, ONTARIO\n",
+		"Ottawa":    "LOCATION:Ottawa\\, Ontario\n",
+		"Vancouver": "LOCATION:Vancouver\\, British Columbia\n",
+		"Nowhere":   "",
+	}
+
+	var kept []string
+	for summary, location := range events {
+		event := parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:"+summary+"\n"+location+"DTSTART;VALUE=DATE:20230701\nEND:VEVENT\nEND:VCALENDAR")
+		if matchesLocation(event, "ontario") {
+			kept = append(kept, summary)
+		}
+		if !matchesLocation(event, "") {
+			t.Errorf("Expected %s to match when no location is given", summary)
+		}
+	}
+	sort.Strings(kept)
+
+	want := "Ottawa, Toronto"
+	if got := strings.Join(kept, ", "); got != want {
+		t.Errorf("Expected %s to be kept, got %s", want, got)
+	}
+}
+
+// TestExcludedSummaryGlob tests that exclude_summaries globs treat / like any
+// other character, while still matching exactly without wildcards.
+func TestExcludedSummaryGlob(t *testing.T) {
+	patterns := []string{"Cancelled*", "Day ?/? of [0-9]", "Clock  change"}
+	for summary, want := range map[string]bool{
+		"Cancelled 1/2":   true,
+		"cancelled":       true,
+		"Day 1/3 of 5":    true,
+		"Day 1/3 of five": false,
+		"clock change":    true,
+		"Clock changes":   false,
+		"Not Cancelled":   false,
+	} {
+		if got := excludedSummary(patterns, summary); got != want {
+			t.Errorf("Expected %q excluded to be %v, got %v", summary, want, got)
+		}
+	}
+}
+
+// TestMatchesWindow tests that events are kept when their interval intersects
+// the window, including a multi-day event straddling from.
+func TestMatchesWindow(t *testing.T) {
+	from := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 1, 20, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		dates string
+		want  bool
+	}{
+		{"DTSTART:20230108T000000Z\nDTEND:20230112T000000Z", true},
+		{"DTSTART:20230118T000000Z\nDTEND:20230122T000000Z", true},
+		{"DTSTART:20230105T000000Z\nDTEND:20230110T000000Z", false},
+		{"DTSTART:20230120T000000Z\nDTEND:20230121T000000Z", false},
+		{"DTSTART:20230115T120000Z", true},
+		{"DTSTART:20230120T000000Z", false},
+	}
+	for _, tt := range tests {
+		event := parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:Festival\n"+tt.dates+"\nEND:VEVENT\nEND:VCALENDAR")
+		if got := matchesWindow(event, from, to); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.dates, tt.want, got)
+		}
+		if !matchesWindow(event, time.Time{}, time.Time{}) {
+			t.Errorf("%q: expected a match without a window", tt.dates)
+		}
+	}
+}
+
+// End, filter_test.go
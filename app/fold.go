@@ -0,0 +1,140 @@
+// fold.go
+// This file contains the RFC 5545 folding of long content lines.
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxFoldOctets is the longest content line RFC 5545 allows, excluding the CRLF.
+const maxFoldOctets = 75
+
+// unfoldLines splits serialized calendar data into its logical content lines,
+// joining continuation lines that begin with a space or a tab. Feeds that end
+// their lines with a bare LF are unfolded the same way.
+//
+// Parameters:
+// - data: CRLF- or LF-separated calendar data.
+//
+// Returns:
+// - The unfolded content lines, without line endings.
+func unfoldLines(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// foldLine writes a content line folded so that no physical line exceeds the
+// given number of octets. Lines are cut by UTF-8 byte count, never inside a
+// multibyte sequence, and continuation lines start with a single space.
+//
+// Parameters:
+// - b: The builder receiving the folded, CRLF-terminated line.
+// - line: The content line, without its line ending.
+// - octets: The maximum octets per physical line.
+func foldLine(b *strings.Builder, line string, octets int) {
+	limit := octets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the continuation line's length.
+		limit = octets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// foldContent refolds serialized calendar data at the given octet width,
+// replacing the serializer's own folding. Overlong content lines are reported
+// to warn, so that transforms producing overlong values stand out; the output
+// is the same either way.
+//
+// Parameters:
+// - data: CRLF-separated calendar data.
+// - octets: The maximum octets per physical line.
+// - warn: The check of the lines written for the request; nil disables it.
+//
+// Returns:
+// - The refolded data.
+func foldContent(data string, octets int, warn *lineWarner) string {
+	var b strings.Builder
+	b.Grow(len(data) + len(data)/octets*3)
+	for _, line := range unfoldLines(data) {
+		warn.check(line)
+		foldLine(&b, line, octets)
+	}
+	return b.String()
+}
+
+// lineWarner logs the content lines of one response that are longer than
+// warn_line_octets before folding. Only the first line of each property is
+// logged, so that a feed full of long descriptions yields one log line rather
+// than one per event. It is safe for concurrent use.
+type lineWarner struct {
+	ctx    context.Context
+	octets int
+	mu     sync.Mutex
+	// warned holds the properties already logged.
+	warned map[string]bool
+}
+
+// newLineWarner creates the check of the lines written for a request.
+//
+// Parameters:
+// - ctx: The context of the request, whose ID the log lines carry.
+// - octets: The longest content line written without a log line; 0 disables the check.
+//
+// Returns:
+// - The check, or nil if it is disabled.
+func newLineWarner(ctx context.Context, octets int) *lineWarner {
+	if octets <= 0 {
+		return nil
+	}
+	return &lineWarner{ctx: ctx, octets: octets, warned: map[string]bool{}}
+}
+
+// check logs a content line longer than the limit, naming its property and
+// quoting the start of its value, unless a line of that property was logged
+// before.
+//
+// Parameters:
+// - line: The unfolded content line.
+func (w *lineWarner) check(line string) {
+	if w == nil || len(line) <= w.octets {
+		return
+	}
+	name, value, _ := strings.Cut(line, ":")
+	name, _, _ = strings.Cut(name, ";")
+	w.mu.Lock()
+	warned := w.warned[name]
+	w.warned[name] = true
+	w.mu.Unlock()
+	if warned {
+		return
+	}
+	if len(value) > 40 {
+		cut := 40
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut] + "..."
+	}
+	logf(w.ctx, "Writing a %d-octet %s line before folding, over %d: %q; later %s lines of this response are not logged", len(line), name, w.octets, value, name)
+}
+
+// End, fold.go
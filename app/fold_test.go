@@ -0,0 +1,126 @@
+// fold_test.go
+// This file contains tests for folding long content lines.
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestFoldContentMultibyte tests that a long multibyte SUMMARY is folded by
+// octets without splitting a UTF-8 sequence.
+func TestFoldContentMultibyte(t *testing.T) {
+	// "SUMMARY:" and 66 a's fill 74 octets, so the 2-octet é would end at 76
+	// and must move to the continuation line.
+	summary := strings.Repeat("a", 66) + "é" + strings.Repeat("日", 30)
+	event := ics.NewEvent("fold@test")
+	event.SetSummary(summary)
+
+	folded := serializeEvent(event, "", maxFoldOctets, nil)
+	var summaryLines []string
+	inSummary := false
+	for _, line := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(line) > maxFoldOctets {
+			t.Errorf("Expected at most %d octets, got %d in %q", maxFoldOctets, len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("Expected a line of whole UTF-8 sequences, got %q", line)
+		}
+		if strings.HasPrefix(line, "SUMMARY:") {
+			inSummary = true
+		} else if !strings.HasPrefix(line, " ") {
+			inSummary = false
+		}
+		if inSummary {
+			summaryLines = append(summaryLines, line)
+		}
+	}
+
+	// 1 + 2 + 24*3 = 75 octets; the next 日 would exceed the limit.
+	want := []string{
+		"SUMMARY:" + strings.Repeat("a", 66),
+		" é" + strings.Repeat("日", 24),
+		" " + strings.Repeat("日", 6),
+	}
+	if strings.Join(summaryLines, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected SUMMARY lines %q, got %q", want, summaryLines)
+	}
+
+	cal, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\n" + folded + "END:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatalf("Error parsing folded event: %v", err)
+	}
+	if got := propertyValue(cal.Events()[0], ics.ComponentPropertySummary); got != summary {
+		t.Errorf("Expected the SUMMARY to unfold to %q, got %q", summary, got)
+	}
+}
+
+// TestUnfoldLinesTabContinuation tests that continuation lines starting with a
+// tab are joined like those starting with a space, including in feeds that end
+// their lines with a bare LF.
+func TestUnfoldLinesTabContinuation(t *testing.T) {
+	data := "BEGIN:VCALENDAR\nCALSCALE:GREG\n\tORIAN\nBEGIN:VEVENT\nSUMMARY:Colombian \n\tIndependence\n  Day\nLAST-MODI\n FIED:20230102T030405Z\nEND:VEVENT\nEND:VCALENDAR\n"
+	want := []string{
+		"BEGIN:VCALENDAR",
+		"CALSCALE:GREGORIAN",
+		"BEGIN:VEVENT",
+		"SUMMARY:Colombian Independence Day",
+		"LAST-MODIFIED:20230102T030405Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	for _, input := range []string{data, strings.ReplaceAll(data, "\n", "\r\n")} {
+		if got := unfoldLines(input); strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("Expected lines %q, got %q", want, got)
+		}
+	}
+
+	if got := calendarProperty(data, "CALSCALE"); got != gregorianCalScale {
+		t.Errorf("Expected the tab-folded CALSCALE to read %q, got %q", gregorianCalScale, got)
+	}
+	if got, want := latestModified(data), time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected the folded LAST-MODIFIED to read %v, got %v", want, got)
+	}
+}
+
+// TestWarnOverlongLines tests that an overlong SUMMARY is logged with the
+// request's ID as it is written, as a VEVENT and as a VTODO, once per response,
+// while lines within the limit and unchecked writes are not.
+func TestWarnOverlongLines(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	event := ics.NewEvent("overlong@test")
+	event.SetSummary("Canada Day " + strings.Repeat("celebrations ", 6))
+	event.SetLocation("Ottawa")
+	event.SetAllDayStartAt(time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC))
+	ctx := withRequestID(context.Background(), "trace-123")
+	serializeEvent(event, "", maxFoldOctets, newLineWarner(ctx, 0))
+	if logs.Len() != 0 {
+		t.Errorf("Expected no check without warn_line_octets, got:\n%s", logs.String())
+	}
+
+	want := `[trace-123] Writing a 97-octet SUMMARY line before folding, over 75: "Canada Day celebrations celebrations cel..."`
+	for _, as := range []string{"", asVTodo} {
+		logs.Reset()
+		warn := newLineWarner(ctx, maxFoldOctets)
+		serializeEvent(event, as, maxFoldOctets, warn)
+		serializeEvent(event, as, maxFoldOctets, warn)
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("as %q: Expected the log to contain %s, got:\n%s", as, want, logs.String())
+		}
+		if got := strings.Count(logs.String(), "before folding"); got != 1 {
+			t.Errorf("as %q: Expected 1 overlong line, got %d:\n%s", as, got, logs.String())
+		}
+	}
+}
+
+// End, fold_test.go
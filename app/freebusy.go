@@ -0,0 +1,124 @@
+// freebusy.go
+// This file contains the VFREEBUSY summary of the aggregate.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// freeBusyTypes lists the FBTYPE values RFC 5545 defines.
+var freeBusyTypes = map[string]bool{"FREE": true, "BUSY": true, "BUSY-UNAVAILABLE": true, "BUSY-TENTATIVE": true}
+
+// freeBusyPeriod is the time an event occupies.
+type freeBusyPeriod struct {
+	start, end time.Time
+}
+
+// parseWindowTime reads a /freebusy window bound, given as an RFC 3339 time or
+// a date meaning midnight UTC.
+//
+// Parameters:
+// - value: The query value.
+//
+// Returns:
+// - The time.
+// - An error if the value is neither form.
+func parseWindowTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// eventPeriod returns the time an event occupies: DTSTART to DTEND, or the
+// whole day for an all-day event without DTEND.
+//
+// Parameters:
+// - event: The event to inspect.
+// - loc: The zone floating times and all-day dates are read in.
+//
+// Returns:
+// - The period.
+// - False if the event has no parsable DTSTART or occupies no time.
+func eventPeriod(event *ics.VEvent, loc *time.Location) (freeBusyPeriod, bool) {
+	start, err := eventStartIn(event, loc)
+	if err != nil {
+		return freeBusyPeriod{}, false
+	}
+	end, err := eventEndIn(event, loc)
+	if err != nil {
+		if len(propertyValue(event, ics.ComponentPropertyDtStart)) != len("20060102") {
+			return freeBusyPeriod{}, false
+		}
+		end = start.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return freeBusyPeriod{}, false
+	}
+	return freeBusyPeriod{start: start, end: end}, true
+}
+
+// freeBusy serves a VFREEBUSY marking the time every selected event occupies
+// within the from and to window as the configured freebusy.fbtype. It accepts
+// the feed selection parameters of aggregateICS.
+func (s *server) freeBusy(c *gin.Context) {
+	from, err := parseWindowTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time or a date"})
+		return
+	}
+	to, err := parseWindowTime(c.Query("to"))
+	if err != nil || !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time or a date after from"})
+		return
+	}
+	opts := parseAggregateOptions(c)
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	feedEvents, _, _ := s.collectEvents(c.Request.Context(), opts)
+	var periods []freeBusyPeriod
+	for _, events := range feedEvents {
+		for _, event := range events {
+			period, ok := eventPeriod(event, s.floatingLocation)
+			if !ok || !period.end.After(from) || !period.start.Before(to) {
+				continue
+			}
+			// Periods are clipped to the window the VFREEBUSY covers.
+			if period.start.Before(from) {
+				period.start = from
+			}
+			if period.end.After(to) {
+				period.end = to
+			}
+			periods = append(periods, period)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].start.Before(periods[j].start) })
+
+	const utc = "20060102T150405Z"
+	var b strings.Builder
+	b.WriteString(calendarStart(s.cfg))
+	b.WriteString("BEGIN:VFREEBUSY\r\n")
+	fmt.Fprintf(&b, "UID:freebusy-%s-%s@calendar-feed-aggregator\r\n", from.UTC().Format(utc), to.UTC().Format(utc))
+	fmt.Fprintf(&b, "DTSTAMP:%s\r\n", time.Now().UTC().Format(utc))
+	fmt.Fprintf(&b, "DTSTART:%s\r\n", from.UTC().Format(utc))
+	fmt.Fprintf(&b, "DTEND:%s\r\n", to.UTC().Format(utc))
+	for _, period := range periods {
+		fmt.Fprintf(&b, "FREEBUSY;FBTYPE=%s:%s/%s\r\n", s.cfg.FreeBusy.FBType, period.start.UTC().Format(utc), period.end.UTC().Format(utc))
+	}
+	b.WriteString("END:VFREEBUSY\r\n")
+	b.WriteString(calendarFooter)
+	s.serveCalendar(c, []byte(b.String()))
+}
+
+// End, freebusy.go
@@ -0,0 +1,50 @@
+// freebusy_test.go
+// This file contains tests for the VFREEBUSY summary.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFreeBusy tests that the VFREEBUSY lists a period for each event within
+// the window, typed per freebusy.fbtype.
+func TestFreeBusy(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.FreeBusy.FBType = "FREE"
+	s := newServer(cfg)
+	// All-day dates are floating, so the periods depend on the zone they are read in.
+	s.floatingLocation = time.UTC
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/freebusy?from=2023-01-01&to=2023-07-10")
+	for _, want := range []string{
+		"BEGIN:VFREEBUSY\r\n",
+		"DTSTART:20230101T000000Z\r\nDTEND:20230710T000000Z\r\n",
+		"FREEBUSY;FBTYPE=FREE:20230101T000000Z/20230102T000000Z\r\nFREEBUSY;FBTYPE=FREE:20230101T000000Z/20230102T000000Z\r\n",
+		"FREEBUSY;FBTYPE=FREE:20230701T000000Z/20230702T000000Z\r\nEND:VFREEBUSY\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the VFREEBUSY, got:\n%s", want, body)
+		}
+	}
+	// Colombian Independence Day, on July 20, is outside the window.
+	if got := strings.Count(body, "FREEBUSY;"); got != 3 {
+		t.Errorf("Expected 3 FREEBUSY periods, got %d", got)
+	}
+
+	resp, err := http.Get(srv.URL + "/freebusy?from=2023-07-10&to=2023-01-01")
+	if err != nil {
+		t.Fatalf("Error requesting free/busy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty window, got %d", resp.StatusCode)
+	}
+}
+
+// End, freebusy_test.go
@@ -0,0 +1,149 @@
+// history.go
+// This file contains the content-addressed history of good feed bodies.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// historyEntry is a feed body that parsed successfully, keyed by its hash.
+type historyEntry struct {
+	hash     string
+	body     string
+	storedAt time.Time
+}
+
+// feedHistory keeps the last good bodies of every feed so a client can pin a
+// prior version when an update goes bad.
+type feedHistory struct {
+	mu sync.Mutex
+	// keep is the number of bodies kept per feed; zero or less disables the history.
+	keep    int
+	entries map[string][]historyEntry
+	now     func() time.Time
+}
+
+// newFeedHistory creates an empty history.
+//
+// Parameters:
+// - keep: The number of bodies kept per feed; zero or less disables the history.
+//
+// Returns:
+// - A ready-to-use feedHistory.
+func newFeedHistory(keep int) *feedHistory {
+	return &feedHistory{
+		keep:    keep,
+		entries: map[string][]historyEntry{},
+		now:     time.Now,
+	}
+}
+
+// contentHash returns the hex SHA-256 of a feed body.
+//
+// Parameters:
+// - body: The feed body.
+//
+// Returns:
+// - The lowercase hex digest.
+func contentHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// add records a good body of a feed as its newest version, evicting the
+// oldest once more than keep are stored. A body already in the history moves
+// to the front instead of being stored twice.
+//
+// Parameters:
+// - feed: The name of the feed.
+// - body: The body that parsed successfully.
+func (h *feedHistory) add(feed, body string) {
+	if h.keep <= 0 {
+		return
+	}
+	hash := contentHash(body)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.entries[feed]
+	if len(entries) > 0 && entries[0].hash == hash {
+		return
+	}
+	updated := []historyEntry{{hash: hash, body: body, storedAt: h.now()}}
+	for _, entry := range entries {
+		if entry.hash != hash && len(updated) < h.keep {
+			updated = append(updated, entry)
+		}
+	}
+	h.entries[feed] = updated
+}
+
+// pinned returns the stored body of a feed matching one of the given hashes.
+//
+// Parameters:
+// - feed: The name of the feed.
+// - hashes: The pinned content hashes.
+//
+// Returns:
+// - The pinned body.
+// - True if the feed has a body with one of the hashes.
+func (h *feedHistory) pinned(feed string, hashes []string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, entry := range h.entries[feed] {
+		for _, hash := range hashes {
+			if entry.hash == hash {
+				return entry.body, true
+			}
+		}
+	}
+	return "", false
+}
+
+// has reports whether any feed has a body with the given hash.
+func (h *feedHistory) has(hash string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, entries := range h.entries {
+		for _, entry := range entries {
+			if entry.hash == hash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshotInfo is the /snapshots description of one stored body.
+type snapshotInfo struct {
+	Hash     string    `json:"hash"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// snapshots lists the stored bodies of every feed, newest first, so clients
+// can find the hash to pass as pin.
+func (s *server) snapshots(c *gin.Context) {
+	s.history.mu.Lock()
+	defer s.history.mu.Unlock()
+
+	report := map[string][]snapshotInfo{}
+	for _, feed := range s.cfg.Feeds {
+		infos := []snapshotInfo{}
+		for _, entry := range s.history.entries[feed.Name] {
+			infos = append(infos, snapshotInfo{Hash: entry.hash, StoredAt: entry.storedAt})
+		}
+		report[feed.Name] = infos
+	}
+	c.JSON(http.StatusOK, gin.H{"feeds": report})
+}
+
+// End, history.go
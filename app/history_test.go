@@ -0,0 +1,76 @@
+// history_test.go
+// This file contains tests for pinning feeds to historical snapshots.
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestPinServesOlderSnapshot tests that pinning the hash of an earlier body
+// serves that body's events after the feed has changed.
+func TestPinServesOlderSnapshot(t *testing.T) {
+	var version atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if version.Load() == 0 {
+			io.WriteString(w, mockCanadianCalendar)
+			return
+		}
+		io.WriteString(w, strings.ReplaceAll(mockCanadianCalendar, "Canada Day", "Broken Day"))
+	}))
+	defer upstream.Close()
+
+	cfg := newTestConfig(t)
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL, Country: "CA"}}
+	s := newServer(cfg)
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	getBody(t, srv.URL+"/aggregate_ics")
+	version.Store(1)
+	if body := getBody(t, srv.URL+"/aggregate_ics?nocache=true"); !strings.Contains(body, "Broken Day") {
+		t.Fatalf("Expected the updated feed to be served")
+	}
+
+	older := contentHash(mockCanadianCalendar)
+	if _, ok := s.history.pinned("Canada", []string{older}); !ok {
+		t.Fatalf("Expected the history to hold the first snapshot")
+	}
+	body := getBody(t, srv.URL+"/aggregate_ics?pin="+older)
+	if !strings.Contains(body, "Canada Day") || strings.Contains(body, "Broken Day") {
+		t.Errorf("Expected the pinned snapshot's events, got:\n%s", body)
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics?pin=" + contentHash("unknown"))
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown pin, got %d", resp.StatusCode)
+	}
+}
+
+// TestFeedHistoryKeepsLastK tests that only the newest bodies are kept.
+func TestFeedHistoryKeepsLastK(t *testing.T) {
+	h := newFeedHistory(2)
+	h.add("Canada", "one")
+	h.add("Canada", "two")
+	h.add("Canada", "one")
+	h.add("Canada", "three")
+
+	if _, ok := h.pinned("Canada", []string{contentHash("two")}); ok {
+		t.Errorf("Expected the oldest body to be evicted")
+	}
+	for _, body := range []string{"one", "three"} {
+		if _, ok := h.pinned("Canada", []string{contentHash(body)}); !ok {
+			t.Errorf("Expected %q to be kept", body)
+		}
+	}
+}
+
+// End, history_test.go
@@ -0,0 +1,40 @@
+// index.go
+// This file contains the synthetic table-of-contents event.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// indexEventUID identifies the synthetic index event.
+const indexEventUID = "index@calendar-feed-aggregator"
+
+// indexEvent builds an all-day event on the given day whose DESCRIPTION lists
+// how many events each feed contributed to the aggregate.
+//
+// Parameters:
+// - feeds: The aggregated feeds, in configured order.
+// - counts: The number of events served from each feed, parallel to feeds.
+// - now: The current time, which determines the event's date.
+//
+// Returns:
+// - The index event.
+func indexEvent(feeds []FeedConfig, counts []int, now time.Time) *ics.VEvent {
+	lines := make([]string, len(feeds))
+	for i, feed := range feeds {
+		lines[i] = fmt.Sprintf("%s: %d events", feed.Name, counts[i])
+	}
+
+	event := ics.NewEvent(indexEventUID)
+	event.SetDtStampTime(now)
+	event.SetAllDayStartAt(now)
+	event.SetSummary("Calendar index")
+	event.SetDescription(strings.Join(lines, "\n"))
+	return event
+}
+
+// End, index.go
@@ -0,0 +1,95 @@
+// jsonfeed.go
+// This file contains the JSON Feed rendering of the aggregate.
+package main
+
+import (
+	"net/http"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// jsonFeedVersion is the JSON Feed version URL the output declares.
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// jsonFeed is a JSON Feed 1.1 document.
+type jsonFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+// jsonFeedItem is a JSON Feed item describing one event.
+type jsonFeedItem struct {
+	// ID is the event's UID, or its feed, SUMMARY, and date when it has none.
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	// ContentText is the DESCRIPTION, or the SUMMARY since JSON Feed requires content.
+	ContentText string `json:"content_text"`
+	// DatePublished is the DTSTART in RFC 3339 form.
+	DatePublished string `json:"date_published,omitempty"`
+}
+
+// jsonFeedItemFor describes an event as a JSON Feed item.
+//
+// Parameters:
+// - feed: The feed the event came from.
+// - event: The event to describe.
+//
+// Returns:
+// - The item.
+func jsonFeedItemFor(feed FeedConfig, event *ics.VEvent) jsonFeedItem {
+	item := jsonFeedItem{
+		ID:          event.Id(),
+		Title:       propertyValue(event, ics.ComponentPropertySummary),
+		ContentText: propertyValue(event, ics.ComponentPropertyDescription),
+	}
+	if item.ID == "" {
+		item.ID = feed.Name + "|" + dedupStrategies[dedupKeySummaryDate].key(event)
+	}
+	if item.ContentText == "" {
+		item.ContentText = item.Title
+	}
+	if start, err := eventStart(event); err == nil {
+		item.DatePublished = start.Format(time.RFC3339)
+	}
+	return item
+}
+
+// aggregateJSONFeed serves the aggregate as a JSON Feed, with items ordered by
+// DTSTART. It accepts the feed selection parameters of aggregateICS and, like
+// it, fails with a 502 in strict mode.
+func (s *server) aggregateJSONFeed(c *gin.Context) {
+	opts := parseAggregateOptions(c)
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	feedEvents, warnings, errs := s.collectEvents(c.Request.Context(), opts)
+	if s.cfg.Strict {
+		if err := s.strictFailure(warnings, errs); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if s.cfg.Dedup.Enabled {
+		feedEvents = dedupEvents(feedEvents, s.cfg.Dedup)
+	}
+	items := map[*ics.VEvent]jsonFeedItem{}
+	for i, events := range feedEvents {
+		for _, event := range events {
+			items[event] = jsonFeedItemFor(s.cfg.Feeds[i], event)
+		}
+	}
+
+	doc := jsonFeed{Version: jsonFeedVersion, Title: "Calendar Feed Aggregator", Items: []jsonFeedItem{}}
+	for _, event := range orderEvents(feedEvents, s.cfg.Sort.Concurrency, sortByStart) {
+		doc.Items = append(doc.Items, items[event])
+	}
+	c.Header("Content-Type", "application/feed+json; charset=utf-8")
+	c.JSON(http.StatusOK, doc)
+}
+
+// End, jsonfeed.go
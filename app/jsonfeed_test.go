@@ -0,0 +1,55 @@
+// jsonfeed_test.go
+// This file contains tests for the JSON Feed output.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAggregateJSONFeed tests that the JSON Feed declares version 1.1 and maps
+// every event to an item in DTSTART order.
+func TestAggregateJSONFeed(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, strings.Replace(mockCanadianCalendar, "SUMMARY:Canada Day", "UID:canada-day@example.com\nSUMMARY:Canada Day\nDESCRIPTION:Fireworks at night", 1)).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/aggregate.jsonfeed")
+	if err != nil {
+		t.Fatalf("Error requesting JSON Feed: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/feed+json") {
+		t.Errorf("Expected Content-Type application/feed+json, got %q", got)
+	}
+	var doc jsonFeed
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("Error decoding JSON Feed: %v", err)
+	}
+
+	if doc.Version != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("Expected version https://jsonfeed.org/version/1.1, got %q", doc.Version)
+	}
+	var titles []string
+	for _, item := range doc.Items {
+		titles = append(titles, item.Title)
+	}
+	want := "Colombian New Year, Canadian New Year, Canada Day, Colombian Independence Day"
+	if got := strings.Join(titles, ", "); got != want {
+		t.Fatalf("Expected items %s, got %s", want, got)
+	}
+
+	day := doc.Items[2]
+	if day.ID != "canada-day@example.com" || day.ContentText != "Fireworks at night" || day.DatePublished != "2023-07-01T00:00:00Z" {
+		t.Errorf("Expected Canada Day mapped from UID, DESCRIPTION, and DTSTART, got %+v", day)
+	}
+	if year := doc.Items[0]; year.ID != "Colombia|colombian new year|20230101" || year.ContentText != "Colombian New Year" {
+		t.Errorf("Expected a derived id and the SUMMARY as content without UID or DESCRIPTION, got %+v", year)
+	}
+}
+
+// End, jsonfeed_test.go
@@ -0,0 +1,40 @@
+// limit.go
+// This file contains the middleware capping the requests served at once.
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitMiddleware serves at most maxInFlight requests at once. Requests beyond
+// the limit are turned away immediately with a 503 and a Retry-After header
+// rather than queued, so that an overload doesn't pile up fetches upstream.
+//
+// Parameters:
+// - maxInFlight: The number of requests served at once; 0 or less is unlimited.
+// - retryAfterSeconds: The Retry-After sent with rejected requests.
+//
+// Returns:
+// - The middleware.
+func limitMiddleware(maxInFlight, retryAfterSeconds int) gin.HandlerFunc {
+	if maxInFlight <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	slots := make(chan struct{}, maxInFlight)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "too many requests in flight"})
+		}
+	}
+}
+
+// End, limit.go
@@ -0,0 +1,63 @@
+// limit_test.go
+// This file contains tests for the in-flight request limit.
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestLimitMiddleware tests that requests over the in-flight limit get a 503
+// with Retry-After while the ones within it are served.
+func TestLimitMiddleware(t *testing.T) {
+	const limit, requests = 2, 5
+
+	// The upstream holds every fetch until released, keeping requests in flight.
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Limit = LimitConfig{MaxInFlight: limit, RetryAfterSeconds: 7}
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL, Country: "CA"}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	type result struct {
+		status     int
+		retryAfter string
+	}
+	results := make(chan result, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			resp, err := http.Get(srv.URL + "/aggregate_ics?nocache=true")
+			if err != nil {
+				results <- result{}
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			results <- result{resp.StatusCode, resp.Header.Get("Retry-After")}
+		}()
+	}
+
+	// Only the requests over the limit can finish while the upstream is held.
+	for i := 0; i < requests-limit; i++ {
+		if got := <-results; got.status != http.StatusServiceUnavailable || got.retryAfter != "7" {
+			t.Errorf("Expected status 503 with Retry-After 7, got %d with %q", got.status, got.retryAfter)
+		}
+	}
+	close(release)
+	for i := 0; i < limit; i++ {
+		if got := <-results; got.status != http.StatusOK {
+			t.Errorf("Expected status 200 within the limit, got %d", got.status)
+		}
+	}
+}
+
+// End, limit_test.go
@@ -3,17 +3,16 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"sort"
 	"strings"
-	"sync"
 
 	ics "github.com/arran4/golang-ical"
-	"github.com/gin-gonic/gin"
-
-	"two-feeds-to-one/fetcher"
 )
 
 const (
@@ -159,41 +158,36 @@ func mainVersion1() {
 	printCalendarSummary(combinedCalData)
 }
 
-// aggregateICS handles the aggregation of ICS files and streams the combined events.
-func aggregateICS(c *gin.Context) {
-	icsURLs := []string{ColombianHolidaysURL, CanadianHolidaysURL}
-	eventChan := make(chan string)
-	var wg sync.WaitGroup
-
-	// Fetch calendars concurrently
-	for _, url := range icsURLs {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			fetcher.FetchICS(url, eventChan)
-		}(url)
-	}
-
-	// Close the channel once all goroutines are done
-	go func() {
-		wg.Wait()
-		close(eventChan)
-	}()
-
-	// Stream events to the client
-	c.Stream(func(w io.Writer) bool {
-		if event, ok := <-eventChan; ok {
-			c.Writer.Write([]byte(event))
-			return true
+// main loads the configuration and serves the aggregation endpoints.
+func main() {
+	configPath := flag.String("config", "conf.yaml", "path to the configuration file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	var manifest []FeedConfig
+	if cfg.FeedsManifestURL != "" {
+		// Until the manifest loads, the feeds setting is served.
+		if next, feeds, err := manifestConfig(context.Background(), cfg); err != nil {
+			log.Printf("Error loading the feeds manifest: %v", err)
+		} else {
+			cfg, manifest = next, feeds
 		}
-		return false
-	})
-}
+	}
 
-func main() {
-	r := gin.Default()
-	r.GET("/aggregate_ics", aggregateICS)
-	r.Run(":8080")
+	// The live router runs the background refresher, if enabled.
+	s := newServer(cfg)
+	live := newLiveRouter(s, manifest)
+	if cfg.FeedsManifestURL != "" && cfg.FeedsManifestRefreshSeconds > 0 {
+		go live.runManifestRefresher(context.Background())
+	}
+	httpServer := s.httpServer(live)
+	if err := httpServer.ListenAndServe(); err != nil {
+		log.Fatalf("Error running server: %v", err)
+	}
 }
 
 // End, main.go
@@ -0,0 +1,243 @@
+// manifest.go
+// This file contains the remote feeds manifest, which defines the feeds
+// instead of the feeds setting and is refreshed periodically.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appliedmedia/calendar-feed-aggregator/fetcher"
+)
+
+// manifestEntry is a feed as listed by the feeds manifest.
+type manifestEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// loadManifest fetches the feeds manifest, a JSON array of objects naming
+// each feed and its URL. A manifest fetched over http or https may only list
+// http and https feeds, so that whoever serves it can't have local files read.
+//
+// Parameters:
+// - ctx: The context governing the fetch.
+// - manifestURL: The location of the manifest.
+//
+// Returns:
+// - The feeds the manifest lists, in its order.
+// - An error if the manifest could not be fetched or is invalid.
+func loadManifest(ctx context.Context, manifestURL string) ([]FeedConfig, error) {
+	body, err := fetcher.Fetch(ctx, fetcher.Request{URL: manifestURL})
+	if err != nil {
+		return nil, err
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		return nil, fmt.Errorf("parsing the feeds manifest: %w", err)
+	}
+	remote := false
+	if u, err := url.Parse(manifestURL); err == nil {
+		remote = u.Scheme == "http" || u.Scheme == "https"
+	}
+	feeds := make([]FeedConfig, 0, len(entries))
+	for i, entry := range entries {
+		if entry.Name == "" || entry.URL == "" {
+			return nil, fmt.Errorf("feeds manifest entry %d must have a name and a url", i)
+		}
+		if u, err := url.Parse(entry.URL); remote && (err != nil || (u.Scheme != "http" && u.Scheme != "https")) {
+			return nil, fmt.Errorf("feeds manifest entry %d: a remote manifest may only list http and https URLs, got %q", i, redactURL(entry.URL))
+		}
+		feeds = append(feeds, FeedConfig{Name: entry.Name, URL: entry.URL})
+	}
+	return feeds, nil
+}
+
+// manifestConfig loads the feeds manifest and applies it to cfg.
+//
+// Parameters:
+// - ctx: The context governing the fetch.
+// - cfg: The configuration naming the manifest.
+//
+// Returns:
+// - A copy of cfg serving the manifest's feeds.
+// - The feeds as listed by the manifest.
+// - An error if the manifest could not be loaded or its feeds are invalid.
+func manifestConfig(ctx context.Context, cfg *Config) (*Config, []FeedConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.HTTPTimeoutSeconds*float64(time.Second)))
+	defer cancel()
+	feeds, err := loadManifest(ctx, cfg.FeedsManifestURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err := cfg.withFeeds(feeds)
+	if err != nil {
+		return nil, nil, fmt.Errorf("applying the feeds manifest: %w", err)
+	}
+	return next, feeds, nil
+}
+
+// withFeeds returns a copy of the configuration serving the given feeds, checked
+// as loadConfig checks the feeds setting.
+//
+// Parameters:
+// - feeds: The feeds to serve.
+//
+// Returns:
+// - The new configuration.
+// - An error if the feeds are invalid, e.g. a collection names a missing feed.
+func (cfg *Config) withFeeds(feeds []FeedConfig) (*Config, error) {
+	next := *cfg
+	next.Feeds = feeds
+	if err := next.dedupeFeeds(); err != nil {
+		return nil, err
+	}
+	if err := next.validate(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// successor creates a server for cfg that carries over the live fetched data,
+// trackers, and stale state of s, so that replacing the feeds neither starts
+// from a cold cache nor rereads the persisted one over newer entries, and an
+// outage keeps being served from the last good data.
+//
+// Parameters:
+// - cfg: The configuration of the new server.
+//
+// Returns:
+// - The new server, ready if s was.
+func (s *server) successor(cfg *Config) *server {
+	next := buildServer(cfg)
+	next.cache = s.cache
+	next.history = s.history
+	next.sequences = s.sequences
+	next.changes = s.changes
+	next.fetches = s.fetches
+	next.ready.Store(s.ready.Load() || cfg.Refresh.IntervalSeconds == 0)
+	if good, ok := s.lastGood.Load().(map[string]string); ok {
+		next.lastGood.Store(good)
+	}
+	next.refreshFailed.Store(s.refreshFailed.Load())
+	return next
+}
+
+// liveRouter serves every request with the router of the current server. The
+// manifest refresher installs a new server when the manifest's feeds change,
+// while requests in flight finish on the one they started with.
+type liveRouter struct {
+	// mu serializes installs.
+	mu sync.Mutex
+	// server is the current server.
+	server *server
+	// manifest is the feeds last loaded from the manifest.
+	manifest []FeedConfig
+	// stop ends the background refresher of the current server.
+	stop context.CancelFunc
+	// handler is the router of the current server, as an http.Handler.
+	handler atomic.Value
+}
+
+// newLiveRouter creates a live router serving s, running its background
+// refresher when one is configured.
+//
+// Parameters:
+// - s: The server to serve first.
+// - manifest: The feeds s serves as listed by the manifest, or nil if it hasn't loaded yet.
+//
+// Returns:
+// - A ready-to-use liveRouter.
+func newLiveRouter(s *server, manifest []FeedConfig) *liveRouter {
+	lr := &liveRouter{}
+	lr.install(s, manifest)
+	return lr
+}
+
+// ServeHTTP serves the request with the current router.
+func (lr *liveRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lr.handler.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// install makes s the current server, moving the background refresher to it.
+//
+// Parameters:
+// - s: The server to serve from now on.
+// - manifest: The feeds s serves as listed by the manifest.
+func (lr *liveRouter) install(s *server, manifest []FeedConfig) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.stop != nil {
+		lr.stop()
+	}
+	lr.server, lr.manifest, lr.stop = s, manifest, nil
+	lr.handler.Store(http.Handler(s.router()))
+	if s.cfg.Refresh.IntervalSeconds > 0 {
+		ctx, stop := context.WithCancel(context.Background())
+		lr.stop = stop
+		go s.runRefresher(ctx)
+	}
+}
+
+// current returns the current server and the manifest feeds it serves.
+func (lr *liveRouter) current() (*server, []FeedConfig) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.server, lr.manifest
+}
+
+// refreshManifest fetches the feeds manifest and, when its feeds differ from
+// the ones served, installs a server for them.
+//
+// Parameters:
+// - ctx: The context governing the fetch.
+//
+// Returns:
+// - An error if the manifest could not be loaded or its feeds are invalid,
+// in which case the current feeds are kept.
+func (lr *liveRouter) refreshManifest(ctx context.Context) error {
+	s, manifest := lr.current()
+	cfg, feeds, err := manifestConfig(ctx, s.cfg)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(feeds, manifest) {
+		return nil
+	}
+	log.Printf("Serving %d feeds from the feeds manifest", len(cfg.Feeds))
+	lr.install(s.successor(cfg), feeds)
+	return nil
+}
+
+// runManifestRefresher reloads the feeds manifest every
+// feeds_manifest_refresh_seconds until ctx is cancelled.
+//
+// Parameters:
+// - ctx: The context governing the refresher.
+func (lr *liveRouter) runManifestRefresher(ctx context.Context) {
+	s, _ := lr.current()
+	interval := time.Duration(s.cfg.FeedsManifestRefreshSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := lr.refreshManifest(ctx); err != nil {
+			log.Printf("Error refreshing the feeds manifest: %v", err)
+		}
+	}
+}
+
+// End, manifest.go
@@ -0,0 +1,106 @@
+// manifest_test.go
+// This file contains tests for the remote feeds manifest.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestFeedsManifest tests that the feeds listed by a manifest replace the
+// configured ones, and that a refreshed manifest's feeds are served next.
+func TestFeedsManifest(t *testing.T) {
+	canada := newFeedServer(t, mockCanadianCalendar)
+	colombia := newFeedServer(t, mockColombianCalendar)
+	var listed atomic.Value
+	listed.Store(`[{"name": "Canada", "url": "` + canada.URL + `"}]`)
+	manifest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(listed.Load().(string)))
+	}))
+	defer manifest.Close()
+
+	cfg := newTestConfig(t)
+	cfg.FeedsManifestURL = manifest.URL
+	cfg, feeds, err := manifestConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Error loading the manifest: %v", err)
+	}
+	live := newLiveRouter(newServer(cfg), feeds)
+	srv := httptest.NewServer(live)
+	defer srv.Close()
+
+	names := func() []string {
+		var list struct {
+			Feeds []struct {
+				Name string `json:"name"`
+			} `json:"feeds"`
+		}
+		if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/feeds")), &list); err != nil {
+			t.Fatalf("Error decoding feeds: %v", err)
+		}
+		var names []string
+		for _, feed := range list.Feeds {
+			names = append(names, feed.Name)
+		}
+		return names
+	}
+	if got := strings.Join(names(), ","); got != "Canada" {
+		t.Errorf("Expected the manifest's Canada feed only, got %s", got)
+	}
+	if body := getBody(t, srv.URL+"/aggregate_ics"); !strings.Contains(body, "SUMMARY:Canada Day") || strings.Contains(body, "Colombian") {
+		t.Errorf("Expected only the manifest feed's events, got:\n%s", body)
+	}
+
+	listed.Store(`[{"name": "Colombia", "url": "` + colombia.URL + `"}, {"name": "Canada", "url": "` + canada.URL + `"}]`)
+	if err := live.refreshManifest(context.Background()); err != nil {
+		t.Fatalf("Error refreshing the manifest: %v", err)
+	}
+	if got := strings.Join(names(), ","); got != "Colombia,Canada" {
+		t.Errorf("Expected the refreshed manifest's feeds, got %s", got)
+	}
+
+	listed.Store(`[{"name": "Passwords", "url": "file:///etc/passwd"}]`)
+	if err := live.refreshManifest(context.Background()); err == nil || !strings.Contains(err.Error(), "http and https") {
+		t.Errorf("Expected a remote manifest listing a file URL to be rejected, got %v", err)
+	}
+
+	listed.Store(`{"name": "Canada"}`)
+	if err := live.refreshManifest(context.Background()); err == nil {
+		t.Errorf("Expected an invalid manifest to be rejected")
+	}
+	if got := strings.Join(names(), ","); got != "Colombia,Canada" {
+		t.Errorf("Expected an invalid manifest to keep the current feeds, got %s", got)
+	}
+}
+
+// TestSuccessorKeepsStaleState tests that a server replacing the feeds during
+// an outage keeps serving the last good data, and keeps the live cache rather
+// than rereading the persisted one.
+func TestSuccessorKeepsStaleState(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Cache.PersistPath = t.TempDir() + "/cache.json"
+	s := newServer(cfg)
+	key := cfg.Feeds[1].request().Key()
+	s.cache.set(key, "previous")
+	if err := s.cache.save(cfg.Cache.PersistPath); err != nil {
+		t.Fatalf("Error persisting the cache: %v", err)
+	}
+	s.cache.set(key, mockCanadianCalendar)
+	s.lastGood.Store(map[string]string{"Canada": mockCanadianCalendar})
+	s.refreshFailed.Store(true)
+
+	next := s.successor(cfg)
+	if body, _ := next.cache.get(key); body != mockCanadianCalendar {
+		t.Errorf("Expected the live cache entry, got %q", body)
+	}
+	if body, ok := next.staleBody(cfg.Feeds[1]); !ok || body != mockCanadianCalendar {
+		t.Errorf("Expected the successor to serve Canada's last good body, got %q (%v)", body, ok)
+	}
+}
+
+// End, manifest_test.go
@@ -0,0 +1,69 @@
+// modified.go
+// This file contains the LAST-MODIFIED tracking behind ?if_modified_since.
+package main
+
+import (
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// lastModifiedLayout is the UTC DATE-TIME form RFC 5545 requires for LAST-MODIFIED.
+const lastModifiedLayout = "20060102T150405Z"
+
+// latestModified returns the newest LAST-MODIFIED of the components in a feed
+// body, read from the unfolded raw data so that no parse is needed.
+//
+// Parameters:
+// - body: The calendar data of the feed.
+//
+// Returns:
+// - The newest LAST-MODIFIED, or the zero time if there is none.
+func latestModified(body string) time.Time {
+	var latest time.Time
+	for _, line := range unfoldLines(body) {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		// Parameters such as VALUE=DATE-TIME follow the name.
+		name, _, _ = strings.Cut(name, ";")
+		if !strings.EqualFold(name, string(ics.ComponentPropertyLastModified)) {
+			continue
+		}
+		modified, err := time.Parse(lastModifiedLayout, strings.TrimSpace(value))
+		if err == nil && modified.After(latest) {
+			latest = modified
+		}
+	}
+	return latest
+}
+
+// unmodifiedSince reports whether no selected feed has changed after since,
+// judged by the LAST-MODIFIED of its cached body. A feed that is not cached, or
+// that has to be fetched for the request, counts as changed.
+//
+// Parameters:
+// - opts: The per-request aggregation settings.
+// - since: The time the client last saw the aggregate.
+//
+// Returns:
+// - True if the client's copy is still current.
+func (s *server) unmodifiedSince(opts aggregateOptions, since time.Time) bool {
+	if opts.bypassCache {
+		return false
+	}
+	for _, feed := range s.cfg.Feeds {
+		if !opts.includesFeed(feed) {
+			continue
+		}
+		modified, ok := s.cache.lastModified(feed.request().Key())
+		if !ok || modified.IsZero() || modified.After(since) {
+			return false
+		}
+	}
+	return true
+}
+
+// End, modified.go
@@ -0,0 +1,258 @@
+// normalize.go
+// This file contains the normalization passes applied to aggregated events.
+package main
+
+import (
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"strconv"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// propertyBusyStatus is the property Outlook reads an event's free/busy status from.
+const propertyBusyStatus ics.ComponentProperty = "X-MICROSOFT-CDO-BUSYSTATUS"
+
+// markFree marks an event as free time for every client family: TRANSP for
+// standards-based clients and X-MICROSOFT-CDO-BUSYSTATUS for Outlook, which
+// ignores TRANSP.
+//
+// Parameters:
+// - event: The event to edit.
+func markFree(event *ics.VEvent) {
+	event.SetTimeTransparency(ics.TransparencyTransparent)
+	event.SetProperty(propertyBusyStatus, "FREE")
+}
+
+const (
+	// priorityKeep leaves PRIORITY untouched.
+	priorityKeep = "keep"
+	// priorityStrip removes PRIORITY.
+	priorityStrip = "strip"
+	// priorityClamp lowers any PRIORITY more urgent than the configured floor to it.
+	priorityClamp = "clamp"
+)
+
+// fixPriority applies the configured policy to an event's PRIORITY. Under
+// "clamp", priorities from 1 (highest) up to floor are set to floor, while 0
+// (undefined), lower priorities, and unparsable values are left alone.
+//
+// Parameters:
+// - event: The event to edit.
+// - policy: One of "keep", "strip", or "clamp".
+// - floor: The most urgent PRIORITY kept under "clamp", from 1 to 9.
+func fixPriority(event *ics.VEvent, policy string, floor int) {
+	switch policy {
+	case priorityStrip:
+		removeProperty(event, ics.ComponentPropertyPriority)
+	case priorityClamp:
+		prop := event.GetProperty(ics.ComponentPropertyPriority)
+		if prop == nil {
+			return
+		}
+		priority, err := strconv.Atoi(strings.TrimSpace(prop.Value))
+		if err == nil && priority > 0 && priority < floor {
+			prop.Value = strconv.Itoa(floor)
+		}
+	}
+}
+
+// setClass gives an event the configured CLASS. Source values are kept unless
+// override is set.
+//
+// Parameters:
+// - event: The event to edit.
+// - class: The CLASS to set; empty leaves the event alone.
+// - override: Whether to replace a CLASS the source already set.
+func setClass(event *ics.VEvent, class string, override bool) {
+	if class == "" || (!override && event.GetProperty(ics.ComponentPropertyClass) != nil) {
+		return
+	}
+	event.SetClass(ics.Classification(class))
+}
+
+// assumeTimezone stamps a TZID on the floating DTSTART and DTEND of an event,
+// for feeds known to publish local times in a single zone. Dates, UTC times,
+// and times already carrying a TZID are left alone.
+//
+// Parameters:
+// - event: The event to edit.
+// - zone: The IANA time zone the floating times are in.
+func assumeTimezone(event *ics.VEvent, zone string) {
+	for _, property := range []ics.ComponentProperty{ics.ComponentPropertyDtStart, ics.ComponentPropertyDtEnd} {
+		prop := event.GetProperty(property)
+		if prop == nil || len(prop.ICalParameters[string(ics.ParameterTzid)]) > 0 {
+			continue
+		}
+		if _, err := time.Parse(floatingLayout, prop.Value); err != nil {
+			continue
+		}
+		prop.ICalParameters[string(ics.ParameterTzid)] = []string{zone}
+	}
+}
+
+// midnightUTCSuffix is the time part of a DATE-TIME at midnight UTC.
+const midnightUTCSuffix = "T000000Z"
+
+// allDayFromMidnight converts an event starting at midnight UTC, and lasting
+// whole days, into an all-day event: DTSTART and any DTEND become VALUE=DATE.
+// Events with a TZID, a time-of-day end, or a DURATION with a time part are
+// left alone as genuinely timed.
+//
+// Parameters:
+// - event: The event to edit.
+//
+// Returns:
+// - True if the event was converted.
+func allDayFromMidnight(event *ics.VEvent) bool {
+	start := event.GetProperty(ics.ComponentPropertyDtStart)
+	if !isMidnightUTC(start) {
+		return false
+	}
+	end := event.GetProperty(ics.ComponentPropertyDtEnd)
+	if end != nil && !isMidnightUTC(end) {
+		return false
+	}
+	if duration := event.GetProperty(ics.ComponentProperty("DURATION")); duration != nil && strings.Contains(duration.Value, "T") {
+		return false
+	}
+
+	for _, prop := range []*ics.IANAProperty{start, end} {
+		if prop == nil {
+			continue
+		}
+		prop.Value = strings.TrimSuffix(prop.Value, midnightUTCSuffix)
+		prop.ICalParameters[string(ics.ParameterValue)] = []string{"DATE"}
+	}
+	return true
+}
+
+// isMidnightUTC reports whether a date property is a plain UTC DATE-TIME at midnight.
+func isMidnightUTC(prop *ics.IANAProperty) bool {
+	if prop == nil || len(prop.ICalParameters[string(ics.ParameterTzid)]) > 0 {
+		return false
+	}
+	date, ok := strings.CutSuffix(prop.Value, midnightUTCSuffix)
+	return ok && len(date) == len("20060102")
+}
+
+const (
+	// valueTypeDate emits a feed's start and end as VALUE=DATE.
+	valueTypeDate = "date"
+	// valueTypeDateTime emits a feed's start and end as DATE-TIMEs.
+	valueTypeDateTime = "datetime"
+)
+
+// forceValueType coerces DTSTART and DTEND to the value type a feed forces.
+// Under "date", a DATE-TIME keeps the date it is written with, in its own zone,
+// and a timed end becomes the exclusive end of the last day it touches; a
+// DURATION with a time part is dropped, leaving a single-day event. Under
+// "datetime", a DATE becomes floating midnight, which assume_tz can still zone.
+//
+// Parameters:
+// - event: The event to edit.
+// - valueType: "date" or "datetime".
+func forceValueType(event *ics.VEvent, valueType string) {
+	start := event.GetProperty(ics.ComponentPropertyDtStart)
+	end := event.GetProperty(ics.ComponentPropertyDtEnd)
+	if valueType == valueTypeDateTime {
+		for _, prop := range []*ics.IANAProperty{start, end} {
+			if prop != nil && len(prop.Value) == len("20060102") {
+				prop.Value += "T000000"
+				delete(prop.ICalParameters, string(ics.ParameterValue))
+			}
+		}
+		return
+	}
+
+	if start == nil || len(start.Value) < len("20060102") {
+		return
+	}
+	startDate, err := time.Parse("20060102", start.Value[:8])
+	if err != nil {
+		return
+	}
+	toDate(start, startDate)
+	if end != nil && len(end.Value) >= len("20060102") {
+		endDate, err := time.Parse("20060102", end.Value[:8])
+		if err != nil {
+			return
+		}
+		// The end of a DATE range is exclusive, so a day the event ends in
+		// after midnight is still part of it.
+		if clock := strings.TrimSuffix(end.Value[8:], "Z"); clock != "" && clock != "T000000" {
+			endDate = endDate.AddDate(0, 0, 1)
+		}
+		if !endDate.After(startDate) {
+			endDate = startDate.AddDate(0, 0, 1)
+		}
+		toDate(end, endDate)
+	}
+	if duration := event.GetProperty(ics.ComponentProperty("DURATION")); duration != nil && strings.Contains(duration.Value, "T") {
+		removeProperty(event, ics.ComponentProperty("DURATION"))
+	}
+}
+
+// toDate rewrites a date property as the VALUE=DATE of the given day.
+func toDate(prop *ics.IANAProperty, day time.Time) {
+	prop.Value = day.Format("20060102")
+	delete(prop.ICalParameters, string(ics.ParameterTzid))
+	prop.ICalParameters[string(ics.ParameterValue)] = []string{"DATE"}
+}
+
+// decodeQuotedPrintable decodes property values carrying the legacy
+// ENCODING=QUOTED-PRINTABLE parameter into UTF-8 and drops the parameter.
+// Values in ISO-8859-1 (per their CHARSET parameter) are converted as well;
+// every decoded or undecodable value is a warning, and undecodable values are
+// left as they are.
+//
+// Parameters:
+// - ctx: The context of the request being served, used for warnings.
+// - event: The event to edit.
+func decodeQuotedPrintable(ctx context.Context, event *ics.VEvent) {
+	for i := range event.Properties {
+		prop := &event.Properties[i]
+		encoding := prop.ICalParameters[string(ics.ParameterEncoding)]
+		if len(encoding) != 1 || !strings.EqualFold(encoding[0], "QUOTED-PRINTABLE") {
+			continue
+		}
+
+		warnf(ctx, "Event %q uses the deprecated ENCODING=QUOTED-PRINTABLE for %s", propertyValue(event, ics.ComponentPropertySummary), prop.IANAToken)
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(prop.Value)))
+		if err != nil {
+			warnf(ctx, "Event %q has an undecodable quoted-printable %s: %v", propertyValue(event, ics.ComponentPropertySummary), prop.IANAToken, err)
+			continue
+		}
+		value := string(decoded)
+		if charset := prop.ICalParameters["CHARSET"]; len(charset) == 1 && isLatin1(charset[0]) {
+			value = latin1ToUTF8(decoded)
+		}
+
+		prop.Value = value
+		delete(prop.ICalParameters, string(ics.ParameterEncoding))
+		delete(prop.ICalParameters, "CHARSET")
+	}
+}
+
+// isLatin1 reports whether a CHARSET parameter names ISO-8859-1.
+func isLatin1(charset string) bool {
+	switch strings.ToUpper(charset) {
+	case "ISO-8859-1", "LATIN1":
+		return true
+	}
+	return false
+}
+
+// latin1ToUTF8 converts ISO-8859-1 bytes, where every byte is a code point, to UTF-8.
+func latin1ToUTF8(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// End, normalize.go
@@ -0,0 +1,185 @@
+// normalize_test.go
+// This file contains tests for the event normalization passes.
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestMarkFree tests that events are marked free for Outlook and standard clients.
+func TestMarkFree(t *testing.T) {
+	event := parseMockEvent(t, strings.Replace(mockCanadianCalendar, "SUMMARY:Canadian New Year", "SUMMARY:Canadian New Year\nX-MICROSOFT-CDO-BUSYSTATUS:BUSY", 1))
+	markFree(event)
+
+	if got := propertyValue(event, propertyBusyStatus); got != "FREE" {
+		t.Errorf("Expected X-MICROSOFT-CDO-BUSYSTATUS FREE, got %q", got)
+	}
+	if got := propertyValue(event, ics.ComponentPropertyTransp); got != "TRANSPARENT" {
+		t.Errorf("Expected TRANSP TRANSPARENT, got %q", got)
+	}
+	if !strings.Contains(event.Serialize(), "X-MICROSOFT-CDO-BUSYSTATUS:FREE\r\n") {
+		t.Errorf("Expected a single serialized FREE busy status, got:\n%s", event.Serialize())
+	}
+	if strings.Contains(event.Serialize(), "BUSYSTATUS:BUSY") {
+		t.Errorf("Expected the source BUSY status to be replaced")
+	}
+}
+
+// TestFixPriority tests that PRIORITY is kept, stripped, or clamped per policy.
+func TestFixPriority(t *testing.T) {
+	tests := []struct {
+		policy   string
+		priority string
+		want     string
+	}{
+		{priorityKeep, "1", "1"},
+		{priorityStrip, "1", ""},
+		{priorityClamp, "1", "5"},
+		{priorityClamp, "5", "5"},
+		{priorityClamp, "8", "8"},
+		{priorityClamp, "0", "0"},
+	}
+	for _, tt := range tests {
+		event := parseMockEvent(t, strings.Replace(mockCanadianCalendar, "SUMMARY:Canadian New Year", "SUMMARY:Canadian New Year\nPRIORITY:"+tt.priority, 1))
+		fixPriority(event, tt.policy, 5)
+		if got := propertyValue(event, ics.ComponentPropertyPriority); got != tt.want {
+			t.Errorf("%s of PRIORITY %s: expected %q, got %q", tt.policy, tt.priority, tt.want, got)
+		}
+	}
+}
+
+// TestSetClass tests that CLASS is added to events lacking one and replaces
+// source values only when overriding.
+func TestSetClass(t *testing.T) {
+	tests := []struct {
+		source   string
+		override bool
+		want     string
+	}{
+		{"", false, "PUBLIC"},
+		{"PRIVATE", false, "PRIVATE"},
+		{"PRIVATE", true, "PUBLIC"},
+	}
+	for _, tt := range tests {
+		calendar := mockCanadianCalendar
+		if tt.source != "" {
+			calendar = strings.Replace(calendar, "SUMMARY:Canadian New Year", "SUMMARY:Canadian New Year\nCLASS:"+tt.source, 1)
+		}
+		event := parseMockEvent(t, calendar)
+		setClass(event, "PUBLIC", tt.override)
+		if got := propertyValue(event, ics.ComponentPropertyClass); got != tt.want {
+			t.Errorf("CLASS %q with override %v: expected %q, got %q", tt.source, tt.override, tt.want, got)
+		}
+	}
+}
+
+// TestAssumeTimezone tests that floating times gain the assumed TZID while
+// UTC times, dates, and zoned times are left alone.
+func TestAssumeTimezone(t *testing.T) {
+	tests := []struct {
+		start string
+		want  string
+	}{
+		{"DTSTART:20230101T090000", "DTSTART;TZID=America/Bogota:20230101T090000\r\n"},
+		{"DTSTART:20230101T090000Z", "DTSTART:20230101T090000Z\r\n"},
+		{"DTSTART;VALUE=DATE:20230101", "DTSTART;VALUE=DATE:20230101\r\n"},
+		{"DTSTART;TZID=America/Toronto:20230101T090000", "DTSTART;TZID=America/Toronto:20230101T090000\r\n"},
+	}
+	for _, tt := range tests {
+		event := parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:New Year\n"+tt.start+"\nEND:VEVENT\nEND:VCALENDAR\n")
+		assumeTimezone(event, "America/Bogota")
+		if got := event.Serialize(); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: expected %q, got:\n%s", tt.start, tt.want, got)
+		}
+	}
+}
+
+// TestForceValueType tests that a feed forcing date turns timed events into
+// all-day ones covering the days they touch, and one forcing datetime turns
+// dates into floating midnight.
+func TestForceValueType(t *testing.T) {
+	tests := []struct {
+		valueType string
+		dates     string
+		want      []string
+	}{
+		{valueTypeDate, "DTSTART:20230701T090000Z\nDTEND:20230701T170000Z", []string{"DTSTART;VALUE=DATE:20230701\r\n", "DTEND;VALUE=DATE:20230702\r\n"}},
+		{valueTypeDate, "DTSTART;TZID=America/Toronto:20230701T220000\nDTEND;TZID=America/Toronto:20230703T000000", []string{"DTSTART;VALUE=DATE:20230701\r\n", "DTEND;VALUE=DATE:20230703\r\n"}},
+		{valueTypeDate, "DTSTART:20230701T090000\nDURATION:PT8H", []string{"DTSTART;VALUE=DATE:20230701\r\n"}},
+		{valueTypeDate, "DTSTART;VALUE=DATE:20230701", []string{"DTSTART;VALUE=DATE:20230701\r\n"}},
+		{valueTypeDateTime, "DTSTART;VALUE=DATE:20230701\nDTEND;VALUE=DATE:20230702", []string{"DTSTART:20230701T000000\r\n", "DTEND:20230702T000000\r\n"}},
+		{valueTypeDateTime, "DTSTART:20230701T090000Z", []string{"DTSTART:20230701T090000Z\r\n"}},
+	}
+	for _, tt := range tests {
+		event := parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:Canada Day\n"+tt.dates+"\nEND:VEVENT\nEND:VCALENDAR\n")
+		forceValueType(event, tt.valueType)
+		got := event.Serialize()
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s %q: expected %q, got:\n%s", tt.valueType, tt.dates, want, got)
+			}
+		}
+		if strings.Contains(got, "TZID") || strings.Contains(got, "DURATION") {
+			t.Errorf("%s %q: expected no TZID or timed DURATION, got:\n%s", tt.valueType, tt.dates, got)
+		}
+	}
+}
+
+// TestAllDayFromMidnight tests that midnight-UTC events become date-only while
+// timed events are kept.
+func TestAllDayFromMidnight(t *testing.T) {
+	tests := []struct {
+		name      string
+		dates     string
+		converted bool
+		want      string
+	}{
+		{"start only", "DTSTART:20230101T000000Z", true, "DTSTART;VALUE=DATE:20230101\r\n"},
+		{"whole days", "DTSTART:20230101T000000Z\nDTEND:20230102T000000Z", true, "DTEND;VALUE=DATE:20230102\r\n"},
+		{"timed end", "DTSTART:20230101T000000Z\nDTEND:20230101T010000Z", false, "DTSTART:20230101T000000Z\r\n"},
+		{"timed duration", "DTSTART:20230101T000000Z\nDURATION:PT1H", false, "DTSTART:20230101T000000Z\r\n"},
+		{"local time", "DTSTART;TZID=America/Bogota:20230101T000000", false, "DTSTART;TZID=America/Bogota:20230101T000000\r\n"},
+	}
+	for _, tt := range tests {
+		event := parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:New Year\n"+tt.dates+"\nEND:VEVENT\nEND:VCALENDAR\n")
+		if got := allDayFromMidnight(event); got != tt.converted {
+			t.Errorf("%s: expected converted %v, got %v", tt.name, tt.converted, got)
+		}
+		if !strings.Contains(event.Serialize(), tt.want) {
+			t.Errorf("%s: expected %q, got:\n%s", tt.name, tt.want, event.Serialize())
+		}
+	}
+}
+
+// TestDecodeQuotedPrintable tests that quoted-printable values decode to UTF-8.
+func TestDecodeQuotedPrintable(t *testing.T) {
+	event := parseMockEvent(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY;ENCODING=QUOTED-PRINTABLE;CHARSET=UTF-8:D=C3=ADa de la Independencia
+DESCRIPTION;ENCODING=QUOTED-PRINTABLE;CHARSET=ISO-8859-1:F=EAte nationale
+LOCATION:Bogot=C3=A1
+DTSTART;VALUE=DATE:20230720
+END:VEVENT
+END:VCALENDAR`)
+	decodeQuotedPrintable(context.Background(), event)
+
+	if got := propertyValue(event, ics.ComponentPropertySummary); got != "Día de la Independencia" {
+		t.Errorf("Expected decoded UTF-8 summary, got %q", got)
+	}
+	if got := propertyValue(event, ics.ComponentPropertyDescription); got != "Fête nationale" {
+		t.Errorf("Expected decoded ISO-8859-1 description, got %q", got)
+	}
+	if got := propertyValue(event, ics.ComponentPropertyLocation); got != "Bogot=C3=A1" {
+		t.Errorf("Expected values without ENCODING to be untouched, got %q", got)
+	}
+	if strings.Contains(event.Serialize(), "QUOTED-PRINTABLE") {
+		t.Errorf("Expected the ENCODING parameter to be dropped, got:\n%s", event.Serialize())
+	}
+}
+
+// End, normalize_test.go
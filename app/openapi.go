@@ -0,0 +1,362 @@
+// openapi.go
+// This file contains the OpenAPI description of the HTTP API.
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiParam describes a parameter accepted by a route.
+type apiParam struct {
+	Name        string
+	Description string
+	// Type is the OpenAPI schema type of the parameter, e.g. "string" or "boolean".
+	Type     string
+	Required bool
+	// In is where the parameter is passed: "query" when empty, or "path".
+	In string
+}
+
+// apiRoute describes a route for the OpenAPI document.
+type apiRoute struct {
+	// Path is the route as registered with gin, e.g. "/collection/:name".
+	Path string
+	// Method is the HTTP method of the route; GET when empty.
+	Method  string
+	Summary string
+	// RequestType is the media type of the request body; "" takes none.
+	RequestType string
+	// ContentType is the media type of a successful response.
+	ContentType string
+	Params      []apiParam
+	// Errors maps the route's error statuses to their descriptions.
+	Errors map[int]string
+}
+
+// apiRoutes lists the routes served by the router, in the order they are documented.
+var apiRoutes = []apiRoute{
+	{
+		Path:        "/robots.txt",
+		Summary:     "Asks crawlers not to index any path, unless noindex is off.",
+		ContentType: "text/plain",
+	},
+	{
+		Path:        "/healthz",
+		Summary:     "Reports that the process is alive.",
+		ContentType: "application/json",
+	},
+	{
+		Path:        "/readyz",
+		Summary:     "Reports whether the server is ready to serve warm data.",
+		ContentType: "application/json",
+		Errors:      map[int]string{http.StatusServiceUnavailable: "The first refresh has not completed."},
+	},
+	{
+		Path:        "/aggregate_ics",
+		Summary:     "Streams the events of every feed as a single iCalendar file.",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+			{Name: "country", Description: "Comma-separated country codes whose events are kept.", Type: "string"},
+			{Name: "sort", Description: "Set to start to order events by DTSTART instead of arrival, or to summary to order them alphabetically by SUMMARY, then DTSTART.", Type: "string"},
+			{Name: "as", Description: "Set to vtodo to output each event as a VTODO due on its start date, or vjournal as a VJOURNAL dated on it.", Type: "string"},
+			{Name: "feed", Description: "Comma-separated names of the feeds to serve.", Type: "string"},
+			{Name: "warnings", Description: "Set to header to report the parse warning count in X-Parse-Warnings.", Type: "string"},
+			{Name: "pin", Description: "Comma-separated content hashes of feed versions to serve from the history.", Type: "string"},
+			{Name: "from", Description: "Keep events ending after this RFC 3339 time or date.", Type: "string"},
+			{Name: "to", Description: "Keep events starting before this RFC 3339 time or date.", Type: "string"},
+			{Name: "weekday", Description: "Comma-separated days of the week, e.g. monday, whose events are kept.", Type: "string"},
+			{Name: "location", Description: "Keep events whose LOCATION contains this text, ignoring case.", Type: "string"},
+			{Name: "only", Description: "Comma-separated SUMMARY names whose events are kept, ignoring case, in place of the configured only list.", Type: "string"},
+			{Name: "if_modified_since", Description: "An RFC 3339 time; answer 304 if no cached feed has a newer LAST-MODIFIED.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusNotModified: "No selected feed was modified since if_modified_since.",
+			http.StatusBadRequest:  "Sort, as, from, to, weekday, or if_modified_since is not supported.",
+			http.StatusNotFound:    "A pinned hash is not in the history.",
+		},
+	},
+	{
+		Path:        "/aggregate/stream",
+		Summary:     "Pushes each event as a Server-Sent Events JSON data frame as its feed loads, then an event: done frame.",
+		ContentType: "text/event-stream",
+		Params: []apiParam{
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+			{Name: "country", Description: "Comma-separated country codes whose events are kept.", Type: "string"},
+			{Name: "feed", Description: "Comma-separated names of the feeds to serve.", Type: "string"},
+		},
+		Errors: map[int]string{http.StatusBadRequest: "A parameter is not supported."},
+	},
+	{
+		Path:        "/aggregate.jsonfeed",
+		Summary:     "Returns the events of every feed as a JSON Feed 1.1, ordered by DTSTART.",
+		ContentType: "application/feed+json",
+		Params: []apiParam{
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+			{Name: "country", Description: "Comma-separated country codes whose events are kept.", Type: "string"},
+			{Name: "feed", Description: "Comma-separated names of the feeds to serve.", Type: "string"},
+		},
+		Errors: map[int]string{http.StatusBadRequest: "A parameter is not supported."},
+	},
+	{
+		Path:        "/aggregate_json",
+		Summary:     "Returns the events of every feed as a JSON object, ordered by DTSTART.",
+		ContentType: "application/json",
+		Params: []apiParam{
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+			{Name: "country", Description: "Comma-separated country codes whose events are kept.", Type: "string"},
+			{Name: "feed", Description: "Comma-separated names of the feeds to serve.", Type: "string"},
+			{Name: "date_format", Description: "How start and end are written: rfc3339 (the default), unix, or date.", Type: "string"},
+			{Name: "group", Description: "source to map each feed's name to its events instead.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusBadRequest: "A parameter is not supported.",
+			http.StatusBadGateway: "In strict mode, a feed failed or produced warnings.",
+		},
+	},
+	{
+		Path:        "/collection/:name",
+		Summary:     "Streams the events of the feeds in a configured collection as a single iCalendar file.",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "name", Description: "The name of the collection.", Type: "string", Required: true, In: "path"},
+			{Name: "nocache", Description: "Fetch every member feed afresh for this request.", Type: "boolean"},
+			{Name: "country", Description: "Comma-separated country codes whose events are kept.", Type: "string"},
+			{Name: "sort", Description: "Set to start to order events by DTSTART instead of arrival, or to summary to order them alphabetically by SUMMARY, then DTSTART.", Type: "string"},
+			{Name: "as", Description: "Set to vtodo to output each event as a VTODO due on its start date, or vjournal as a VJOURNAL dated on it.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusBadRequest: "Sort or as is not supported.",
+			http.StatusNotFound:   "No collection has that name.",
+		},
+	},
+	{
+		Path:        "/f/:slug",
+		Summary:     "Streams the events of the feed with a URL slug, such as canada, as an iCalendar file.",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "slug", Description: "The feed's name, lowercased with dashes for other characters.", Type: "string", Required: true, In: "path"},
+			{Name: "nocache", Description: "Fetch the feed afresh for this request.", Type: "boolean"},
+			{Name: "sort", Description: "Set to start to order events by DTSTART instead of arrival, or to summary to order them alphabetically by SUMMARY, then DTSTART.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusBadRequest: "Sort is not supported.",
+			http.StatusNotFound:   "No feed has that slug.",
+		},
+	},
+	{
+		Path:        "/c/:slug",
+		Summary:     "Streams the events of the collection with a URL slug as a single iCalendar file.",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "slug", Description: "The collection's name, lowercased with dashes for other characters.", Type: "string", Required: true, In: "path"},
+			{Name: "nocache", Description: "Fetch every member feed afresh for this request.", Type: "boolean"},
+			{Name: "sort", Description: "Set to start to order events by DTSTART instead of arrival, or to summary to order them alphabetically by SUMMARY, then DTSTART.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusBadRequest: "Sort is not supported.",
+			http.StatusNotFound:   "No collection has that slug.",
+		},
+	},
+	{
+		Path:        "/freebusy",
+		Summary:     "Returns a VFREEBUSY marking the time of every event within a window.",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "from", Description: "The start of the window, as an RFC 3339 time or a date.", Type: "string", Required: true},
+			{Name: "to", Description: "The end of the window, as an RFC 3339 time or a date.", Type: "string", Required: true},
+			{Name: "country", Description: "Comma-separated country codes whose events are kept.", Type: "string"},
+			{Name: "feed", Description: "Comma-separated names of the feeds to include.", Type: "string"},
+		},
+		Errors: map[int]string{http.StatusBadRequest: "From or to is missing or invalid."},
+	},
+	{
+		Path:        "/transform",
+		Summary:     "Fetches any feed on the proxy allowlist and serves it with the selected transforms applied.",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "url", Description: "The URL of the feed; its host must be in proxy.allowed_hosts.", Type: "string", Required: true},
+			{Name: "prefix", Description: "A prefix added to every SUMMARY.", Type: "string"},
+			{Name: "categories", Description: "Comma-separated categories added to every event.", Type: "string"},
+			{Name: "strip_alarms", Description: "Remove every VALARM.", Type: "boolean"},
+			{Name: "transp", Description: "Set TRANSP to OPAQUE or TRANSPARENT.", Type: "string"},
+			{Name: "mark_free", Description: "Mark every event as free time.", Type: "boolean"},
+			{Name: "tz", Description: "An IANA time zone UTC start and end times are converted to.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusBadRequest: "Url is missing or a transform parameter is invalid.",
+			http.StatusForbidden:  "The URL's scheme or host is not allowed.",
+			http.StatusBadGateway: "The feed could not be fetched or parsed.",
+		},
+	},
+	{
+		Path:        "/diff",
+		Summary:     "Compares two feeds, matching events as dedup.key does.",
+		ContentType: "application/json",
+		Params: []apiParam{
+			{Name: "a", Description: "The name of the first feed.", Type: "string", Required: true},
+			{Name: "b", Description: "The name of the second feed.", Type: "string", Required: true},
+		},
+		Errors: map[int]string{
+			http.StatusNotFound:   "A or b does not name a configured feed.",
+			http.StatusBadGateway: "A feed could not be fetched.",
+		},
+	},
+	{
+		Path:        "/feeds",
+		Summary:     "Lists the configured feeds and whether each is enabled.",
+		ContentType: "application/json",
+	},
+	{
+		Path:        "/warnings",
+		Summary:     "Lists the non-fatal parse warnings of each feed.",
+		ContentType: "application/json",
+		Params: []apiParam{
+			{Name: "feed", Description: "Comma-separated names of the feeds to check.", Type: "string"},
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+		},
+	},
+	{
+		Path:        "/summaries",
+		Summary:     "Lists the distinct event summaries across the feeds with their counts.",
+		ContentType: "application/json",
+		Params: []apiParam{
+			{Name: "feed", Description: "Comma-separated names of the feeds to count.", Type: "string"},
+			{Name: "country", Description: "Comma-separated country codes whose events are counted.", Type: "string"},
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+		},
+	},
+	{
+		Path:        "/summary",
+		Summary:     "Summarizes each feed with its event count and a preview sample of its events.",
+		ContentType: "application/json",
+		Params: []apiParam{
+			{Name: "sample", Description: "Set to first, last, or every to preview the first n, the last n, or every nth event; the first, middle, and last by default.", Type: "string"},
+			{Name: "n", Description: "The number of events, or the step for every; 3 by default.", Type: "integer"},
+			{Name: "feed", Description: "Comma-separated names of the feeds to summarize.", Type: "string"},
+			{Name: "nocache", Description: "Fetch every feed afresh for this request.", Type: "boolean"},
+		},
+	},
+	{
+		Path:        "/snapshots",
+		Summary:     "Lists the content hashes of the feed versions kept for pinning.",
+		ContentType: "application/json",
+	},
+	{
+		Path:        "/openapi.json",
+		Summary:     "Returns this OpenAPI document.",
+		ContentType: "application/json",
+	},
+	{
+		Path:        "/config",
+		Summary:     "Returns the effective configuration with its secrets redacted, when config_token is set.",
+		ContentType: "application/json",
+		Errors: map[int]string{
+			http.StatusUnauthorized: "The request lacks the config_token bearer token.",
+		},
+	},
+	{
+		Path:        "/preview",
+		Method:      http.MethodPost,
+		Summary:     "Runs a posted VEVENT or small calendar through the configured passes and transforms without fetching, unless preview is off.",
+		RequestType: "text/calendar",
+		ContentType: "text/calendar",
+		Params: []apiParam{
+			{Name: "feed", Description: "The name of the feed whose settings are applied.", Type: "string"},
+		},
+		Errors: map[int]string{
+			http.StatusBadRequest:            "The content could not be parsed.",
+			http.StatusNotFound:              "No feed has the given name.",
+			http.StatusRequestEntityTooLarge: "The content is larger than 1 MiB.",
+		},
+	},
+}
+
+// openAPIDocument builds the OpenAPI 3 document describing apiRoutes.
+//
+// Returns:
+// - The document, ready to be encoded as JSON.
+func openAPIDocument() gin.H {
+	paths := gin.H{}
+	for _, route := range apiRoutes {
+		params := []gin.H{}
+		for _, param := range route.Params {
+			in := param.In
+			if in == "" {
+				in = "query"
+			}
+			params = append(params, gin.H{
+				"name":        param.Name,
+				"in":          in,
+				"description": param.Description,
+				"required":    param.Required,
+				"schema":      gin.H{"type": param.Type},
+			})
+		}
+
+		responses := gin.H{
+			"200": gin.H{
+				"description": "OK",
+				"content":     gin.H{route.ContentType: gin.H{}},
+			},
+		}
+		for status, description := range route.Errors {
+			responses[strconv.Itoa(status)] = gin.H{"description": description}
+		}
+
+		operation := gin.H{
+			"summary":    route.Summary,
+			"parameters": params,
+			"responses":  responses,
+		}
+		if route.RequestType != "" {
+			operation["requestBody"] = gin.H{
+				"required": true,
+				"content":  gin.H{route.RequestType: gin.H{}},
+			}
+		}
+		method := route.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		paths[openAPIPath(route.Path)] = gin.H{strings.ToLower(method): operation}
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "Calendar Feed Aggregator",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+	}
+}
+
+// openAPIPath converts a gin route to an OpenAPI path template, turning
+// ":name" segments into "{name}".
+//
+// Parameters:
+// - path: The route as registered with gin.
+//
+// Returns:
+// - The OpenAPI path.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPI serves the OpenAPI document describing the HTTP API.
+func (s *server) openAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPIDocument())
+}
+
+// End, openapi.go
@@ -0,0 +1,41 @@
+// openapi_test.go
+// This file contains tests for the OpenAPI document.
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPI tests that the document is valid JSON listing every registered route.
+func TestOpenAPI(t *testing.T) {
+	router := newRouter(newTestConfig(t))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/openapi.json")), &doc); err != nil {
+		t.Fatalf("Error decoding the document: %v", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+	for _, path := range []string{"/aggregate_ics", "/diff"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("Expected the document to list %s", path)
+		}
+	}
+	for _, route := range router.Routes() {
+		if _, ok := doc.Paths[openAPIPath(route.Path)]; !ok {
+			t.Errorf("Expected the document to list the registered route %s", route.Path)
+		}
+	}
+}
+
+// End, openapi_test.go
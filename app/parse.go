@@ -0,0 +1,125 @@
+// parse.go
+// This file contains the concurrent parse of large feed bodies.
+package main
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// splitEvents cuts calendar data at its top-level VEVENT boundaries. It only
+// succeeds for the common layout of a header, a run of VEVENTs, and the end of
+// the calendar; anything else, such as a VTIMEZONE or a calendar property
+// between events, leaves the body to the sequential parser.
+//
+// Parameters:
+// - body: The calendar data of a feed.
+//
+// Returns:
+// - The data before the first VEVENT, including any VTIMEZONEs.
+// - The raw text of each VEVENT, in source order.
+// - Whether the body could be split.
+func splitEvents(body string) (string, []string, bool) {
+	var starts []int
+	depth, end := 0, -1
+	for pos := 0; pos < len(body); {
+		next := len(body)
+		if i := strings.IndexByte(body[pos:], '\n'); i >= 0 {
+			next = pos + i + 1
+		}
+		line := strings.TrimRight(body[pos:next], "\r\n")
+		switch {
+		case strings.HasPrefix(line, "BEGIN:"):
+			if depth == 1 {
+				if line != "BEGIN:VEVENT" && len(starts) > 0 {
+					return "", nil, false
+				}
+				if line == "BEGIN:VEVENT" {
+					starts = append(starts, pos)
+				}
+			}
+			depth++
+		case strings.HasPrefix(line, "END:"):
+			depth--
+			if depth == 1 && line == "END:VEVENT" {
+				end = next
+			}
+		case depth == 1 && len(starts) > 0 && line != "":
+			return "", nil, false
+		}
+		pos = next
+	}
+	if depth != 0 || len(starts) == 0 || starts[len(starts)-1] > end {
+		// Unbalanced, or the last event is cut off before its END.
+		return "", nil, false
+	}
+	events := make([]string, len(starts))
+	for i, start := range starts {
+		stop := end
+		if i+1 < len(starts) {
+			stop = starts[i+1]
+		}
+		events[i] = body[start:stop]
+	}
+	return body[:starts[0]], events, true
+}
+
+// parseCalendar parses a feed body, splitting large ones at VEVENT boundaries
+// and parsing the chunks concurrently. The result matches the sequential
+// parse: bodies that can't be split, or whose chunks fail to parse, are parsed
+// whole so that errors read the same.
+//
+// Parameters:
+// - body: The calendar data of a feed.
+// - cfg: The parse settings.
+//
+// Returns:
+// - The parsed calendar.
+// - An error if the body could not be parsed.
+func parseCalendar(body string, cfg ParseConfig) (*ics.Calendar, error) {
+	concurrency := cfg.Concurrency
+	if concurrency == 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if concurrency == 1 || strings.Count(body, "BEGIN:VEVENT") < cfg.MinEvents {
+		return ics.ParseCalendar(strings.NewReader(body))
+	}
+	header, events, ok := splitEvents(body)
+	if !ok || len(events) < cfg.MinEvents {
+		return ics.ParseCalendar(strings.NewReader(body))
+	}
+
+	cal, err := ics.ParseCalendar(strings.NewReader(header + "END:VCALENDAR\r\n"))
+	if err != nil {
+		return ics.ParseCalendar(strings.NewReader(body))
+	}
+	chunks := make([][]ics.Component, concurrency)
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		lo, hi := i*len(events)/concurrency, (i+1)*len(events)/concurrency
+		wg.Add(1)
+		go func(i int, events []string) {
+			defer wg.Done()
+			chunk, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			chunks[i] = chunk.Components
+		}(i, events[lo:hi])
+	}
+	wg.Wait()
+	for i, components := range chunks {
+		if errs[i] != nil {
+			return ics.ParseCalendar(strings.NewReader(body))
+		}
+		cal.Components = append(cal.Components, components...)
+	}
+	return cal, nil
+}
+
+// End, parse.go
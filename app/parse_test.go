@@ -0,0 +1,98 @@
+// parse_test.go
+// This file contains tests for the concurrent parse of large feed bodies.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// largeFeed builds a calendar of the given number of events, with a VTIMEZONE
+// ahead of them as many real feeds have.
+func largeFeed(events int) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Test//Large//EN\r\n")
+	b.WriteString("BEGIN:VTIMEZONE\r\nTZID:America/Bogota\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0500\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n")
+	for i := 0; i < events; i++ {
+		fmt.Fprintf(&b, "BEGIN:VEVENT\r\nUID:event-%d@test\r\nDTSTAMP:20230101T000000Z\r\nDTSTART;TZID=America/Bogota:20230101T%02d0000\r\nSUMMARY:Event %d\r\nDESCRIPTION:A long description that is folded onto a continuation line because i\r\n t exceeds the limit\r\nBEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\nEND:VEVENT\r\n", i, i%24, i)
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// serializeParsed renders a parsed calendar for comparison, marking the nil
+// events the parser yields for ones cut off before their END.
+func serializeParsed(cal *ics.Calendar) string {
+	var b strings.Builder
+	for _, property := range cal.CalendarProperties {
+		fmt.Fprintf(&b, "%s:%s\n", property.IANAToken, property.Value)
+	}
+	for _, component := range cal.Components {
+		if event, ok := component.(*ics.VEvent); ok && event == nil {
+			b.WriteString("<nil event>\n")
+			continue
+		}
+		b.WriteString((&ics.Calendar{Components: []ics.Component{component}}).Serialize())
+	}
+	return b.String()
+}
+
+// TestParseCalendarConcurrent tests that splitting a feed into concurrently
+// parsed chunks yields the same calendar as parsing it whole, and that bodies
+// that can't be split safely are parsed whole.
+func TestParseCalendarConcurrent(t *testing.T) {
+	concurrent := ParseConfig{Concurrency: 4, MinEvents: 2}
+	interleaved := strings.Replace(largeFeed(3), "BEGIN:VEVENT\r\nUID:event-1@test", "BEGIN:VTODO\r\nUID:todo@test\r\nEND:VTODO\r\nBEGIN:VEVENT\r\nUID:event-1@test", 1)
+	truncated := strings.TrimSuffix(largeFeed(3), "END:VEVENT\r\nEND:VCALENDAR\r\n")
+	for name, body := range map[string]string{
+		"crlf":        largeFeed(101),
+		"lf":          strings.ReplaceAll(largeFeed(101), "\r\n", "\n"),
+		"interleaved": interleaved,
+		"truncated":   truncated,
+		"single":      largeFeed(1),
+	} {
+		want, wantErr := ics.ParseCalendar(strings.NewReader(body))
+		got, err := parseCalendar(body, concurrent)
+		if (err == nil) != (wantErr == nil) {
+			t.Fatalf("%s: Expected error %v, got %v", name, wantErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := serializeParsed(got), serializeParsed(want); got != want {
+			t.Errorf("%s: Expected the concurrent parse to match the sequential one:\n%s\ngot:\n%s", name, want, got)
+		}
+	}
+
+	if header, events, ok := splitEvents(largeFeed(101)); !ok || len(events) != 101 || !strings.HasSuffix(header, "END:VTIMEZONE\r\n") {
+		t.Errorf("Expected the feed to split into 101 events after its VTIMEZONE, got %d (ok %v)", len(events), ok)
+	}
+	if _, events, ok := splitEvents(interleaved); ok {
+		t.Errorf("Expected a VTODO between events to prevent splitting, got %d events", len(events))
+	}
+	if _, events, ok := splitEvents(truncated); ok {
+		t.Errorf("Expected a cut-off event to prevent splitting, got %d events", len(events))
+	}
+}
+
+// BenchmarkParseCalendar compares parsing a large feed whole with parsing it
+// in concurrent chunks.
+func BenchmarkParseCalendar(b *testing.B) {
+	body := largeFeed(20000)
+	for _, concurrency := range []int{1, 4} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			cfg := ParseConfig{Concurrency: concurrency, MinEvents: 5000}
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				if _, err := parseCalendar(body, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// End, parse_test.go
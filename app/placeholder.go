@@ -0,0 +1,33 @@
+// placeholder.go
+// This file contains the placeholder event standing in for an empty feed.
+package main
+
+import (
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// placeholderEvent builds an all-day event on the given day telling users that
+// a feed is configured but has no events, so an empty feed isn't mistaken for
+// a broken aggregate.
+//
+// Parameters:
+// - feed: The feed that loaded without events.
+// - now: The current time, which determines the event's date.
+//
+// Returns:
+// - The placeholder event.
+func placeholderEvent(feed FeedConfig, now time.Time) *ics.VEvent {
+	slug := slugify(feed.Name)
+	if slug == "" {
+		slug = "feed"
+	}
+	event := ics.NewEvent("empty-" + slug + "@calendar-feed-aggregator")
+	event.SetDtStampTime(now)
+	event.SetAllDayStartAt(now)
+	event.SetSummary("No holidays from " + feed.Name)
+	return event
+}
+
+// End, placeholder.go
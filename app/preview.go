@@ -0,0 +1,82 @@
+// preview.go
+// This file contains the /preview endpoint, a dry run of the configured event
+// passes on posted content.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPreviewBytes caps the content posted to /preview.
+const maxPreviewBytes = 1 << 20
+
+// previewFeedName names the feed posted content is treated as when ?feed is not given.
+const previewFeedName = "preview"
+
+// previewCalendar wraps posted content in a VCALENDAR unless it already is one,
+// so that a bare VEVENT can be previewed.
+//
+// Parameters:
+// - content: The posted VEVENT or calendar.
+//
+// Returns:
+// - Calendar data holding the content.
+func previewCalendar(content string) string {
+	if strings.Contains(content, "BEGIN:VCALENDAR") {
+		return content
+	}
+	content = strings.TrimRight(content, "\r\n")
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + content + "\r\nEND:VCALENDAR\r\n"
+}
+
+// preview runs the posted VEVENT, or small calendar, through the passes every
+// feed goes through, transforms and filters included, and returns the events
+// that come out as a calendar, without fetching anything. feed=Canada applies
+// that feed's settings; otherwise the content is treated as an unconfigured
+// feed named "preview". Content that does not parse is a 400, and an unknown
+// feed is a 404.
+func (s *server) preview(c *gin.Context) {
+	feed := FeedConfig{Name: previewFeedName}
+	if name := c.Query("feed"); name != "" {
+		found := false
+		for _, configured := range s.cfg.Feeds {
+			if strings.EqualFold(configured.Name, name) {
+				feed, found = configured, true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no feed named " + name})
+			return
+		}
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPreviewBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "content exceeds the preview size limit"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := s.parseFeed(c.Request.Context(), feed, previewCalendar(string(content)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var body bytes.Buffer
+	writeCalendar(c.Request.Context(), &body, [][]*ics.VEvent{events}, s.cfg)
+	s.serveCalendar(c, body.Bytes())
+}
+
+// End, preview.go
@@ -0,0 +1,59 @@
+// preview_test.go
+// This file contains tests for the /preview dry run.
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPreview tests that a posted VEVENT comes back through the configured
+// transforms and the named feed's filters, without its feed being fetched.
+func TestPreview(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Transforms = []TransformConfig{{Type: "prefix_summary", Value: "Holiday: "}}
+	cfg.Feeds[1].ExcludeSummaries = []string{"Civic Holiday"}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no upstream fetch, got %s", r.URL)
+	}))
+	defer upstream.Close()
+	cfg.Feeds[1].URL = upstream.URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	post := func(query, content string) (int, string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/preview"+query, "text/calendar", strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Error posting to /preview: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Error reading the preview: %v", err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := post("", "BEGIN:VEVENT\nUID:canada-day\nSUMMARY:Canada Day\nDTSTART;VALUE=DATE:20230701\nEND:VEVENT\n")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, body)
+	}
+	if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n") || !strings.Contains(body, "SUMMARY:Holiday: Canada Day\r\n") {
+		t.Errorf("Expected the event with its summary prefixed, got:\n%s", body)
+	}
+
+	status, body = post("?feed=canada", "BEGIN:VEVENT\nUID:civic\nSUMMARY:Civic Holiday\nDTSTART;VALUE=DATE:20230807\nEND:VEVENT\n")
+	if status != http.StatusOK || strings.Contains(body, "BEGIN:VEVENT") {
+		t.Errorf("Expected Canada's exclude_summaries to drop the event, got %d:\n%s", status, body)
+	}
+
+	if status, _ = post("?feed=Atlantis", "BEGIN:VEVENT\nEND:VEVENT\n"); status != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown feed, got %d", status)
+	}
+}
+
+// End, preview_test.go
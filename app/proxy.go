@@ -0,0 +1,161 @@
+// proxy.go
+// This file contains the /transform proxy applying query-selected transforms
+// to any allowed external feed.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/appliedmedia/calendar-feed-aggregator/fetcher"
+)
+
+// proxyTransforms maps the /transform query parameters to the transform types
+// they select, in the order the transforms run.
+var proxyTransforms = []struct {
+	param string
+	kind  string
+	// flag marks parameters that take a boolean rather than the transform's value.
+	flag bool
+}{
+	{param: "prefix", kind: "prefix_summary"},
+	{param: "categories", kind: "add_categories"},
+	{param: "strip_alarms", kind: "strip_alarms", flag: true},
+	{param: "transp", kind: "set_transp"},
+	{param: "mark_free", kind: "mark_free", flag: true},
+	{param: "tz", kind: "set_tz"},
+}
+
+// hostAllowed reports whether a host is on the proxy allowlist. Entries match
+// the host exactly, ignoring case, or as "*.example.com" any of its subdomains.
+//
+// Parameters:
+// - host: The host name, without a port.
+// - allowed: The proxy.allowed_hosts entries.
+//
+// Returns:
+// - True if the host may be fetched.
+func hostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok {
+			if strings.HasSuffix(host, suffix) && strings.HasPrefix(suffix, ".") {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProxyURL rejects URLs the proxy may not fetch: anything but http and
+// https, and hosts missing from proxy.allowed_hosts.
+//
+// Parameters:
+// - u: The URL about to be requested, including redirect targets.
+//
+// Returns:
+// - An error if the URL is not allowed.
+func (s *server) checkProxyURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	if !hostAllowed(u.Hostname(), s.cfg.Proxy.AllowedHosts) {
+		return fmt.Errorf("host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// proxyTransformConfigs lists the transforms selected by the query string.
+//
+// Parameters:
+// - c: The request context.
+//
+// Returns:
+// - The transforms, in the order they run.
+func proxyTransformConfigs(c *gin.Context) []TransformConfig {
+	var configs []TransformConfig
+	for _, pt := range proxyTransforms {
+		value, ok := c.GetQuery(pt.param)
+		if !ok || (pt.flag && !queryBool(c, pt.param)) {
+			continue
+		}
+		if pt.flag {
+			value = ""
+		}
+		configs = append(configs, TransformConfig{Type: pt.kind, Value: value})
+	}
+	return configs
+}
+
+// transformProxy fetches the single feed given by url, applies the transforms
+// selected by the other query parameters, and serves the result. Only hosts on
+// proxy.allowed_hosts are fetched, redirects included, so the proxy can't be
+// pointed at internal services, and feeds over proxy.max_bytes are refused;
+// nothing is cached.
+func (s *server) transformProxy(c *gin.Context) {
+	target, err := url.Parse(c.Query("url"))
+	if err != nil || c.Query("url") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be a feed URL"})
+		return
+	}
+	if err := s.checkProxyURL(target); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	configs := proxyTransformConfigs(c)
+	transforms, err := newPipeline(configs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.HTTPTimeoutSeconds*float64(time.Second)))
+	defer cancel()
+	logf(ctx, "Proxying %s", target.Redacted())
+	body, err := fetcher.Fetch(ctx, fetcher.Request{URL: target.String(), CheckURL: s.checkProxyURL, MaxBytes: s.cfg.Proxy.MaxBytes})
+	if errors.Is(err, fetcher.ErrTooLarge) {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("the feed is over proxy.max_bytes of %d", s.cfg.Proxy.MaxBytes)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	cal, err := parseCalendar(body, s.cfg.Parse)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "parsing the feed: " + err.Error()})
+		return
+	}
+
+	var rendered bytes.Buffer
+	out := s.cfg.outputWriter(&rendered)
+	io.WriteString(out, calendarStart(s.cfg))
+	io.WriteString(out, timezoneComponents(configs, time.Now()))
+	warn := newLineWarner(ctx, s.cfg.WarnLineOctets)
+	for _, event := range cal.Events() {
+		if event == nil {
+			// Cut off before its END; see parseFeed.
+			continue
+		}
+		if event, keep := transforms.Transform(event); keep {
+			filterProperties(event, s.cfg)
+			io.WriteString(out, serializeEvent(event, "", s.cfg.FoldOctets, warn))
+		}
+	}
+	io.WriteString(out, calendarFooter)
+	s.serveCalendar(c, rendered.Bytes())
+}
+
+// End, proxy.go
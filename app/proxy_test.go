@@ -0,0 +1,116 @@
+// proxy_test.go
+// This file contains tests for the /transform proxy.
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestTransformProxy tests that the query-selected transforms are applied to
+// an allowed stub feed.
+func TestTransformProxy(t *testing.T) {
+	feed := newFeedServer(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:launch@example.com
+SUMMARY:Launch
+DTSTART:20230101T120000Z
+DTEND:20230101T130000Z
+END:VEVENT
+END:VCALENDAR
+`)
+	cfg := newTestConfig(t)
+	cfg.Proxy.AllowedHosts = []string{"127.0.0.1"}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/transform?url="+url.QueryEscape(feed.URL)+"&prefix="+url.QueryEscape("[X] ")+"&tz=America/Bogota")
+	for _, want := range []string{
+		"SUMMARY:[X] Launch\r\n",
+		"DTSTART;TZID=America/Bogota:20230101T070000\r\n",
+		"DTEND;TZID=America/Bogota:20230101T080000\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the proxied feed, got:\n%s", want, body)
+		}
+	}
+	if zone := strings.Index(body, "TZID:America/Bogota\r\n"); zone < 0 || zone > strings.Index(body, "BEGIN:VEVENT") {
+		t.Errorf("Expected the America/Bogota VTIMEZONE before the events, got:\n%s", body)
+	}
+}
+
+// TestTransformProxyMaxBytes tests that the proxy refuses feeds over
+// proxy.max_bytes with a 502.
+func TestTransformProxyMaxBytes(t *testing.T) {
+	feed := newFeedServer(t, mockCanadianCalendar)
+	cfg := newTestConfig(t)
+	cfg.Proxy.AllowedHosts = []string{"127.0.0.1"}
+	cfg.Proxy.MaxBytes = 64
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/transform?url=" + url.QueryEscape(feed.URL))
+	if err != nil {
+		t.Fatalf("Error requesting the proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "proxy.max_bytes") {
+		t.Errorf("Expected status 502 naming proxy.max_bytes, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+// TestTransformProxyRefused tests that the proxy only fetches allowed http URLs.
+func TestTransformProxyRefused(t *testing.T) {
+	feed := newFeedServer(t, mockCanadianCalendar)
+	cfg := newTestConfig(t)
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{target: feed.URL, want: http.StatusForbidden},
+		{target: "file:///etc/passwd", want: http.StatusForbidden},
+		{target: "", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + "/transform?url=" + url.QueryEscape(tt.target))
+		if err != nil {
+			t.Fatalf("Error requesting the proxy: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%q: expected status %d, got %d", tt.target, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+// TestHostAllowed tests exact and wildcard allowlist entries.
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"calendar.example.com", "*.holidays.test"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"calendar.example.com", true},
+		{"Calendar.Example.com", true},
+		{"evil.example.com", false},
+		{"ca.holidays.test", true},
+		{"holidays.test", false},
+		{"evilholidays.test", false},
+	}
+	for _, tt := range tests {
+		if got := hostAllowed(tt.host, allowed); got != tt.want {
+			t.Errorf("%s: expected allowed %v, got %v", tt.host, tt.want, got)
+		}
+	}
+}
+
+// End, proxy_test.go
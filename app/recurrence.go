@@ -0,0 +1,53 @@
+// recurrence.go
+// This file contains the handling of RECURRENCE-ID overrides of recurring events.
+package main
+
+import (
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const (
+	// recurrenceOverridesAttach serves overrides alongside their series, so
+	// clients show the modified instance in place of the original one.
+	recurrenceOverridesAttach = "attach"
+	// recurrenceOverridesDrop removes overrides, leaving series unmodified.
+	recurrenceOverridesDrop = "drop"
+)
+
+// propertyRecurrenceID is the property marking an event as the override of one
+// instance of the recurring event sharing its UID.
+const propertyRecurrenceID ics.ComponentProperty = "RECURRENCE-ID"
+
+// recurrenceID returns the instance an event overrides.
+//
+// Parameters:
+// - event: The event to inspect.
+//
+// Returns:
+// - The RECURRENCE-ID value, or "" if the event is not an override.
+func recurrenceID(event *ics.VEvent) string {
+	return strings.TrimSpace(propertyValue(event, propertyRecurrenceID))
+}
+
+// instanceKey identifies an event by its UID and, for overrides, the instance
+// they override, since an override shares the UID of its series.
+//
+// Parameters:
+// - event: The event to identify.
+//
+// Returns:
+// - The key of the event, or "" if it has no UID.
+func instanceKey(event *ics.VEvent) string {
+	uid := event.Id()
+	if uid == "" {
+		return ""
+	}
+	if id := recurrenceID(event); id != "" {
+		return uid + "\n" + id
+	}
+	return uid
+}
+
+// End, recurrence.go
@@ -0,0 +1,191 @@
+// redact.go
+// This file contains the /config endpoint, which serves the effective
+// configuration with its secrets redacted.
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in the served configuration.
+const redacted = "REDACTED"
+
+// secretWords are the words marking a setting, form field, or query parameter
+// as secret, matched against each word of its name and the name as a whole.
+var secretWords = map[string]bool{
+	"token":         true,
+	"accesstoken":   true,
+	"password":      true,
+	"passwd":        true,
+	"secret":        true,
+	"auth":          true,
+	"authorization": true,
+	"apikey":        true,
+	"credentials":   true,
+}
+
+// isSecretName reports whether a setting or parameter name denotes a secret,
+// e.g. config_token, api_key, or X-Auth.
+//
+// Parameters:
+// - name: The name to check.
+//
+// Returns:
+// - True if values under the name must be redacted.
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' })
+	for _, word := range words {
+		if secretWords[word] {
+			return true
+		}
+	}
+	return secretWords[strings.Join(words, "")]
+}
+
+// redactURL masks the password and the secret query parameters of a URL.
+//
+// Parameters:
+// - value: The value to redact, used as is if it is not an absolute URL.
+//
+// Returns:
+// - The value with its secrets masked.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	query := u.Query()
+	changed := false
+	for name := range query {
+		if isSecretName(name) {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// redactURLPath masks the path of a URL as well as its other secrets, for
+// webhooks whose secret is the path itself, e.g. Slack-style hooks.
+//
+// Parameters:
+// - value: The value to redact, used as is if it is not an absolute URL.
+//
+// Returns:
+// - The value with its path and other secrets masked.
+func redactURLPath(value string) string {
+	u, err := url.Parse(redactURL(value))
+	if err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return value
+	}
+	u.Path, u.RawPath = "/"+redacted, ""
+	return u.String()
+}
+
+// redactValue masks the secrets in a decoded configuration value: the values
+// of secret names, request bodies, which may carry API keys in any encoding,
+// and the credentials of URLs.
+//
+// Parameters:
+// - name: The name the value is set under.
+// - value: The decoded value, redacted in place.
+//
+// Returns:
+// - The redacted value.
+func redactValue(name string, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = redactValue(key, item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(name, item)
+		}
+	case string:
+		if v != "" && (isSecretName(name) || name == "body") {
+			return redacted
+		}
+		return redactURL(v)
+	}
+	return value
+}
+
+// redactedConfig returns the configuration as served by /config: keyed as in
+// conf.yaml, with its secrets redacted.
+//
+// Parameters:
+// - cfg: The effective configuration.
+//
+// Returns:
+// - The redacted configuration.
+// - An error if the configuration could not be encoded.
+func redactedConfig(cfg *Config) (map[string]any, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	redactValue("", doc)
+	if webhooks, ok := doc["webhooks"].([]any); ok {
+		for _, item := range webhooks {
+			if webhook, ok := item.(map[string]any); ok {
+				if u, ok := webhook["url"].(string); ok {
+					webhook["url"] = redactURLPath(u)
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// requireBearer admits only requests carrying the given bearer token, turning
+// others away with a 401.
+//
+// Parameters:
+// - token: The token requests must present.
+//
+// Returns:
+// - A gin middleware enforcing the token.
+func requireBearer(token string) gin.HandlerFunc {
+	want := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), want) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "a valid bearer token is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// effectiveConfig serves the loaded configuration, defaults and manifest
+// feeds included, as JSON keyed as in conf.yaml. Tokens, passwords, request
+// bodies, and other secrets are redacted, as are the credentials of URLs and
+// the paths of webhooks.
+func (s *server) effectiveConfig(c *gin.Context) {
+	doc, err := redactedConfig(s.cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// End, redact.go
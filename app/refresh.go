@@ -0,0 +1,152 @@
+// refresh.go
+// This file contains the background refresher that keeps the feed cache warm.
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// refresh fetches every feed afresh, updating the cache, and writes the
+// snapshot file when one is configured. The server becomes ready once a cycle
+// has refreshed at least one feed. The feed bodies of a cycle refreshing every
+// feed are kept as the last good data, served instead of live data while later
+// cycles fail entirely. Feeds whose events changed since the previous cycle are reported to
+// the webhooks. Each cycle is logged under its own request ID.
+//
+// Parameters:
+// - ctx: The context governing the refresh.
+//
+// Returns:
+// - An error if the snapshot could not be written.
+func (s *server) refresh(ctx context.Context) error {
+	ctx = withRequestID(ctx, "refresh-"+newRequestID())
+	ctx = withRetryBudget(ctx, s.cfg.Retry.Budget)
+	results := make([][]*ics.VEvent, len(s.cfg.Feeds))
+	bodies := make([]string, len(s.cfg.Feeds))
+	succeeded := make([]bool, len(s.cfg.Feeds))
+	var wg sync.WaitGroup
+
+	for i, feed := range s.cfg.Feeds {
+		if !feed.enabled() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, feed FeedConfig) {
+			defer wg.Done()
+			body, err := s.feedBody(ctx, feed, true)
+			if err != nil {
+				logf(ctx, "Error refreshing %s: %v", feed.Name, err)
+				return
+			}
+			events, err := s.bodyEvents(ctx, feed, body)
+			if err != nil {
+				logf(ctx, "Error refreshing %s: %v", feed.Name, err)
+				return
+			}
+			results[i], bodies[i] = events, body
+			succeeded[i] = true
+			if len(s.cfg.Webhooks) == 0 {
+				return
+			}
+			if change, changed := s.changes.observe(feed.Name, events); changed {
+				s.notifyWebhooks(ctx, change)
+			}
+		}(i, feed)
+	}
+	wg.Wait()
+
+	anySucceeded, allSucceeded := false, true
+	for i, ok := range succeeded {
+		anySucceeded = anySucceeded || ok
+		allSucceeded = allSucceeded && (ok || !s.cfg.Feeds[i].enabled())
+	}
+	if !anySucceeded {
+		logf(ctx, "Every feed failed to refresh; keeping the previous data")
+		s.refreshFailed.Store(true)
+		return nil
+	}
+	s.refreshFailed.Store(false)
+	s.ready.Store(true)
+	if s.cfg.Cache.PersistPath != "" {
+		if err := s.cache.save(s.cfg.Cache.PersistPath); err != nil {
+			logf(ctx, "Error persisting the cache: %v", err)
+		}
+	}
+
+	if s.cfg.Dedup.Enabled {
+		results = dedupEvents(results, s.cfg.Dedup)
+	}
+	var combined bytes.Buffer
+	if err := writeCalendar(ctx, &combined, results, s.cfg); err != nil {
+		return err
+	}
+	if allSucceeded {
+		good := map[string]string{}
+		for i, feed := range s.cfg.Feeds {
+			if succeeded[i] {
+				good[feed.Name] = bodies[i]
+			}
+		}
+		s.lastGood.Store(good)
+	}
+	if s.cfg.Snapshot.Path == "" {
+		return nil
+	}
+	return writeSnapshot(s.cfg.Snapshot.Path, combined.Bytes())
+}
+
+// runRefresher refreshes the feeds at the configured interval until ctx is done.
+//
+// Parameters:
+// - ctx: The context whose cancellation stops the refresher.
+func (s *server) runRefresher(ctx context.Context) {
+	interval := time.Duration(s.cfg.Refresh.IntervalSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.refresh(ctx); err != nil {
+			log.Printf("Error refreshing feeds: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// servingStale reports whether requests are served from the last good refresh
+// because the latest refresh failed for every feed.
+//
+// Returns:
+// - True while the last good bodies stand in for live data.
+func (s *server) servingStale() bool {
+	_, ok := s.lastGood.Load().(map[string]string)
+	return ok && s.refreshFailed.Load()
+}
+
+// staleBody returns a feed's body from the last good refresh while requests
+// are served from it.
+//
+// Parameters:
+// - feed: The feed to look up.
+//
+// Returns:
+// - The feed's last good body.
+// - False if live data is served, or the feed was not in the last good refresh.
+func (s *server) staleBody(feed FeedConfig) (string, bool) {
+	if !s.servingStale() {
+		return "", false
+	}
+	body, ok := s.lastGood.Load().(map[string]string)[feed.Name]
+	return body, ok
+}
+
+// End, refresh.go
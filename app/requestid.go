@@ -0,0 +1,78 @@
+// requestid.go
+// This file contains the request ID middleware and request-scoped logging.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDKey is the context key under which the request ID is stored.
+type requestIDKey struct{}
+
+// newRequestID returns a random identifier for a request.
+//
+// Returns:
+// - A 16-character hexadecimal string.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withRequestID returns a copy of ctx carrying the given request ID.
+//
+// Parameters:
+// - ctx: The parent context.
+// - id: The request ID to attach.
+//
+// Returns:
+// - The derived context.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the request ID carried by ctx, or "" if there is none.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logf logs a message prefixed with the request ID carried by ctx, if any.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - format: The fmt format string of the message.
+// - args: The format arguments.
+func logf(ctx context.Context, format string, args ...any) {
+	if id := requestID(ctx); id != "" {
+		format = "[" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// requestIDMiddleware assigns every request an ID, honoring one sent by the
+// client in the given header, and echoes it back in the response.
+//
+// Parameters:
+// - header: The header carrying the request ID, e.g. X-Request-ID.
+//
+// Returns:
+// - A gin middleware attaching the ID to the request context.
+func requestIDMiddleware(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(header)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		c.Header(header, id)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// End, requestid.go
@@ -0,0 +1,64 @@
+// requestid_test.go
+// This file contains tests for the request ID middleware.
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequestIDPropagation tests that the request ID is echoed and appears in the fetch logs.
+func TestRequestIDPropagation(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	cfg := newTestConfig(t)
+	cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: "Broken", URL: "http://127.0.0.1:0/missing.ics"})
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/aggregate_ics", nil)
+	req.Header.Set("X-Request-ID", "trace-123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	// The stream ends once every feed is done, and closing the server waits for
+	// the handler, so nothing is still logging when the logs are read.
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	srv.Close()
+
+	if got := resp.Header.Get("X-Request-ID"); got != "trace-123" {
+		t.Errorf("Expected the incoming request ID to be echoed, got %q", got)
+	}
+	for _, want := range []string{"[trace-123] Fetching Canada", "[trace-123] Error loading Broken"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected logs to contain %q, got:\n%s", want, logs.String())
+		}
+	}
+}
+
+// TestRequestIDGenerated tests that requests without an ID are assigned one.
+func TestRequestIDGenerated(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := resp.Header.Get("X-Request-ID"); len(got) != 16 {
+		t.Errorf("Expected a generated 16-character request ID, got %q", got)
+	}
+}
+
+// End, requestid_test.go
@@ -0,0 +1,103 @@
+// retry.go
+// This file contains the feed fetch retries and the per-request retry budget
+// shared by every feed.
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/appliedmedia/calendar-feed-aggregator/fetcher"
+)
+
+// retryBudgetKey is the context key under which the retry budget is stored.
+type retryBudgetKey struct{}
+
+// retryBudget counts the retries left to the feeds of one request.
+type retryBudget struct {
+	remaining atomic.Int64
+}
+
+// withRetryBudget returns a copy of ctx whose feed fetches share a budget of
+// retries.
+//
+// Parameters:
+// - ctx: The parent context.
+// - retries: The total retries allowed across every feed.
+//
+// Returns:
+// - The derived context.
+func withRetryBudget(ctx context.Context, retries int) context.Context {
+	budget := &retryBudget{}
+	budget.remaining.Store(int64(retries))
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// takeRetry spends one retry from the budget carried by ctx. A context without
+// a budget allows every retry.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+//
+// Returns:
+// - True if a retry may be made.
+func takeRetry(ctx context.Context) bool {
+	budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return true
+	}
+	return budget.remaining.Add(-1) >= 0
+}
+
+// retryBudgetMiddleware gives every request its own retry budget.
+//
+// Parameters:
+// - retries: The total retries allowed across every feed of a request.
+//
+// Returns:
+// - A gin middleware attaching the budget to the request context.
+func retryBudgetMiddleware(retries int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(withRetryBudget(c.Request.Context(), retries))
+		c.Next()
+	}
+}
+
+// fetchWithRetries fetches a feed, retrying failures up to retry.max_retries
+// times while the request's retry budget lasts. Each attempt gets the feed's
+// full timeout, and attempts are retry.backoff_ms apart. Feeds over
+// skip_feeds_over_bytes are not retried.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed to fetch.
+//
+// Returns:
+// - A string containing the calendar data.
+// - The error of the last attempt if every attempt failed.
+func (s *server) fetchWithRetries(ctx context.Context, feed FeedConfig) (string, error) {
+	backoff := time.Duration(s.cfg.Retry.BackoffMS) * time.Millisecond
+	req := feed.request()
+	req.MaxBytes = s.cfg.SkipFeedsOverBytes
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, feed.timeout(s.cfg.HTTPTimeoutSeconds))
+		body, err := fetcher.Fetch(attemptCtx, req)
+		cancel()
+		if err == nil || errors.Is(err, fetcher.ErrTooLarge) || ctx.Err() != nil || attempt >= s.cfg.Retry.MaxRetries || !takeRetry(ctx) {
+			return body, err
+		}
+
+		logf(ctx, "Retrying %s after error: %v", feed.Name, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// End, retry.go
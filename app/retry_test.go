@@ -0,0 +1,50 @@
+// retry_test.go
+// This file contains tests for the feed fetch retries.
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRetryBudget tests that failing feeds share the request's retry budget
+// rather than each retrying up to max_retries.
+func TestRetryBudget(t *testing.T) {
+	const feeds, maxRetries, budget = 4, 3, 2
+
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Retry = RetryConfig{MaxRetries: maxRetries, Budget: budget}
+	cfg.Feeds = nil
+	for i := 0; i < feeds; i++ {
+		cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: fmt.Sprintf("Flaky %d", i), URL: fmt.Sprintf("%s/%d.ics", upstream.URL, i)})
+	}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	for request := 1; request <= 2; request++ {
+		resp, err := http.Get(srv.URL + "/aggregate_ics")
+		if err != nil {
+			t.Fatalf("Error requesting aggregate: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		// Every feed is attempted once, and only the budget is retried.
+		if got, want := hits.Load(), int32(request*(feeds+budget)); got != want {
+			t.Errorf("Expected %d fetches after request %d, got %d", want, request, got)
+		}
+	}
+}
+
+// End, retry_test.go
@@ -0,0 +1,31 @@
+// robots.go
+// This file contains the crawler opt-outs keeping feed URLs out of search engines.
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// robotsDisallowAll is the robots.txt asking every crawler to stay away.
+const robotsDisallowAll = "User-agent: *\nDisallow: /\n"
+
+// robotsTxt serves a robots.txt disallowing every path.
+func robotsTxt(c *gin.Context) {
+	c.String(http.StatusOK, robotsDisallowAll)
+}
+
+// noIndexMiddleware marks every response with X-Robots-Tag: noindex, for
+// crawlers that reach feed URLs despite robots.txt.
+//
+// Returns:
+// - The middleware.
+func noIndexMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Robots-Tag", "noindex")
+		c.Next()
+	}
+}
+
+// End, robots.go
@@ -0,0 +1,43 @@
+// robots_test.go
+// This file contains tests for the crawler opt-outs.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRobotsTxt tests that robots.txt disallows every path and that feed
+// responses carry X-Robots-Tag, unless noindex is off.
+func TestRobotsTxt(t *testing.T) {
+	cfg := newTestConfig(t)
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	if got := getBody(t, srv.URL+"/robots.txt"); got != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("Expected a disallow-all robots.txt, got %q", got)
+	}
+	resp, err := http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Robots-Tag"); got != "noindex" {
+		t.Errorf("Expected X-Robots-Tag: noindex, got %q", got)
+	}
+
+	cfg.NoIndex = false
+	off := httptest.NewServer(newRouter(cfg))
+	defer off.Close()
+	resp, err = http.Get(off.URL + "/robots.txt")
+	if err != nil {
+		t.Fatalf("Error requesting robots.txt: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("X-Robots-Tag") != "" {
+		t.Errorf("Expected no robots.txt or X-Robots-Tag with noindex off, got status %d", resp.StatusCode)
+	}
+}
+
+// End, robots_test.go
@@ -0,0 +1,80 @@
+// sanitize.go
+// This file contains the cleanup of feed bodies that fail to parse as served.
+package main
+
+import "strings"
+
+// sanitizeCalendar repairs the damage commonly found in broken feeds: it turns
+// bare CR and LF line endings into CRLF, strips control characters, and drops
+// blank lines and lines that aren't content lines, such as stray text or a
+// property whose parameters never reach the value. Continuation lines are kept
+// with the line they continue.
+//
+// Parameters:
+// - body: The calendar data of a feed.
+//
+// Returns:
+// - The sanitized calendar data.
+func sanitizeCalendar(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\r", "\n")
+	var b strings.Builder
+	kept := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.Map(func(r rune) rune {
+			if (r < 0x20 && r != '\t') || r == 0x7f {
+				return -1
+			}
+			return r
+		}, line)
+		switch {
+		case line == "":
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			// A continuation of a dropped line goes with it.
+			if !kept {
+				continue
+			}
+		default:
+			if kept = isContentLine(line); !kept {
+				continue
+			}
+		}
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// isContentLine reports whether line has the shape of an RFC 5545 content
+// line: a name of letters, digits, and dashes, optional parameters, and a
+// colon outside quotes before the value.
+//
+// Parameters:
+// - line: The unfolded line, without its line ending.
+//
+// Returns:
+// - True if the line is a content line.
+func isContentLine(line string) bool {
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return false
+	}
+	for _, r := range line[:end] {
+		if !(r == '-' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return false
+		}
+	}
+	quoted := false
+	for _, r := range line[end:] {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			return true
+		}
+	}
+	return false
+}
+
+// End, sanitize.go
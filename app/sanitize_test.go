@@ -0,0 +1,42 @@
+// sanitize_test.go
+// This file contains tests for the sanitized retry of feeds that fail to parse.
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSanitizeCalendar tests that a feed with bare CR line endings, a control
+// character in a property name, stray text, and an unterminated parameter
+// fails to parse as served, and that its events are recovered after
+// sanitizing when parse.sanitize is on.
+func TestSanitizeCalendar(t *testing.T) {
+	broken := strings.Replace(mockCanadianCalendar, "SUMMARY:Canada Day", "SUM\x01MARY:Canada Day\nthis line is not a property\nDESCRIPTION;ALTREP=\"cid:broken\n continued", 1)
+	broken = strings.ReplaceAll(broken, "\n", "\r")
+	if _, err := parseCalendar(broken, ParseConfig{Concurrency: 1}); err == nil {
+		t.Fatal("Expected the broken feed to fail to parse as served")
+	}
+
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, broken).URL
+	for _, sanitize := range []bool{false, true} {
+		cfg.Parse.Sanitize = sanitize
+		srv := httptest.NewServer(newRouter(cfg))
+		body := getBody(t, srv.URL+"/aggregate_ics?nocache=true")
+		srv.Close()
+
+		if !strings.Contains(body, "SUMMARY:Colombian New Year") {
+			t.Errorf("sanitize %v: Expected Colombia's events, got:\n%s", sanitize, body)
+		}
+		if got := strings.Contains(body, "SUMMARY:Canada Day"); got != sanitize {
+			t.Errorf("sanitize %v: Expected Canada Day served to be %v, got:\n%s", sanitize, sanitize, body)
+		}
+		if strings.Contains(body, "broken") || strings.Contains(body, "continued") {
+			t.Errorf("sanitize %v: Expected the broken lines dropped, got:\n%s", sanitize, body)
+		}
+	}
+}
+
+// End, sanitize_test.go
@@ -0,0 +1,94 @@
+// sequence.go
+// This file contains the SEQUENCE bumping of events whose content changes.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// sequenceEntry is the last seen content of an event and how often it changed.
+type sequenceEntry struct {
+	hash  string
+	bumps int
+}
+
+// sequenceTracker remembers the content of every event by feed and UID, so
+// that changed events can be served with a higher SEQUENCE.
+type sequenceTracker struct {
+	mu      sync.Mutex
+	entries map[string]sequenceEntry
+}
+
+// newSequenceTracker creates an empty tracker.
+//
+// Returns:
+// - A ready-to-use sequenceTracker.
+func newSequenceTracker() *sequenceTracker {
+	return &sequenceTracker{entries: map[string]sequenceEntry{}}
+}
+
+// eventContentHash hashes every property of an event except DTSTAMP and
+// SEQUENCE, which change without the event itself changing.
+//
+// Parameters:
+// - event: The event to hash.
+//
+// Returns:
+// - The hex SHA-256 of the event's content.
+func eventContentHash(event *ics.VEvent) string {
+	h := sha256.New()
+	for _, prop := range event.Properties {
+		switch prop.IANAToken {
+		case string(ics.ComponentPropertyDtstamp), string(ics.ComponentPropertySequence):
+			continue
+		}
+		params := make([]string, 0, len(prop.ICalParameters))
+		for name, values := range prop.ICalParameters {
+			params = append(params, name+"="+strings.Join(values, ","))
+		}
+		sort.Strings(params)
+		h.Write([]byte(prop.IANAToken + ";" + strings.Join(params, ";") + ":" + prop.Value + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// apply raises the SEQUENCE of every event whose content differs from the
+// last time the feed was loaded. The first sighting of an event is its
+// baseline; events without a UID can't be tracked and are left alone.
+//
+// Parameters:
+// - feed: The name of the feed the events belong to.
+// - events: The feed's events, edited in place.
+func (st *sequenceTracker) apply(feed string, events []*ics.VEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, event := range events {
+		id := instanceKey(event)
+		if id == "" {
+			continue
+		}
+		key := feed + "\n" + id
+		hash := eventContentHash(event)
+		entry, seen := st.entries[key]
+		if seen && entry.hash != hash {
+			entry.bumps++
+		}
+		entry.hash = hash
+		st.entries[key] = entry
+
+		if entry.bumps > 0 {
+			sequence, _ := strconv.Atoi(propertyValue(event, ics.ComponentPropertySequence))
+			event.SetProperty(ics.ComponentPropertySequence, strconv.Itoa(sequence+entry.bumps))
+		}
+	}
+}
+
+// End, sequence.go
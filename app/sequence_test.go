@@ -0,0 +1,74 @@
+// sequence_test.go
+// This file contains tests for SEQUENCE tracking.
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestTrackSequence tests that changing an event between refreshes raises its
+// SEQUENCE under the same UID, and that unchanged loads leave it alone.
+func TestTrackSequence(t *testing.T) {
+	const calendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:canada-day@example.com
+DTSTAMP:20230101T000000Z
+SEQUENCE:2
+SUMMARY:Canada Day
+DTSTART;VALUE=DATE:20230701
+END:VEVENT
+END:VCALENDAR`
+	var body atomic.Value
+	body.Store(calendar)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body.Load().(string))
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.TrackSequence = true
+	feed := FeedConfig{Name: "Canada", URL: upstream.URL}
+	cfg.Feeds = []FeedConfig{feed}
+	s := newServer(cfg)
+
+	load := func() *ics.VEvent {
+		events, err := s.feedEvents(context.Background(), feed, true)
+		if err != nil || len(events) != 1 {
+			t.Fatalf("Expected one event, got %d (%v)", len(events), err)
+		}
+		return events[0]
+	}
+
+	if got := propertyValue(load(), ics.ComponentPropertySequence); got != "2" {
+		t.Errorf("Expected the first load to keep SEQUENCE 2, got %s", got)
+	}
+
+	// A new DTSTAMP alone is not a change.
+	body.Store(strings.Replace(calendar, "20230101T000000Z", "20230601T000000Z", 1))
+	if got := propertyValue(load(), ics.ComponentPropertySequence); got != "2" {
+		t.Errorf("Expected a DTSTAMP-only change to keep SEQUENCE 2, got %s", got)
+	}
+
+	body.Store(strings.Replace(calendar, "SUMMARY:Canada Day", "SUMMARY:Canada Day (observed)", 1))
+	event := load()
+	if got := propertyValue(event, ics.ComponentPropertySequence); got != "3" {
+		t.Errorf("Expected the changed event to have SEQUENCE 3, got %s", got)
+	}
+	if event.Id() != "canada-day@example.com" {
+		t.Errorf("Expected the UID to stay canada-day@example.com, got %s", event.Id())
+	}
+	if got := propertyValue(load(), ics.ComponentPropertySequence); got != "3" {
+		t.Errorf("Expected an unchanged reload to keep SEQUENCE 3, got %s", got)
+	}
+}
+
+// End, sequence_test.go
@@ -0,0 +1,456 @@
+// server.go
+// This file contains the HTTP router and the aggregation handlers.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// calendarHeader opens the combined calendar written by the aggregation
+	// endpoints; the PRODID follows.
+	calendarHeader = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n"
+	// calendarFooter closes the combined calendar.
+	calendarFooter = "END:VCALENDAR\r\n"
+)
+
+// calendarStart returns the header of a combined calendar.
+//
+// Parameters:
+// - cfg: The configuration providing the PRODID and the METHOD.
+//
+// Returns:
+// - The VCALENDAR header, ending with the METHOD line if any.
+func calendarStart(cfg *Config) string {
+	header := calendarHeader + "PRODID:" + cfg.prodID() + "\r\n"
+	if method := cfg.calendarMethod(); method != "" {
+		header += "METHOD:" + method + "\r\n"
+	}
+	return header
+}
+
+// server serves the aggregation endpoints for a loaded configuration.
+type server struct {
+	cfg   *Config
+	cache *feedCache
+	// history keeps the last good bodies of every feed for ?pin.
+	history *feedHistory
+	// sequences tracks event content for track_sequence.
+	sequences *sequenceTracker
+	// changes tracks the events of each refresh for the webhooks.
+	changes *changeTracker
+	// fetches coalesces fetches sooner than min_refresh_seconds.
+	fetches *recentFetches
+	// titleTemplate is the parsed title_template, nil when unset.
+	titleTemplate *template.Template
+	// transforms is the pipeline built from the transforms setting.
+	transforms pipeline
+	// slugs maps the slugs of /f/:slug and /c/:slug to feed and collection names.
+	slugs slugRoutes
+	// weekdayLocation is the weekday_timezone ?weekday is judged in.
+	weekdayLocation *time.Location
+	// floatingLocation is the zone /freebusy and /aggregate_json read floating
+	// times and all-day dates in: the local zone, or a fixed one in tests.
+	floatingLocation *time.Location
+	// ready reports whether the server can serve warm data; with the background
+	// refresher enabled it is set by the first successful refresh.
+	ready atomic.Bool
+	// lastGood maps each feed's name to its body in the last refresh in which
+	// every feed succeeded, as a map[string]string.
+	lastGood atomic.Value
+	// refreshFailed is set while the latest refresh failed for every feed.
+	refreshFailed atomic.Bool
+}
+
+// newServer creates a server for the given configuration.
+//
+// Parameters:
+// - cfg: The configuration describing the feeds and server options.
+//
+// Returns:
+// - A server with the persisted feed cache if any, ready unless the refresher is enabled and nothing was persisted.
+func newServer(cfg *Config) *server {
+	s := buildServer(cfg)
+	s.ready.Store(cfg.Refresh.IntervalSeconds == 0)
+	if cfg.Cache.PersistPath != "" {
+		loaded, err := s.cache.load(cfg.Cache.PersistPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Ignoring the persisted cache: %v", err)
+		}
+		// Warm data can be served without waiting for the first refresh.
+		if loaded > 0 {
+			s.ready.Store(true)
+		}
+	}
+	return s
+}
+
+// buildServer creates a server for the given configuration with empty data
+// and trackers, neither loading the persisted cache nor marking it ready.
+//
+// Parameters:
+// - cfg: The configuration describing the feeds and server options.
+//
+// Returns:
+// - The new server.
+func buildServer(cfg *Config) *server {
+	s := &server{
+		cfg:       cfg,
+		cache:     newFeedCache(time.Duration(cfg.Cache.TTLSeconds) * time.Second),
+		history:   newFeedHistory(cfg.Snapshot.History),
+		sequences: newSequenceTracker(),
+		changes:   newChangeTracker(),
+		fetches:   newRecentFetches(),
+
+		floatingLocation: time.Local,
+	}
+	transforms, err := newPipeline(cfg.Transforms)
+	if err != nil {
+		// loadConfig has already rejected invalid transforms.
+		log.Printf("Ignoring the transforms: %v", err)
+	}
+	if len(cfg.UppercaseTokens) > 0 {
+		// The casing fix comes after every transform that may rewrite summaries.
+		transforms = append(transforms, newUppercaseTokens(cfg.UppercaseTokens))
+	}
+	s.transforms = transforms
+	s.titleTemplate, err = parseTitleTemplate(cfg.TitleTemplate)
+	if err != nil {
+		// loadConfig has already rejected invalid templates.
+		log.Printf("Ignoring the title template: %v", err)
+	}
+	s.slugs, err = newSlugRoutes(cfg)
+	if err != nil {
+		// loadConfig has already rejected slug collisions.
+		log.Printf("Ignoring the slug routes: %v", err)
+	}
+	s.weekdayLocation, err = time.LoadLocation(cfg.WeekdayTimezone)
+	if err != nil {
+		// loadConfig has already rejected invalid time zones.
+		log.Printf("Judging weekdays in UTC: %v", err)
+		s.weekdayLocation = time.UTC
+	}
+	return s
+}
+
+// httpServer builds the HTTP server serving handler with the configured
+// connection timeouts.
+//
+// Parameters:
+// - handler: The handler serving every request, e.g. the server's router.
+//
+// Returns:
+// - An http.Server listening on the configured address.
+func (s *server) httpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         s.cfg.Addr,
+		Handler:      handler,
+		ReadTimeout:  time.Duration(s.cfg.Server.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(s.cfg.Server.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:  time.Duration(s.cfg.Server.IdleTimeoutSeconds) * time.Second,
+	}
+}
+
+// newRouter builds the gin engine serving the aggregation endpoints.
+//
+// Parameters:
+// - cfg: The configuration describing the feeds and server options.
+//
+// Returns:
+// - A gin engine with all routes registered.
+func newRouter(cfg *Config) *gin.Engine {
+	return newServer(cfg).router()
+}
+
+// router builds the gin engine serving the server's endpoints.
+//
+// Returns:
+// - A gin engine with all routes registered.
+func (s *server) router() *gin.Engine {
+	r := gin.Default()
+	r.Use(requestIDMiddleware(s.cfg.RequestIDHeader))
+	if s.cfg.NoIndex {
+		r.Use(noIndexMiddleware())
+		r.GET("/robots.txt", robotsTxt)
+	}
+	r.GET("/healthz", s.healthz)
+	r.GET("/readyz", s.readyz)
+	// Routes registered from here on are limited; the probes above never are.
+	r.Use(limitMiddleware(s.cfg.Limit.MaxInFlight, s.cfg.Limit.RetryAfterSeconds))
+	r.Use(retryBudgetMiddleware(s.cfg.Retry.Budget))
+
+	aggregate := r.Group("/")
+	if s.cfg.Compression {
+		aggregate.Use(gzipMiddleware())
+	}
+	aggregate.GET("/aggregate_ics", s.aggregateICS)
+	aggregate.GET("/collection/:name", s.collection)
+	aggregate.GET("/f/:slug", s.feedBySlug)
+	aggregate.GET("/c/:slug", s.collectionBySlug)
+	aggregate.GET("/aggregate.jsonfeed", s.aggregateJSONFeed)
+	aggregate.GET("/aggregate_json", s.aggregateJSON)
+	aggregate.GET("/transform", s.transformProxy)
+	aggregate.GET("/freebusy", s.freeBusy)
+	// Event streams are flushed frame by frame, so they are never compressed.
+	if s.cfg.Server.ExemptStreams {
+		r.GET("/aggregate/stream", noWriteTimeout, s.aggregateStream)
+	} else {
+		r.GET("/aggregate/stream", s.aggregateStream)
+	}
+	r.GET("/diff", s.diff)
+	r.GET("/feeds", s.feeds)
+	r.GET("/warnings", s.warnings)
+	r.GET("/summaries", s.summaries)
+	r.GET("/summary", s.feedSummaries)
+	r.GET("/snapshots", s.snapshots)
+	r.GET("/openapi.json", s.openAPI)
+	if s.cfg.Preview {
+		r.POST("/preview", s.preview)
+	}
+	if s.cfg.ConfigToken != "" {
+		r.GET("/config", requireBearer(s.cfg.ConfigToken), s.effectiveConfig)
+	}
+
+	return r
+}
+
+// queryBool reports whether the named query parameter is set to a true value.
+//
+// Parameters:
+// - c: The request context.
+// - name: The query parameter to read.
+//
+// Returns:
+// - True if the parameter parses as a true boolean.
+func queryBool(c *gin.Context, name string) bool {
+	value, err := strconv.ParseBool(c.Query(name))
+	return err == nil && value
+}
+
+// healthz reports that the process is alive.
+func (s *server) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz reports whether the server is ready to serve traffic, returning 503
+// until the first background refresh has populated the cache.
+func (s *server) readyz(c *gin.Context) {
+	if !s.ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// selectedFeeds returns the feeds a request draws on.
+//
+// Parameters:
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The selected feeds, in configured order.
+func (s *server) selectedFeeds(opts aggregateOptions) []FeedConfig {
+	var selected []FeedConfig
+	for _, feed := range s.cfg.Feeds {
+		if opts.includesFeed(feed) {
+			selected = append(selected, feed)
+		}
+	}
+	return selected
+}
+
+// writeCalendarStart writes the calendar header with the configured METHOD. When the request draws on a
+// single feed with a color, the calendar itself carries that COLOR. The zones of set_tz follow.
+//
+// Parameters:
+// - w: The response body.
+// - opts: The per-request aggregation settings.
+func (s *server) writeCalendarStart(w io.Writer, opts aggregateOptions) {
+	io.WriteString(w, calendarStart(s.cfg))
+	if selected := s.selectedFeeds(opts); len(selected) == 1 && selected[0].Color != "" && s.cfg.propertyAllowed(string(propertyColor)) {
+		io.WriteString(w, string(propertyColor)+":"+strings.ToLower(selected[0].Color)+"\r\n")
+	}
+	io.WriteString(w, timezoneComponents(s.cfg.Transforms, time.Now()))
+}
+
+// writeIndexEvent writes the optional index event, which leads the events.
+//
+// Parameters:
+// - w: The response body.
+// - counts: The number of events each feed contributed.
+// - as: The component type events are output as.
+// - warn: The check of overlong lines, as for foldContent.
+func (s *server) writeIndexEvent(w io.Writer, counts []int, as string, warn *lineWarner) {
+	if s.cfg.IndexEvent {
+		io.WriteString(w, serializeEvent(indexEvent(s.cfg.Feeds, counts, time.Now()), as, s.cfg.FoldOctets, warn))
+	}
+}
+
+// aggregateICS serves the events of the selected feeds as a single calendar,
+// streamed as feeds load unless an option needs every event first. The query
+// parameters, documented in /openapi.json, select, filter, sort, and convert
+// the events. The response may carry:
+// - X-Feed-Age-Seconds: How old each feed's data is.
+// - Content-Disposition: The download_filename of a single selected feed.
+// - X-Parse-Warnings: The number of parse warnings, with warnings=header.
+// - X-Truncated-Bytes: Set when events were dropped to fit max_output_bytes.
+// - X-Serving-Stale-Aggregate: Set while the last good data stands in for live data.
+// - X-Timed-Out-Feeds: The feeds that missed their deadline; a trailer when streaming.
+// - X-Skipped-Feeds: The feeds over skip_feeds_over_bytes; a trailer when streaming.
+// - X-Content-SHA256: The checksum of the body; a trailer when streaming.
+func (s *server) aggregateICS(c *gin.Context) {
+	s.serveAggregate(c, parseAggregateOptions(c))
+}
+
+// serveAggregate writes the combined calendar selected by opts, as described
+// for aggregateICS.
+//
+// Parameters:
+// - c: The request context.
+// - opts: The per-request aggregation settings.
+func (s *server) serveAggregate(c *gin.Context, opts aggregateOptions) {
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.servingStale() {
+		// The selected feeds are served from their last good bodies; see selectedEvents.
+		c.Header("X-Serving-Stale-Aggregate", "true")
+	}
+	if opts.ifModifiedSince != "" {
+		since, _ := time.Parse(time.RFC3339, opts.ifModifiedSince)
+		if s.unmodifiedSince(opts, since) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	for _, hash := range opts.pins {
+		if !s.history.has(hash) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no snapshot with hash " + hash})
+			return
+		}
+	}
+	if selected := s.selectedFeeds(opts); len(selected) == 1 {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": selected[0].downloadFilename()}))
+	}
+	timedOut, skipped := &feedNames{}, &feedNames{}
+	c.Request = c.Request.WithContext(withSkipped(withDeadlines(c.Request.Context(), timedOut), skipped))
+	if opts.sortBy != "" || opts.warningsHeader || s.cfg.Dedup.Enabled || s.cfg.Strict || s.cfg.MaxOutputBytes > 0 || s.cfg.MaxEventsPerDay > 0 || s.cfg.IndexEvent {
+		s.aggregateICSBuffered(c, opts, timedOut, skipped)
+		return
+	}
+
+	// The ages are read before loading, so feeds fetched for this request count as fresh.
+	c.Header("X-Feed-Age-Seconds", s.feedAgesHeader(c.Request.Context(), opts))
+	eventChan, _ := s.aggregateEvents(c.Request.Context(), opts)
+
+	// Stream events to the client, wrapped in a single VCALENDAR. Which feeds
+	// time out or are skipped, and the checksum, are only known at the end, so
+	// the stream reports them in trailers.
+	c.Header("Content-Type", s.cfg.ContentType)
+	c.Header("Trailer", timedOutHeader+", "+skippedHeader+", "+checksumHeader)
+	checksum := newChecksumWriter(c.Writer)
+	out := s.cfg.outputWriter(checksum)
+	s.writeCalendarStart(out, opts)
+	c.Stream(func(io.Writer) bool {
+		if event, ok := <-eventChan; ok {
+			io.WriteString(out, event)
+			return true
+		}
+		io.WriteString(out, calendarFooter)
+		return false
+	})
+	if names := timedOut.header(s.cfg.Feeds); names != "" {
+		c.Writer.Header().Set(timedOutHeader, names)
+	}
+	if names := skipped.header(s.cfg.Feeds); names != "" {
+		c.Writer.Header().Set(skippedHeader, names)
+	}
+	c.Writer.Header().Set(checksumHeader, checksum.sum())
+}
+
+// aggregateICSBuffered waits for every feed before writing the combined
+// events, for responses that are sorted, deduplicated, capped in size, led by
+// the index event, or whose headers depend on every feed. In strict mode a
+// feed that failed to load or had a validation error fails the whole request
+// with a 502.
+//
+// Parameters:
+// - c: The request context.
+// - opts: The per-request aggregation settings.
+// - timedOut: The collector of the feeds that miss their deadline, carried by the request's context.
+// - skipped: The collector of the feeds skipped for their size, carried by the request's context.
+func (s *server) aggregateICSBuffered(c *gin.Context, opts aggregateOptions, timedOut, skipped *feedNames) {
+	c.Header("X-Feed-Age-Seconds", s.feedAgesHeader(c.Request.Context(), opts))
+	feedEvents, warnings, errs := s.collectEvents(c.Request.Context(), opts)
+	if names := timedOut.header(s.cfg.Feeds); names != "" {
+		c.Header(timedOutHeader, names)
+	}
+	if names := skipped.header(s.cfg.Feeds); names != "" {
+		c.Header(skippedHeader, names)
+	}
+	if s.cfg.Strict {
+		if err := s.strictFailure(warnings, errs); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if s.cfg.Dedup.Enabled {
+		feedEvents = dedupEvents(feedEvents, s.cfg.Dedup)
+	}
+	if s.cfg.MaxEventsPerDay > 0 {
+		by := opts.sortBy
+		if by == "" {
+			by = sortByStart
+		}
+		feedEvents = capPerDay(feedEvents, orderEvents(feedEvents, s.cfg.Sort.Concurrency, by), s.cfg.MaxEventsPerDay)
+	}
+	if s.cfg.MaxOutputBytes > 0 {
+		var truncated bool
+		if feedEvents, truncated = s.capOutput(feedEvents, opts); truncated {
+			c.Header("X-Truncated-Bytes", "true")
+		}
+	}
+	counts := make([]int, len(feedEvents))
+	var events []*ics.VEvent
+	warningCount := 0
+	for i := range feedEvents {
+		counts[i] = len(feedEvents[i])
+		events = append(events, feedEvents[i]...)
+		warningCount += len(warnings[i].list())
+	}
+	if opts.sortBy != "" {
+		events = orderEvents(feedEvents, s.cfg.Sort.Concurrency, opts.sortBy)
+	}
+
+	if opts.warningsHeader {
+		c.Header("X-Parse-Warnings", strconv.Itoa(warningCount))
+	}
+	var body bytes.Buffer
+	out := s.cfg.outputWriter(&body)
+	s.writeCalendarStart(out, opts)
+	warn := newLineWarner(c.Request.Context(), s.cfg.WarnLineOctets)
+	s.writeIndexEvent(out, counts, opts.as, warn)
+	for _, event := range events {
+		io.WriteString(out, serializeEvent(event, opts.as, s.cfg.FoldOctets, warn))
+	}
+	io.WriteString(out, calendarFooter)
+	s.serveCalendar(c, body.Bytes())
+}
+
+// End, server.go
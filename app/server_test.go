@@ -0,0 +1,995 @@
+// server_test.go
+// This file contains tests for the HTTP endpoints.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newFeedServer starts a stub upstream serving the given calendar body.
+func newFeedServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestConfig returns a configuration aggregating the mock Colombian and
+// Canadian calendars served by stub upstreams.
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.Feeds = []FeedConfig{
+		{Name: "Colombia", URL: newFeedServer(t, mockColombianCalendar).URL, Country: "CO"},
+		{Name: "Canada", URL: newFeedServer(t, mockCanadianCalendar).URL, Country: "CA"},
+	}
+	return cfg
+}
+
+// getBody requests url and returns the response body, failing the test on error.
+func getBody(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Error requesting %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", url, err)
+	}
+	return string(body)
+}
+
+// TestAggregateICSGzip tests that gzip-accepting clients get a compressed, valid calendar.
+func TestAggregateICSGzip(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/aggregate_ics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	// Disable transparent decompression so the raw encoding is visible.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("Error opening gzip body: %v", err)
+	}
+	cal, err := ics.ParseCalendar(zr)
+	if err != nil {
+		t.Fatalf("Error parsing decompressed calendar: %v", err)
+	}
+	if got := len(cal.Events()); got != 4 {
+		t.Errorf("Expected 4 events, got %d", got)
+	}
+}
+
+// TestGzipMiddlewareNoBody tests that responses without a body, 204 and 304
+// answers and empty 200s, go out without Content-Encoding, while a body is
+// compressed.
+func TestGzipMiddlewareNoBody(t *testing.T) {
+	r := gin.New()
+	r.Use(gzipMiddleware())
+	r.GET("/no-content", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.GET("/not-modified", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+	r.GET("/empty", func(c *gin.Context) { c.Data(http.StatusOK, "text/calendar", nil) })
+	r.GET("/body", func(c *gin.Context) { c.String(http.StatusOK, "BEGIN:VCALENDAR") })
+
+	for path, want := range map[string]string{"/no-content": "", "/not-modified": "", "/empty": "", "/body": "gzip"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != want {
+			t.Errorf("%s: Expected Content-Encoding %q, got %q", path, want, got)
+		}
+		if want == "" && rec.Body.Len() != 0 {
+			t.Errorf("%s: Expected no body, got %q", path, rec.Body.String())
+		}
+	}
+}
+
+// TestAggregateICSCompressionDisabled tests that compression can be turned off.
+func TestAggregateICSCompressionDisabled(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Compression = false
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/aggregate_ics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no Content-Encoding, got %q", got)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "Canada Day") {
+		t.Errorf("Expected uncompressed body to contain 'Canada Day'")
+	}
+}
+
+// TestAggregateICSNoCache tests that nocache=true refetches while normal requests use the cache.
+func TestAggregateICSNoCache(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	getBody(t, srv.URL+"/aggregate_ics")
+	if got := fetches.Load(); got != 1 {
+		t.Fatalf("Expected 1 fetch after the first request, got %d", got)
+	}
+
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Expected the cached feed to be reused, got %d fetches", got)
+	}
+	if !strings.Contains(body, "Canada Day") {
+		t.Errorf("Expected cached response to contain 'Canada Day'")
+	}
+
+	getBody(t, srv.URL+"/aggregate_ics?nocache=true")
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("Expected nocache=true to fetch again, got %d fetches", got)
+	}
+
+	getBody(t, srv.URL+"/aggregate_ics")
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("Expected the refreshed cache entry to be reused, got %d fetches", got)
+	}
+}
+
+// TestAggregateICSMinRefresh tests that forced fetches sooner than
+// min_refresh_seconds, one after the other or at once, reach upstream once.
+func TestAggregateICSMinRefresh(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Cache.MinRefreshSeconds = 60
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	getBody(t, srv.URL+"/aggregate_ics?nocache=true")
+	body := getBody(t, srv.URL+"/aggregate_ics?nocache=true")
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Expected the second forced refresh to reuse the first fetch, got %d fetches", got)
+	}
+	if !strings.Contains(body, "Canada Day") {
+		t.Errorf("Expected the coalesced response to contain 'Canada Day'")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL + "/aggregate_ics?nocache=true")
+			if err != nil {
+				t.Errorf("Error requesting aggregate: %v", err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Expected concurrent forced refreshes to be coalesced, got %d fetches", got)
+	}
+}
+
+// TestAggregateICSContentType tests that content_type overrides the
+// Content-Type of both streamed and buffered calendars.
+func TestAggregateICSContentType(t *testing.T) {
+	cfg := newTestConfig(t)
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/calendar; charset=utf-8" {
+		t.Errorf("Expected the default Content-Type, got %q", got)
+	}
+
+	cfg = newTestConfig(t)
+	cfg.ContentType = "text/plain; charset=utf-8"
+	overridden := httptest.NewServer(newRouter(cfg))
+	defer overridden.Close()
+	for _, path := range []string{"/aggregate_ics", "/aggregate_ics?sort=start"} {
+		resp, err := http.Get(overridden.URL + path)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Type"); got != cfg.ContentType {
+			t.Errorf("%s: Expected Content-Type %q, got %q", path, cfg.ContentType, got)
+		}
+	}
+}
+
+// TestAggregateICSMaxFeedsPerRequest tests that a feed selection naming more
+// feeds than max_feeds_per_request is rejected, while smaller ones are served.
+func TestAggregateICSMaxFeedsPerRequest(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.MaxFeedsPerRequest = 1
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?feed=Canada", http.StatusOK},
+		{"?feed=Canada,canada", http.StatusOK},
+		{"?feed=Canada,Colombia", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + "/aggregate_ics" + tt.query)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %v", tt.query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: Expected status %d, got %d", tt.query, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+// TestAggregateICSDeriveCategories tests that derive_categories files events
+// under their feed's country, region, and categories, keeping existing ones
+// and not repeating those already listed.
+func TestAggregateICSDeriveCategories(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.DeriveCategories = true
+	cfg.Feeds = cfg.Feeds[1:]
+	cfg.Feeds[0].Region = "Ontario"
+	cfg.Feeds[0].Categories = []string{"Holiday"}
+	cfg.Feeds[0].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:canada-day\nSUMMARY:Canada Day\nCATEGORIES:Public Holiday,ca\nDTSTART;VALUE=DATE:20230701\nEND:VEVENT\nEND:VCALENDAR\n").URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	event := parseMockEvent(t, getBody(t, srv.URL+"/aggregate_ics"))
+	want := "Public Holiday,ca,Ontario,Holiday"
+	if got := strings.Join(eventCategories(event), ","); got != want {
+		t.Errorf("Expected categories %s, got %s", want, got)
+	}
+}
+
+// TestAggregateICSCountry tests that country=CA keeps only Canadian events.
+func TestAggregateICSCountry(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics?country=ca")
+	if !strings.Contains(body, "Canada Day") || !strings.Contains(body, "Canadian New Year") {
+		t.Errorf("Expected Canadian events in the filtered calendar")
+	}
+	if strings.Contains(body, "Colombian") {
+		t.Errorf("Expected Colombian events to be filtered out")
+	}
+}
+
+// TestAggregateICSSortByStart tests that sort=start orders the calendar by DTSTART,
+// keeping feed order for events on the same day.
+func TestAggregateICSSortByStart(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics?sort=start")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	var got []string
+	for _, event := range cal.Events() {
+		got = append(got, propertyValue(event, ics.ComponentPropertySummary))
+	}
+	want := "Colombian New Year,Canadian New Year,Canada Day,Colombian Independence Day"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected order %s, got %s", want, strings.Join(got, ","))
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics?sort=bogus")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown sort, got %d", resp.StatusCode)
+	}
+}
+
+// TestAggregateICSAsVTodo tests that as=vtodo outputs VTODOs due on each event's start date.
+func TestAggregateICSAsVTodo(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics?as=vtodo&country=CA")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	if got := len(cal.Events()); got != 0 {
+		t.Errorf("Expected no VEVENTs, got %d", got)
+	}
+
+	due := map[string]string{}
+	for _, todo := range cal.Todos() {
+		due[todo.GetProperty(ics.ComponentPropertySummary).Value] = todo.GetProperty(ics.ComponentPropertyDue).Value
+		if todo.GetProperty(ics.ComponentPropertyDtStart) != nil {
+			t.Errorf("Expected DTSTART to become DUE")
+		}
+	}
+	want := map[string]string{"Canadian New Year": "20230101", "Canada Day": "20230701"}
+	if len(due) != len(want) {
+		t.Fatalf("Expected %d VTODOs, got %d", len(want), len(due))
+	}
+	for summary, date := range want {
+		if due[summary] != date {
+			t.Errorf("Expected %s due %s, got %q", summary, date, due[summary])
+		}
+	}
+}
+
+// TestAggregateICSAsVJournal tests that as=vjournal outputs VJOURNALs keeping
+// each event's SUMMARY, DTSTART, and DESCRIPTION.
+func TestAggregateICSAsVJournal(t *testing.T) {
+	cfg := newTestConfig(t)
+	described := strings.ReplaceAll(mockCanadianCalendar, "END:VEVENT\n", "DESCRIPTION:A statutory holiday\nDTEND;VALUE=DATE:20230702\nEND:VEVENT\n")
+	cfg.Feeds[1].URL = newFeedServer(t, described).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics?as=vjournal&country=CA")
+	cal, err := ics.ParseCalendar(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	if got := len(cal.Events()); got != 0 {
+		t.Errorf("Expected no VEVENTs, got %d", got)
+	}
+
+	want := map[string]string{"Canadian New Year": "20230101", "Canada Day": "20230701"}
+	journals := cal.Journals()
+	if len(journals) != len(want) {
+		t.Fatalf("Expected %d VJOURNALs, got %d:\n%s", len(want), len(journals), body)
+	}
+	for _, journal := range journals {
+		summary := journal.GetProperty(ics.ComponentPropertySummary).Value
+		if got := journal.GetProperty(ics.ComponentPropertyDtStart); got == nil || got.Value != want[summary] {
+			t.Errorf("Expected %s dated %s, got %v", summary, want[summary], got)
+		}
+		if got := journal.GetProperty(ics.ComponentPropertyDescription); got == nil || got.Value != "A statutory holiday" {
+			t.Errorf("Expected %s to keep its DESCRIPTION, got %v", summary, got)
+		}
+		if journal.GetProperty(ics.ComponentPropertyDtEnd) != nil {
+			t.Errorf("Expected %s to drop its DTEND", summary)
+		}
+	}
+}
+
+// TestAggregateICSColor tests that events carry their feed's COLOR, and that a
+// single-feed calendar carries it too.
+func TestAggregateICSColor(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[0].Color = "Yellow"
+	cfg.Feeds[1].Color = "red"
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	for _, event := range cal.Events() {
+		want := "red"
+		if strings.HasPrefix(propertyValue(event, ics.ComponentPropertySummary), "Colombian") {
+			want = "yellow"
+		}
+		if got := propertyValue(event, propertyColor); got != want {
+			t.Errorf("Expected %s COLOR %s, got %q", propertyValue(event, ics.ComponentPropertySummary), want, got)
+		}
+	}
+	if strings.Contains(getBody(t, srv.URL+"/aggregate_ics"), "METHOD:PUBLISH\r\nCOLOR:") {
+		t.Errorf("Expected no calendar COLOR for several feeds")
+	}
+
+	body := getBody(t, srv.URL+"/aggregate_ics?feed=canada")
+	if !strings.Contains(body, "METHOD:PUBLISH\r\nCOLOR:red\r\n") {
+		t.Errorf("Expected the single-feed calendar to carry COLOR:red")
+	}
+	if strings.Contains(body, "Colombian") {
+		t.Errorf("Expected feed=canada to leave out the Colombian feed")
+	}
+}
+
+// TestAggregateICSMethodPublish tests that the combined calendar is published
+// even when a source is an invitation.
+func TestAggregateICSMethodPublish(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, strings.Replace(mockCanadianCalendar, "VERSION:2.0\n", "VERSION:2.0\nMETHOD:REQUEST\n", 1)).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	var methods []string
+	for _, prop := range cal.CalendarProperties {
+		if prop.IANAToken == string(ics.PropertyMethod) {
+			methods = append(methods, prop.Value)
+		}
+	}
+	if strings.Join(methods, ",") != "PUBLISH" {
+		t.Errorf("Expected a single METHOD:PUBLISH, got %q", methods)
+	}
+	if len(cal.Events()) != 4 {
+		t.Errorf("Expected the invitation's events to be kept, got %d events", len(cal.Events()))
+	}
+}
+
+// TestAggregateICSIndexEvent tests that the index event reports per-feed counts
+// and comes before the feeds' events.
+func TestAggregateICSIndexEvent(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.IndexEvent = true
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics?country=CA")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	if events := cal.Events(); len(events) == 0 || events[0].Id() != indexEventUID {
+		t.Errorf("Expected the index event first, got %v", eventUIDs(events))
+	}
+
+	var index *ics.VEvent
+	for _, event := range cal.Events() {
+		if event.Id() == indexEventUID {
+			index = event
+		}
+	}
+	if index == nil {
+		t.Fatalf("Expected the aggregate to contain the index event")
+	}
+	want := "Colombia: 0 events\nCanada: 2 events"
+	if got := propertyValue(index, ics.ComponentPropertyDescription); got != want {
+		t.Errorf("Expected index description %q, got %q", want, got)
+	}
+	if got, want := propertyValue(index, ics.ComponentPropertyDtStart), time.Now().Format("20060102"); got != want {
+		t.Errorf("Expected index on %s, got %s", want, got)
+	}
+}
+
+// TestAggregateICSEmptyFeedPlaceholder tests that a valid feed without events
+// is represented by its placeholder, while feeds with events get none.
+func TestAggregateICSEmptyFeedPlaceholder(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.EmptyFeedPlaceholder = true
+	cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: "Atlantis", URL: newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nEND:VCALENDAR\n").URL})
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	var placeholders []string
+	for _, event := range cal.Events() {
+		if summary := propertyValue(event, ics.ComponentPropertySummary); strings.HasPrefix(summary, "No holidays") {
+			placeholders = append(placeholders, summary)
+			if got, want := propertyValue(event, ics.ComponentPropertyDtStart), time.Now().Format("20060102"); got != want {
+				t.Errorf("Expected the placeholder on %s, got %s", want, got)
+			}
+		}
+	}
+	if len(cal.Events()) != 5 || len(placeholders) != 1 || placeholders[0] != "No holidays from Atlantis" {
+		t.Errorf("Expected the 4 mock events and one placeholder for Atlantis, got %d events and %q", len(cal.Events()), placeholders)
+	}
+}
+
+// TestFeedEventsDateFormat tests that a feed's date-format hint lets non-standard dates parse.
+func TestFeedEventsDateFormat(t *testing.T) {
+	feedData := strings.Replace(mockCanadianCalendar, "DTSTART;VALUE=DATE:20230701", "DTSTART:2023/07/01", 1)
+	feed := FeedConfig{Name: "Canada", URL: newFeedServer(t, feedData).URL, DateFormat: "2006/01/02"}
+	s := newServer(defaultConfig())
+
+	events, err := s.feedEvents(context.Background(), feed, false)
+	if err != nil {
+		t.Fatalf("Error loading feed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	start, err := events[1].GetAllDayStartAt()
+	if err != nil {
+		t.Fatalf("Expected the normalized DTSTART to parse: %v", err)
+	}
+	if got := start.Format("2006-01-02"); got != "2023-07-01" {
+		t.Errorf("Expected Canada Day on 2023-07-01, got %s", got)
+	}
+}
+
+// TestFeedTimeoutOverride tests that a per-feed timeout overrides a short global timeout.
+func TestFeedTimeoutOverride(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer slow.Close()
+
+	cfg := defaultConfig()
+	cfg.HTTPTimeoutSeconds = 0.05
+	s := newServer(cfg)
+
+	if _, err := s.feedEvents(context.Background(), FeedConfig{Name: "Slow", URL: slow.URL}, true); err == nil {
+		t.Errorf("Expected the global timeout to abort the slow feed")
+	}
+
+	events, err := s.feedEvents(context.Background(), FeedConfig{Name: "Slow", URL: slow.URL, TimeoutSeconds: 5}, true)
+	if err != nil {
+		t.Fatalf("Expected the per-feed timeout to let the slow feed succeed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got %d", len(events))
+	}
+}
+
+// TestAggregateICSFeedAge tests that each feed's data age is reported and that
+// serving data past the threshold logs a warning.
+func TestAggregateICSFeedAge(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	cfg := newTestConfig(t)
+	cfg.Cache.WarnAgeSeconds = 60
+	s := newServer(cfg)
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	// Cache Colombia as fetched two minutes ago; Canada is fetched by the request.
+	fetchedAt := time.Now().Add(-2 * time.Minute)
+	s.cache.now = func() time.Time { return fetchedAt }
+	s.cache.set(cfg.Feeds[0].request().Key(), mockColombianCalendar)
+	s.cache.now = time.Now
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if got := resp.Header.Get("X-Feed-Age-Seconds"); got != "Colombia=120, Canada=0" {
+		t.Errorf("Expected X-Feed-Age-Seconds Colombia=120, Canada=0, got %q", got)
+	}
+	if !strings.Contains(logs.String(), "Serving Colombia data that is 2m0s old") {
+		t.Errorf("Expected a stale data warning for Colombia, got logs:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "Serving Canada") {
+		t.Errorf("Expected no stale data warning for the freshly fetched Canada feed")
+	}
+}
+
+// TestAggregateICSIfModifiedSince tests that a client is answered 304 until a
+// cached feed carries a LAST-MODIFIED newer than its copy.
+func TestAggregateICSIfModifiedSince(t *testing.T) {
+	cfg := newTestConfig(t)
+	s := newServer(cfg)
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	modified := func(body, stamp string) string {
+		return strings.Replace(body, "END:VEVENT", "LAST-MODIFIED:"+stamp+"\nEND:VEVENT", 1)
+	}
+	s.cache.set(cfg.Feeds[0].request().Key(), modified(mockColombianCalendar, "20240101T000000Z"))
+	s.cache.set(cfg.Feeds[1].request().Key(), modified(mockCanadianCalendar, "20240301T000000Z"))
+	url := srv.URL + "/aggregate_ics?if_modified_since=2024-06-01T00:00:00Z"
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304 with no newer feed, got %d", resp.StatusCode)
+	}
+
+	s.cache.set(cfg.Feeds[1].request().Key(), modified(mockCanadianCalendar, "20240701T000000Z"))
+	resp, err = http.Get(url)
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 once Canada is newer, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "BEGIN:VEVENT") {
+		t.Errorf("Expected the aggregate to be served, got:\n%s", body)
+	}
+
+	resp, err = http.Get(srv.URL + "/aggregate_ics?if_modified_since=yesterday")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid time, got %d", resp.StatusCode)
+	}
+}
+
+// TestAggregateICSStrict tests that strict mode fails the request when one feed
+// is malformed, while the lenient default serves the other feed.
+func TestAggregateICSStrict(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[0].URL = newFeedServer(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:new-year@example.com
+DTSTAMP:20230101T000000Z
+SUMMARY:Colombian New Year
+DTSTART;VALUE=DATE:20230101
+END:VEVENT
+END:VCALENDAR
+`).URL
+	cfg.Feeds[1].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nSUMMARY:Canada Day\n").URL
+
+	for _, strict := range []bool{false, true} {
+		cfg.Strict = strict
+		srv := httptest.NewServer(newRouter(cfg))
+		resp, err := http.Get(srv.URL + "/aggregate_ics")
+		if err != nil {
+			t.Fatalf("Error requesting aggregate: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+
+		if strict {
+			if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "Canada") {
+				t.Errorf("Expected strict mode to fail with a 502 naming Canada, got %d: %s", resp.StatusCode, body)
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "SUMMARY:Colombian New Year") {
+			t.Errorf("Expected lenient mode to serve Colombia, got %d: %s", resp.StatusCode, body)
+		}
+	}
+}
+
+// TestAggregateICSStrictAdvisory tests that strict mode serves valid feeds
+// whose only warnings are advisory, such as vendor X- properties.
+func TestAggregateICSStrictAdvisory(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Strict = true
+	cfg.Feeds[1].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:canada-day@example.com\nDTSTAMP:20230101T000000Z\nSUMMARY:Canada Day\nDTSTART;VALUE=DATE:20230701\nX-GOOGLE-CONFERENCE:https://meet.google.com/abc-defg-hij\nEND:VEVENT\nEND:VCALENDAR\n").URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics?warnings=header&feed=Canada")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "SUMMARY:Canada Day") {
+		t.Errorf("Expected strict mode to serve Canada, got %d: %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("X-Parse-Warnings"); got == "0" || got == "" {
+		t.Errorf("Expected the X- property to still be warned about, got X-Parse-Warnings %q", got)
+	}
+}
+
+// TestAggregateICSFeedParsing tests that a feed cut off in its last event is
+// served best-effort under lenient parsing, and fails alone under strict.
+func TestAggregateICSFeedParsing(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:new-year@example.com\nDTSTAMP:20230101T000000Z\nSUMMARY:Canadian New Year\nDTSTART;VALUE=DATE:20230101\nEND:VEVENT\nBEGIN:VEVENT\nSUMMARY:Canada Day\n").URL
+
+	for _, parsing := range []string{parsingLenient, parsingStrict} {
+		cfg.Feeds[1].Parsing = parsing
+		srv := httptest.NewServer(newRouter(cfg))
+		body := getBody(t, srv.URL+"/aggregate_ics")
+		srv.Close()
+
+		if !strings.Contains(body, "SUMMARY:Colombian New Year") {
+			t.Errorf("%s: Expected Colombia to be served, got:\n%s", parsing, body)
+		}
+		served := strings.Contains(body, "SUMMARY:Canadian New Year")
+		if parsing == parsingLenient && !served {
+			t.Errorf("Expected lenient parsing to serve Canada's complete event, got:\n%s", body)
+		}
+		if parsing == parsingStrict && served {
+			t.Errorf("Expected strict parsing to fail Canada, got:\n%s", body)
+		}
+	}
+
+	path := writeConfig(t, "feeds:\n  - name: Canada\n    url: http://example.com/ca.ics\n    parsing: loose\n")
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "parsing") {
+		t.Errorf("Expected an unknown parsing to be rejected, got %v", err)
+	}
+}
+
+// TestFeedParsingStrictWarnings tests that a feed with strict parsing serves
+// past advisory warnings and still reports them in /warnings.
+func TestFeedParsingStrictWarnings(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].Parsing = parsingStrict
+	cfg.Feeds[1].URL = newFeedServer(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:canada-day@example.com\nDTSTAMP:20230101T000000Z\nSUMMARY:Canada Day\nDTSTART;VALUE=DATE:20230701\nX-GOOGLE-CONFERENCE:https://meet.google.com/abc-defg-hij\nEND:VEVENT\nEND:VCALENDAR\n").URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	if body := getBody(t, srv.URL+"/aggregate_ics?feed=Canada"); !strings.Contains(body, "SUMMARY:Canada Day") {
+		t.Errorf("Expected strict parsing to serve Canada, got:\n%s", body)
+	}
+	if body := getBody(t, srv.URL+"/warnings?feed=Canada"); !strings.Contains(body, "unknown property X-GOOGLE-CONFERENCE") {
+		t.Errorf("Expected /warnings to report the X- property, got:\n%s", body)
+	}
+}
+
+// TestAggregateICSDownloadFilename tests that single-feed responses name the
+// feed's download filename in Content-Disposition.
+func TestAggregateICSDownloadFilename(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].DownloadFilename = "canada-holidays.ics"
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "?feed=canada", want: "attachment; filename=canada-holidays.ics"},
+		{query: "?feed=Colombia", want: "attachment; filename=colombia.ics"},
+		{query: "", want: ""},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + "/aggregate_ics" + tt.query)
+		if err != nil {
+			t.Fatalf("Error requesting aggregate: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Disposition"); got != tt.want {
+			t.Errorf("%q: expected Content-Disposition %q, got %q", tt.query, tt.want, got)
+		}
+	}
+}
+
+// TestAggregateICSClass tests that every aggregated event is served with the
+// default CLASS:PUBLIC.
+func TestAggregateICSClass(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	events, classes := strings.Count(body, "BEGIN:VEVENT"), strings.Count(body, "CLASS:PUBLIC\r\n")
+	if events == 0 || classes != events {
+		t.Errorf("Expected CLASS:PUBLIC on all %d events, got %d:\n%s", events, classes, body)
+	}
+}
+
+// TestAggregateICSMaxOutputBytes tests that a capped aggregate fits the cap by
+// dropping the furthest-future event while keeping the nearest ones.
+func TestAggregateICSMaxOutputBytes(t *testing.T) {
+	cfg := newTestConfig(t)
+	srv := httptest.NewServer(newRouter(cfg))
+	full := getBody(t, srv.URL+"/aggregate_ics")
+	srv.Close()
+
+	cfg.MaxOutputBytes = len(full) - 1
+	srv = httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading aggregate: %v", err)
+	}
+	body := string(data)
+
+	if len(body) > cfg.MaxOutputBytes {
+		t.Errorf("Expected at most %d bytes, got %d", cfg.MaxOutputBytes, len(body))
+	}
+	if got := resp.Header.Get("X-Truncated-Bytes"); got != "true" {
+		t.Errorf("Expected X-Truncated-Bytes: true, got %q", got)
+	}
+	if strings.Contains(body, "Colombian Independence Day") {
+		t.Errorf("Expected the furthest-future event to be dropped, got:\n%s", body)
+	}
+	for _, summary := range []string{"Colombian New Year", "Canadian New Year", "Canada Day"} {
+		if !strings.Contains(body, "SUMMARY:"+summary) {
+			t.Errorf("Expected %s to be kept, got:\n%s", summary, body)
+		}
+	}
+}
+
+// TestAggregateICSAllowedProperties tests that properties outside the allowlist
+// are stripped from events and the calendar while the required ones remain.
+func TestAggregateICSAllowedProperties(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.AllowedProperties = []string{"summary"}
+	cfg.Feeds[1].URL = newFeedServer(t, strings.Replace(mockCanadianCalendar, "SUMMARY:Canada Day", "SUMMARY:Canada Day\nUID:canada-day@example.com\nDTSTAMP:20230101T000000Z\nX-PROVIDER-ID:42\nLOCATION:Ottawa", 1)).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	for _, stripped := range []string{"X-PROVIDER-ID", "LOCATION", "METHOD", "COLOR"} {
+		if strings.Contains(body, stripped) {
+			t.Errorf("Expected %s to be stripped, got:\n%s", stripped, body)
+		}
+	}
+	for _, kept := range []string{"VERSION:2.0", "PRODID:", "UID:canada-day@example.com", "DTSTAMP:20230101T000000Z", "DTSTART;VALUE=DATE:20230701", "SUMMARY:Canada Day"} {
+		if !strings.Contains(body, kept) {
+			t.Errorf("Expected %s to remain, got:\n%s", kept, body)
+		}
+	}
+}
+
+// TestAggregateICSExcludeSummaries tests that a feed's exclude_summaries
+// removes matching events from that feed only.
+func TestAggregateICSExcludeSummaries(t *testing.T) {
+	clockChange := func(calendar string) string {
+		return strings.Replace(calendar, "END:VCALENDAR", "BEGIN:VEVENT\nSUMMARY:Clock  Change\nDTSTART;VALUE=DATE:20230326\nEND:VEVENT\nEND:VCALENDAR", 1)
+	}
+	cfg := newTestConfig(t)
+	cfg.Feeds[0].URL = newFeedServer(t, clockChange(mockColombianCalendar)).URL
+	cfg.Feeds[1].URL = newFeedServer(t, clockChange(mockCanadianCalendar)).URL
+	cfg.Feeds[1].ExcludeSummaries = []string{"clock change", "Canada *"}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	if got := strings.Count(body, "SUMMARY:Clock  Change"); got != 1 {
+		t.Errorf("Expected only the Colombian clock change to remain, got %d:\n%s", got, body)
+	}
+	if strings.Contains(body, "SUMMARY:Canada Day") {
+		t.Errorf("Expected Canada Day to match Canada *, got:\n%s", body)
+	}
+	if !strings.Contains(body, "SUMMARY:Canadian New Year") {
+		t.Errorf("Expected unmatched Canadian events to remain, got:\n%s", body)
+	}
+}
+
+// TestAggregateICSOnly tests that only events whose SUMMARY matches a name of
+// the only list survive, exactly or as a substring per only_match, and that
+// ?only replaces the configured list.
+func TestAggregateICSOnly(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Only = []string{"canada day", "Colombian  Independence Day"}
+
+	tests := []struct {
+		match string
+		query string
+		want  []string
+	}{
+		{onlyMatchExact, "", []string{"Colombian Independence Day", "Canada Day"}},
+		{onlyMatchExact, "?only=New+Year,Canada+Day", []string{"Canada Day"}},
+		{onlyMatchSubstring, "?only=New+Year,Canada+Day", []string{"Colombian New Year", "Canadian New Year", "Canada Day"}},
+	}
+	for _, test := range tests {
+		cfg.OnlyMatch = test.match
+		srv := httptest.NewServer(newRouter(cfg))
+		body := getBody(t, srv.URL+"/aggregate_ics"+test.query)
+		srv.Close()
+
+		if got := strings.Count(body, "SUMMARY:"); got != len(test.want) {
+			t.Errorf("%s %s: Expected %d events, got %d:\n%s", test.match, test.query, len(test.want), got, body)
+		}
+		for _, summary := range test.want {
+			if !strings.Contains(body, "SUMMARY:"+summary+"\r\n") {
+				t.Errorf("%s %s: Expected %s to survive, got:\n%s", test.match, test.query, summary, body)
+			}
+		}
+	}
+}
+
+// TestAggregateICSWindow tests that an event straddling from is served while
+// events wholly outside the window are not.
+func TestAggregateICSWindow(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, strings.Replace(mockCanadianCalendar, "DTSTART;VALUE=DATE:20230101", "DTSTART;VALUE=DATE:20221230\nDTEND;VALUE=DATE:20230103", 1)).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics?from=2023-01-02&to=2023-07-10")
+	if !strings.Contains(body, "SUMMARY:Canadian New Year") {
+		t.Errorf("Expected the multi-day event straddling from, got:\n%s", body)
+	}
+	if !strings.Contains(body, "SUMMARY:Canada Day") {
+		t.Errorf("Expected the event inside the window, got:\n%s", body)
+	}
+	if strings.Contains(body, "SUMMARY:Colombian New Year") || strings.Contains(body, "SUMMARY:Colombian Independence Day") {
+		t.Errorf("Expected events outside the window to be dropped, got:\n%s", body)
+	}
+}
+
+// TestReadyz tests that readiness waits for the first refresh while liveness doesn't.
+func TestReadyz(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Refresh.IntervalSeconds = 60
+	s := newServer(cfg)
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	status := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 before the first refresh, got %d", got)
+	}
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("Expected /healthz 200 before the first refresh, got %d", got)
+	}
+
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+	if got := status("/readyz"); got != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after the first refresh, got %d", got)
+	}
+}
+
+// End, server_test.go
@@ -0,0 +1,38 @@
+// size.go
+// This file contains the skipping of feeds over skip_feeds_over_bytes and the
+// reporting of the feeds skipped.
+package main
+
+import "context"
+
+// skippedHeader names the feeds left out of a response for being too large.
+const skippedHeader = "X-Skipped-Feeds"
+
+// skippedKey is the context key under which the skipped feeds are stored.
+type skippedKey struct{}
+
+// withSkipped returns a copy of ctx recording feeds skipped for their size into d.
+//
+// Parameters:
+// - ctx: The parent context.
+// - d: The collector receiving the feed names.
+//
+// Returns:
+// - The derived context.
+func withSkipped(ctx context.Context, d *feedNames) context.Context {
+	return context.WithValue(ctx, skippedKey{}, d)
+}
+
+// recordSkipped notes that a feed was skipped for its size in the collector
+// carried by ctx, if any.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - feed: The feed that was skipped.
+func recordSkipped(ctx context.Context, feed FeedConfig) {
+	if d, ok := ctx.Value(skippedKey{}).(*feedNames); ok {
+		d.add(feed)
+	}
+}
+
+// End, size.go
@@ -0,0 +1,57 @@
+// size_test.go
+// This file contains tests for skipping oversized feeds.
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSkipFeedsOverBytes tests that a feed over skip_feeds_over_bytes is left
+// out of the aggregate and named in X-Skipped-Feeds, as a header when buffering
+// and a trailer when streaming, while the small feed is served.
+func TestSkipFeedsOverBytes(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.SkipFeedsOverBytes = 2048
+	oversized := strings.Replace(mockCanadianCalendar, "SUMMARY:Canada Day", "SUMMARY:Canada Day\nDESCRIPTION:"+strings.Repeat("x", 4096), 1)
+	cfg.Feeds[1].URL = newFeedServer(t, oversized).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	for _, path := range []string{"/aggregate_ics?sort=start", "/aggregate_ics"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: Expected status 200, got %d", path, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), "SUMMARY:Colombian New Year") || strings.Contains(string(body), "Canada") {
+			t.Errorf("%s: Expected only Colombia's events, got:\n%s", path, body)
+		}
+		got := resp.Header.Get(skippedHeader) + resp.Trailer.Get(skippedHeader)
+		if got != "Canada" {
+			t.Errorf("%s: Expected %s to name Canada, got %q", path, skippedHeader, got)
+		}
+	}
+
+	cfg.SkipFeedsOverBytes = 0
+	unlimited := httptest.NewServer(newRouter(cfg))
+	defer unlimited.Close()
+	resp, err := http.Get(unlimited.URL + "/aggregate_ics?sort=start")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(skippedHeader); got != "" {
+		t.Errorf("Expected no %s without a threshold, got %q", skippedHeader, got)
+	}
+}
+
+// End, size_test.go
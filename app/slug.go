@@ -0,0 +1,110 @@
+// slug.go
+// This file contains the friendly /f/:slug and /c/:slug routes.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nonSlug matches the runs of characters a slug replaces with a dash.
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a feed or collection name into a URL slug: lowercase ASCII
+// letters and digits, with every other run of characters replaced by a dash.
+//
+// Parameters:
+// - name: The name to slugify.
+//
+// Returns:
+// - The slug, empty if the name has no letters or digits.
+func slugify(name string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// slugRoutes maps the slugs of feeds and collections to their names.
+type slugRoutes struct {
+	feeds       map[string]string
+	collections map[string]string
+}
+
+// newSlugRoutes builds the slug lookup of every feed and collection. Names
+// without a usable slug are only reachable by name.
+//
+// Parameters:
+// - cfg: The configuration naming the feeds and collections.
+//
+// Returns:
+// - The slug lookup.
+// - An error naming the first two feeds, or collections, sharing a slug.
+func newSlugRoutes(cfg *Config) (slugRoutes, error) {
+	routes := slugRoutes{feeds: map[string]string{}, collections: map[string]string{}}
+	for _, feed := range cfg.Feeds {
+		if err := addSlug(routes.feeds, "feed", feed.Name); err != nil {
+			return slugRoutes{}, err
+		}
+	}
+	for name := range cfg.Collections {
+		if err := addSlug(routes.collections, "collection", name); err != nil {
+			return slugRoutes{}, err
+		}
+	}
+	return routes, nil
+}
+
+// addSlug records the slug of a name, rejecting collisions.
+//
+// Parameters:
+// - slugs: The slugs recorded so far.
+// - kind: "feed" or "collection", for the error.
+// - name: The name to record.
+//
+// Returns:
+// - An error if another name has the same slug.
+func addSlug(slugs map[string]string, kind, name string) error {
+	slug := slugify(name)
+	if slug == "" {
+		return nil
+	}
+	if other, taken := slugs[slug]; taken {
+		return fmt.Errorf("%s %q and %s %q share the URL slug %q", kind, other, kind, name, slug)
+	}
+	slugs[slug] = name
+	return nil
+}
+
+// feedBySlug serves the calendar of the feed with the given slug, accepting
+// the query parameters of aggregateICS. Unknown slugs are a 404.
+func (s *server) feedBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+	name, ok := s.slugs.feeds[slug]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no feed with slug " + slug})
+		return
+	}
+
+	opts := parseAggregateOptions(c)
+	opts.feeds = []string{name}
+	s.serveAggregate(c, opts)
+}
+
+// collectionBySlug serves the collection with the given slug like collection.
+// Unknown slugs are a 404.
+func (s *server) collectionBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+	name, ok := s.slugs.collections[slug]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no collection with slug " + slug})
+		return
+	}
+
+	opts := parseAggregateOptions(c)
+	opts.feeds = s.cfg.Collections[name]
+	s.serveAggregate(c, opts)
+}
+
+// End, slug.go
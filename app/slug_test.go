@@ -0,0 +1,49 @@
+// slug_test.go
+// This file contains tests for the slug routes.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFeedBySlug tests that /f/canada serves only the Canada feed and that
+// collections are reachable by slug.
+func TestFeedBySlug(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Collections = map[string][]string{"North America": {"Canada"}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	for _, path := range []string{"/f/canada", "/c/north-america"} {
+		body := getBody(t, srv.URL+path)
+		if !strings.Contains(body, "SUMMARY:Canada Day") {
+			t.Errorf("%s: expected the Canadian events, got:\n%s", path, body)
+		}
+		if strings.Contains(body, "Colombia") {
+			t.Errorf("%s: expected no Colombian events, got:\n%s", path, body)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/f/mexico")
+	if err != nil {
+		t.Fatalf("Error requesting feed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown slug, got %d", resp.StatusCode)
+	}
+}
+
+// TestNewSlugRoutesCollision tests that names sharing a slug are rejected.
+func TestNewSlugRoutesCollision(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: "CANADA!", URL: cfg.Feeds[1].URL})
+	if _, err := newSlugRoutes(cfg); err == nil || !strings.Contains(err.Error(), `"canada"`) {
+		t.Errorf("Expected a slug collision error, got %v", err)
+	}
+}
+
+// End, slug_test.go
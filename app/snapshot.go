@@ -0,0 +1,78 @@
+// snapshot.go
+// This file contains the atomic writer for on-disk calendar snapshots.
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// writeCalendar writes the given events wrapped in a single VCALENDAR, after
+// the zones of set_tz.
+//
+// Parameters:
+// - ctx: The context of the refresh or request, whose ID any log lines carry.
+// - w: The destination of the calendar data.
+// - feedEvents: The events of each feed, written in order.
+// - cfg: The configuration providing the PRODID, the METHOD, the folding width, and the blank-line cleanup.
+//
+// Returns:
+// - An error if writing failed.
+func writeCalendar(ctx context.Context, w io.Writer, feedEvents [][]*ics.VEvent, cfg *Config) error {
+	bw := bufio.NewWriter(cfg.outputWriter(w))
+	bw.WriteString(calendarStart(cfg))
+	bw.WriteString(timezoneComponents(cfg.Transforms, time.Now()))
+	warn := newLineWarner(ctx, cfg.WarnLineOctets)
+	for _, events := range feedEvents {
+		for _, event := range events {
+			bw.WriteString(serializeEvent(event, "", cfg.FoldOctets, warn))
+		}
+	}
+	bw.WriteString(calendarFooter)
+	return bw.Flush()
+}
+
+// writeSnapshot atomically replaces the file at path with the calendar
+// given data. The data is written to a temporary file in the same directory
+// and renamed into place, so readers never observe a partial snapshot. The
+// file is readable by everyone, like one written with os.WriteFile, rather
+// than only by the server's user as os.CreateTemp leaves it.
+//
+// Parameters:
+// - path: The snapshot file to replace.
+// - data: The combined calendar, as rendered by writeCalendar.
+//
+// Returns:
+// - An error if the snapshot could not be written.
+func writeSnapshot(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// End, snapshot.go
@@ -0,0 +1,173 @@
+// snapshot_test.go
+// This file contains tests for the refresher snapshots.
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestRefreshWritesSnapshot tests that a refresh cycle leaves a parsable,
+// world-readable snapshot.
+func TestRefreshWritesSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newTestConfig(t)
+	cfg.Snapshot.Path = filepath.Join(dir, "combined.ics")
+	s := newServer(cfg)
+
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.Snapshot.Path)
+	if err != nil {
+		t.Fatalf("Expected snapshot file to exist: %v", err)
+	}
+	cal, err := ics.ParseCalendar(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Error parsing snapshot: %v", err)
+	}
+	if got := len(cal.Events()); got != 4 {
+		t.Errorf("Expected 4 events in the snapshot, got %d", got)
+	}
+	if info, err := os.Stat(cfg.Snapshot.Path); err != nil {
+		t.Errorf("Error reading the snapshot's mode: %v", err)
+	} else if info.Mode().Perm() != 0o644 {
+		t.Errorf("Expected the snapshot to be readable by everyone, got mode %v", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot in %s, found %d entries", dir, len(entries))
+	}
+}
+
+// TestRefreshKeepsSnapshotWhenAllFeedsFail tests that a failed cycle doesn't overwrite the snapshot.
+func TestRefreshKeepsSnapshotWhenAllFeedsFail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "combined.ics")
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatalf("Error seeding snapshot: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Feeds = []FeedConfig{{Name: "Broken", URL: "http://127.0.0.1:0/missing.ics"}}
+	cfg.Snapshot.Path = path
+	if err := newServer(cfg).refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("Expected the previous snapshot to be kept, got %q", data)
+	}
+}
+
+// TestRefreshServesLastGoodAggregate tests that after a good refresh, a failing
+// one leaves the good aggregate served and flagged as stale.
+func TestRefreshServesLastGoodAggregate(t *testing.T) {
+	var broken atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if broken.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Cache.TTLSeconds = 0
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL}}
+	s := newServer(cfg)
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+	broken.Store(true)
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Serving-Stale-Aggregate"); got != "true" {
+		t.Errorf("Expected X-Serving-Stale-Aggregate true, got %q", got)
+	}
+	if !strings.Contains(string(body), "Canada Day") {
+		t.Errorf("Expected the last good aggregate, got:\n%s", body)
+	}
+
+	broken.Store(false)
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+	resp, err = http.Get(srv.URL + "/aggregate_ics")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Serving-Stale-Aggregate"); got != "" {
+		t.Errorf("Expected live data once a refresh succeeds, got X-Serving-Stale-Aggregate %q", got)
+	}
+}
+
+// TestRefreshStaleAggregateFiltered tests that a request selecting one feed
+// while the last good data is served gets only that feed's events.
+func TestRefreshStaleAggregateFiltered(t *testing.T) {
+	var broken atomic.Bool
+	upstream := func(calendar string) string {
+		feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if broken.Load() {
+				http.Error(w, "down", http.StatusInternalServerError)
+				return
+			}
+			io.WriteString(w, calendar)
+		}))
+		t.Cleanup(feed.Close)
+		return feed.URL
+	}
+
+	cfg := defaultConfig()
+	cfg.Cache.TTLSeconds = 0
+	cfg.Feeds = []FeedConfig{{Name: "Colombia", URL: upstream(mockColombianCalendar)}, {Name: "Canada", URL: upstream(mockCanadianCalendar)}}
+	s := newServer(cfg)
+	srv := httptest.NewServer(s.router())
+	defer srv.Close()
+
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+	broken.Store(true)
+	if err := s.refresh(context.Background()); err != nil {
+		t.Fatalf("Error refreshing: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics?feed=Canada")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Serving-Stale-Aggregate"); got != "true" {
+		t.Errorf("Expected X-Serving-Stale-Aggregate true, got %q", got)
+	}
+	if !strings.Contains(string(body), "SUMMARY:Canada Day") || strings.Contains(string(body), "Colombian") {
+		t.Errorf("Expected only Canada's last good events, got:\n%s", body)
+	}
+}
+
+// End, snapshot_test.go
@@ -0,0 +1,225 @@
+// sort.go
+// This file contains the ordering of aggregated events by start time or summary.
+package main
+
+import (
+	"container/heap"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const (
+	// sortByStart orders the aggregate by DTSTART.
+	sortByStart = "start"
+	// sortBySummary orders the aggregate alphabetically by SUMMARY, ignoring
+	// case, then by DTSTART.
+	sortBySummary = "summary"
+)
+
+// keyedEvent pairs an event with its precomputed sort key, so DTSTART is parsed
+// once per event rather than once per comparison.
+type keyedEvent struct {
+	// summary is the lowercased SUMMARY with sort=summary, and "" otherwise.
+	summary string
+	start   time.Time
+	// stamp is the DTSTAMP, so that the freshest of events starting together
+	// comes first.
+	stamp time.Time
+	uid   string
+	event *ics.VEvent
+}
+
+// before reports whether k sorts before other: by summary, then by start
+// time, then by newest DTSTAMP, then by UID.
+//
+// Parameters:
+// - other: The keyed event to compare with.
+//
+// Returns:
+// - True if k comes first.
+func (k keyedEvent) before(other keyedEvent) bool {
+	if k.summary != other.summary {
+		return k.summary < other.summary
+	}
+	if !k.start.Equal(other.start) {
+		return k.start.Before(other.start)
+	}
+	if !k.stamp.Equal(other.stamp) {
+		return k.stamp.After(other.stamp)
+	}
+	return k.uid < other.uid
+}
+
+// keyEvents computes the sort key of every event.
+//
+// Parameters:
+// - events: The events to key.
+// - by: The sort order, sortByStart or sortBySummary.
+//
+// Returns:
+// - The keyed events, in the same order.
+func keyEvents(events []*ics.VEvent, by string) []keyedEvent {
+	keyed := make([]keyedEvent, len(events))
+	for i, event := range events {
+		// Events without a parseable DTSTART keep the zero time and sort first,
+		// and those without a DTSTAMP sort after their ties that have one.
+		start, _ := eventStart(event)
+		stamp, _ := parseDateTime(event.GetProperty(ics.ComponentPropertyDtstamp))
+		keyed[i] = keyedEvent{start: start, stamp: stamp, uid: event.Id(), event: event}
+		if by == sortBySummary {
+			keyed[i].summary = strings.ToLower(propertyValue(event, ics.ComponentPropertySummary))
+		}
+	}
+	return keyed
+}
+
+// sortKeyed stably sorts keyed events by their keys.
+//
+// Parameters:
+// - keyed: The events to sort in place.
+func sortKeyed(keyed []keyedEvent) {
+	sort.SliceStable(keyed, func(i, j int) bool {
+		return keyed[i].before(keyed[j])
+	})
+}
+
+// sortEvents combines the events of every feed and sorts them on a single
+// goroutine. Events with equal keys, DTSTAMP and UID included, keep their feed
+// order, then their source order.
+//
+// Parameters:
+// - feedEvents: The events of each feed, in feed order.
+// - by: The sort order, sortByStart or sortBySummary.
+//
+// Returns:
+// - All events sorted.
+func sortEvents(feedEvents [][]*ics.VEvent, by string) []*ics.VEvent {
+	var keyed []keyedEvent
+	for _, events := range feedEvents {
+		keyed = append(keyed, keyEvents(events, by)...)
+	}
+	sortKeyed(keyed)
+
+	sorted := make([]*ics.VEvent, len(keyed))
+	for i, k := range keyed {
+		sorted[i] = k.event
+	}
+	return sorted
+}
+
+// mergeHead is the next unmerged event of one feed.
+type mergeHead struct {
+	feed int
+	pos  int
+}
+
+// mergeHeap is a min-heap of feed heads ordered by their keys, then feed index,
+// matching the order sortEvents produces for ties.
+type mergeHeap struct {
+	sorted [][]keyedEvent
+	heads  []mergeHead
+}
+
+func (h *mergeHeap) Len() int { return len(h.heads) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.heads[i], h.heads[j]
+	keyA, keyB := h.sorted[a.feed][a.pos], h.sorted[b.feed][b.pos]
+	if keyA.before(keyB) {
+		return true
+	}
+	if keyB.before(keyA) {
+		return false
+	}
+	return a.feed < b.feed
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+
+func (h *mergeHeap) Push(x any) { h.heads = append(h.heads, x.(mergeHead)) }
+
+func (h *mergeHeap) Pop() any {
+	head := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return head
+}
+
+// mergeSortEvents sorts each feed's events concurrently and k-way merges the
+// sorted feeds, producing the same order as sortEvents.
+//
+// Parameters:
+// - feedEvents: The events of each feed, in feed order.
+// - concurrency: The number of feeds sorted at once.
+// - by: The sort order, sortByStart or sortBySummary.
+//
+// Returns:
+// - All events sorted.
+func mergeSortEvents(feedEvents [][]*ics.VEvent, concurrency int, by string) []*ics.VEvent {
+	sorted := make([][]keyedEvent, len(feedEvents))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	total := 0
+	for i, events := range feedEvents {
+		total += len(events)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, events []*ics.VEvent) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			keyed := keyEvents(events, by)
+			sortKeyed(keyed)
+			sorted[i] = keyed
+		}(i, events)
+	}
+	wg.Wait()
+
+	h := &mergeHeap{sorted: sorted}
+	for i := range sorted {
+		if len(sorted[i]) > 0 {
+			h.heads = append(h.heads, mergeHead{feed: i})
+		}
+	}
+	heap.Init(h)
+
+	merged := make([]*ics.VEvent, 0, total)
+	for h.Len() > 0 {
+		head := &h.heads[0]
+		merged = append(merged, sorted[head.feed][head.pos].event)
+		head.pos++
+		if head.pos == len(sorted[head.feed]) {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	return merged
+}
+
+// orderEvents sorts the aggregated events, merging per-feed sorts in parallel
+// unless the configured concurrency is 1.
+//
+// Parameters:
+// - feedEvents: The events of each feed, in feed order.
+// - concurrency: The configured sort concurrency; 0 uses GOMAXPROCS.
+// - by: The sort order, sortByStart or sortBySummary.
+//
+// Returns:
+// - All events sorted.
+func orderEvents(feedEvents [][]*ics.VEvent, concurrency int, by string) []*ics.VEvent {
+	if concurrency == 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if concurrency == 1 || len(feedEvents) < 2 {
+		return sortEvents(feedEvents, by)
+	}
+	return mergeSortEvents(feedEvents, concurrency, by)
+}
+
+// End, sort.go
@@ -0,0 +1,161 @@
+// sort_test.go
+// This file contains tests and benchmarks for sorting the aggregate.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// syntheticFeedEvents returns the parsed events of n synthetic feeds.
+func syntheticFeedEvents(tb testing.TB, feeds, eventsPerFeed int) [][]*ics.VEvent {
+	tb.Helper()
+	feedEvents := make([][]*ics.VEvent, feeds)
+	for i := range feedEvents {
+		cal, err := ics.ParseCalendar(strings.NewReader(syntheticCalendar(fmt.Sprintf("Feed%d", i), eventsPerFeed)))
+		if err != nil {
+			tb.Fatalf("Error parsing synthetic calendar: %v", err)
+		}
+		feedEvents[i] = cal.Events()
+	}
+	return feedEvents
+}
+
+// eventUIDs returns the UID of each event, in order.
+func eventUIDs(events []*ics.VEvent) []string {
+	uids := make([]string, len(events))
+	for i, event := range events {
+		uids[i] = event.Id()
+	}
+	return uids
+}
+
+// TestMergeSortEventsMatchesSort tests that the parallel merge orders events
+// exactly like the single-goroutine sort, including ties across feeds.
+func TestMergeSortEventsMatchesSort(t *testing.T) {
+	feedEvents := syntheticFeedEvents(t, 5, 400)
+	want := eventUIDs(sortEvents(feedEvents, sortByStart))
+
+	for _, concurrency := range []int{2, 5, 16} {
+		got := eventUIDs(mergeSortEvents(feedEvents, concurrency, sortByStart))
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected concurrency %d to match the naive sort", concurrency)
+		}
+	}
+
+	sorted := sortEvents(feedEvents, sortByStart)
+	for i := 1; i < len(sorted); i++ {
+		prev, _ := sorted[i-1].GetStartAt()
+		cur, _ := sorted[i].GetStartAt()
+		if cur.Before(prev) {
+			t.Fatalf("Expected events sorted by DTSTART, got %s before %s", sorted[i-1].Id(), sorted[i].Id())
+		}
+	}
+}
+
+// TestSortEventsTolerantDateTimes tests that DTSTARTs with fractional seconds
+// or numeric offsets parse and sort by the instant they denote.
+func TestSortEventsTolerantDateTimes(t *testing.T) {
+	starts := []string{
+		"fraction|20230101T120000.750Z",
+		"offset|20230101T160000+0500",
+		"colon|20230101T060000-05:30",
+		"standard|20230101T100000Z",
+	}
+	var events []*ics.VEvent
+	for _, spec := range starts {
+		uid, start, _ := strings.Cut(spec, "|")
+		events = append(events, parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:"+uid+"\nDTSTART:"+start+"\nEND:VEVENT\nEND:VCALENDAR\n"))
+	}
+
+	var got []string
+	for _, event := range sortEvents([][]*ics.VEvent{events}, sortByStart) {
+		start, err := eventStart(event)
+		if err != nil {
+			t.Fatalf("Expected %s to parse, got %v", event.Id(), err)
+		}
+		got = append(got, event.Id()+"@"+start.UTC().Format("15:04:05"))
+	}
+	if want := "standard@10:00:00,offset@11:00:00,colon@11:30:00,fraction@12:00:00"; strings.Join(got, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+// TestSortEventsBySummary tests that sort=summary orders events alphabetically
+// ignoring case, with equal summaries ordered by DTSTART, whether sorted on one
+// goroutine or merged across feeds.
+func TestSortEventsBySummary(t *testing.T) {
+	event := func(uid, summary, start string) *ics.VEvent {
+		return parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:"+uid+"\nSUMMARY:"+summary+"\nDTSTART;VALUE=DATE:"+start+"\nEND:VEVENT\nEND:VCALENDAR\n")
+	}
+	feedEvents := [][]*ics.VEvent{
+		{event("new-year-2024", "New Year", "20240101"), event("boxing-day", "boxing day", "20231226")},
+		{event("new-year-2023", "new year", "20230101"), event("canada-day", "Canada Day", "20230701")},
+	}
+
+	want := "boxing-day,canada-day,new-year-2023,new-year-2024"
+	if got := strings.Join(eventUIDs(sortEvents(feedEvents, sortBySummary)), ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if got := strings.Join(eventUIDs(mergeSortEvents(feedEvents, 2, sortBySummary)), ","); got != want {
+		t.Errorf("Expected the merge to give %s, got %s", want, got)
+	}
+}
+
+// BenchmarkSortEvents compares sorting the combined events on one goroutine
+// against sorting each feed in parallel and merging them.
+func TestSortEventsDTStampTiebreak(t *testing.T) {
+	event := func(uid, stamp string) *ics.VEvent {
+		return parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:"+uid+"\nDTSTAMP:"+stamp+"\nDTSTART:20230701T120000Z\nEND:VEVENT\nEND:VCALENDAR\n")
+	}
+	feedEvents := [][]*ics.VEvent{
+		{event("older", "20230101T000000Z")},
+		{event("newer", "20230601T000000Z")},
+	}
+
+	want := "newer,older"
+	if got := strings.Join(eventUIDs(sortEvents(feedEvents, sortByStart)), ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if got := strings.Join(eventUIDs(mergeSortEvents(feedEvents, 2, sortByStart)), ","); got != want {
+		t.Errorf("Expected the merge to give %s, got %s", want, got)
+	}
+}
+
+func TestSortEventsUIDTiebreak(t *testing.T) {
+	event := func(uid string) *ics.VEvent {
+		return parseMockEvent(t, "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:"+uid+"\nDTSTAMP:20230101T000000Z\nDTSTART:20230701T120000Z\nEND:VEVENT\nEND:VCALENDAR\n")
+	}
+	feedEvents := [][]*ics.VEvent{
+		{event("canada-day-b")},
+		{event("canada-day-a")},
+	}
+
+	want := "canada-day-a,canada-day-b"
+	if got := strings.Join(eventUIDs(sortEvents(feedEvents, sortByStart)), ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if got := strings.Join(eventUIDs(mergeSortEvents(feedEvents, 2, sortByStart)), ","); got != want {
+		t.Errorf("Expected the merge to give %s, got %s", want, got)
+	}
+}
+
+func BenchmarkSortEvents(b *testing.B) {
+	feedEvents := syntheticFeedEvents(b, 50, 4000)
+
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sortEvents(feedEvents, sortByStart)
+		}
+	})
+	b.Run("merge", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			orderEvents(feedEvents, 0, sortByStart)
+		}
+	})
+}
+
+// End, sort_test.go
@@ -0,0 +1,86 @@
+// sse.go
+// This file contains the Server-Sent Events stream of the aggregate.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// streamedEvent is the JSON of one event pushed by /aggregate/stream.
+type streamedEvent struct {
+	Feed    string `json:"feed"`
+	UID     string `json:"uid,omitempty"`
+	Summary string `json:"summary"`
+	// Start is the raw DTSTART value.
+	Start string `json:"start"`
+	// ICS is the event serialized as an iCalendar component.
+	ICS string `json:"ics"`
+}
+
+// sseEvent renders an event as the data of a Server-Sent Events frame.
+//
+// Parameters:
+// - feed: The feed the event came from.
+// - event: The event to render.
+// - octets: The folding width of the ICS field.
+// - warn: The check of overlong ICS lines, as for foldContent.
+//
+// Returns:
+// - The JSON encoding of the event.
+func sseEvent(feed FeedConfig, event *ics.VEvent, octets int, warn *lineWarner) string {
+	data, _ := json.Marshal(streamedEvent{
+		Feed:    feed.Name,
+		UID:     event.Id(),
+		Summary: propertyValue(event, ics.ComponentPropertySummary),
+		Start:   propertyValue(event, ics.ComponentPropertyDtStart),
+		ICS:     serializeEvent(event, "", octets, warn),
+	})
+	return string(data)
+}
+
+// noWriteTimeout lifts the server's write timeout from the request, for
+// streams that outlast it.
+func noWriteTimeout(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logf(c.Request.Context(), "Keeping the write timeout: %v", err)
+	}
+}
+
+// aggregateStream pushes every selected event as a JSON data frame as soon as
+// its feed has loaded, then an "event: done" frame carrying the total count.
+// It accepts the feed selection parameters of aggregateICS.
+func (s *server) aggregateStream(c *gin.Context) {
+	opts := parseAggregateOptions(c)
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warn := newLineWarner(c.Request.Context(), s.cfg.WarnLineOctets)
+	eventChan, counts := s.streamEvents(c.Request.Context(), opts, func(feed FeedConfig, event *ics.VEvent) string {
+		return sseEvent(feed, event, s.cfg.FoldOctets, warn)
+	})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Stream(func(w io.Writer) bool {
+		if data, ok := <-eventChan; ok {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			return true
+		}
+		total := 0
+		for _, count := range counts {
+			total += count
+		}
+		fmt.Fprintf(w, "event: done\ndata: {\"events\":%d}\n\n", total)
+		return false
+	})
+}
+
+// End, sse.go
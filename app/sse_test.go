@@ -0,0 +1,119 @@
+// sse_test.go
+// This file contains tests for the Server-Sent Events stream.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAggregateStream tests that an SSE client receives a JSON data frame per
+// event followed by a terminating done frame.
+func TestAggregateStream(t *testing.T) {
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/aggregate/stream")
+	if err != nil {
+		t.Fatalf("Error connecting to the stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %q", got)
+	}
+
+	// Frames are separated by blank lines.
+	var frames []string
+	var frame []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			frames = append(frames, strings.Join(frame, "\n"))
+			frame = nil
+			continue
+		}
+		frame = append(frame, scanner.Text())
+	}
+
+	if len(frames) != 5 {
+		t.Fatalf("Expected 4 event frames and a done frame, got %q", frames)
+	}
+	if got := frames[4]; got != "event: done\ndata: {\"events\":4}" {
+		t.Errorf("Expected a final done frame counting 4 events, got %q", got)
+	}
+	var summaries []string
+	for _, frame := range frames[:4] {
+		data, ok := strings.CutPrefix(frame, "data: ")
+		if !ok {
+			t.Fatalf("Expected a data frame, got %q", frame)
+		}
+		var event streamedEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("Error decoding frame %q: %v", data, err)
+		}
+		if !strings.HasPrefix(event.ICS, "BEGIN:VEVENT\r\n") {
+			t.Errorf("Expected the frame to carry the serialized event, got %q", event.ICS)
+		}
+		summaries = append(summaries, event.Feed+": "+event.Summary)
+	}
+	sort.Strings(summaries)
+
+	want := "Canada: Canada Day, Canada: Canadian New Year, Colombia: Colombian Independence Day, Colombia: Colombian New Year"
+	if got := strings.Join(summaries, ", "); got != want {
+		t.Errorf("Expected events %s, got %s", want, got)
+	}
+}
+
+// TestServerTimeouts tests that the configured timeouts are set on the HTTP
+// server, and that the event stream outlives the write timeout while the
+// aggregate does not.
+func TestServerTimeouts(t *testing.T) {
+	path := writeConfig(t, "feeds: []\nserver:\n  read_timeout_seconds: 5\n  write_timeout_seconds: 7\n  idle_timeout_seconds: 11\n")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	hs := newServer(cfg).httpServer(http.NotFoundHandler())
+	if hs.ReadTimeout != 5*time.Second || hs.WriteTimeout != 7*time.Second || hs.IdleTimeout != 11*time.Second {
+		t.Errorf("Expected timeouts 5s, 7s, and 11s, got %v, %v, and %v", hs.ReadTimeout, hs.WriteTimeout, hs.IdleTimeout)
+	}
+
+	cfg = newTestConfig(t)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, mockCanadianCalendar)
+	}))
+	defer slow.Close()
+	cfg.Feeds[1].URL = slow.URL
+	srv := httptest.NewUnstartedServer(newRouter(cfg))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	for path, completes := range map[string]bool{"/aggregate/stream": true, "/aggregate_ics?nocache=true": false} {
+		resp, err := http.Get(srv.URL + path)
+		if err == nil {
+			body, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr != nil || !strings.Contains(string(body), "Canada Day") {
+				err = fmt.Errorf("incomplete response %q (%v)", body, readErr)
+			}
+		}
+		if completes && err != nil {
+			t.Errorf("Expected %s to outlive the write timeout, got %v", path, err)
+		}
+		if !completes && err == nil {
+			t.Errorf("Expected %s to be cut off by the write timeout", path)
+		}
+	}
+}
+
+// End, sse_test.go
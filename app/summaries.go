@@ -0,0 +1,59 @@
+// summaries.go
+// This file contains the endpoint listing the distinct event summaries.
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// summaryCount is a distinct SUMMARY as listed by /summaries.
+type summaryCount struct {
+	Summary string `json:"summary"`
+	// Count is the number of events across the selected feeds with this SUMMARY.
+	Count int `json:"count"`
+}
+
+// countSummaries tallies the distinct SUMMARYs of the aggregated events.
+// Untitled events are left out.
+//
+// Parameters:
+// - feedEvents: The events of each feed.
+//
+// Returns:
+// - The distinct summaries with their counts, sorted by summary.
+func countSummaries(feedEvents [][]*ics.VEvent) []summaryCount {
+	counts := map[string]int{}
+	for _, events := range feedEvents {
+		for _, event := range events {
+			if summary := propertyValue(event, ics.ComponentPropertySummary); summary != "" {
+				counts[summary]++
+			}
+		}
+	}
+	list := make([]summaryCount, 0, len(counts))
+	for summary, count := range counts {
+		list = append(list, summaryCount{Summary: summary, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Summary < list[j].Summary })
+	return list
+}
+
+// summaries lists the distinct SUMMARYs of the events across the selected
+// feeds with the number of events carrying each, for building filter UIs. It
+// reads the same cached, parsed events as the aggregate and accepts its feed
+// selection parameters.
+func (s *server) summaries(c *gin.Context) {
+	opts := parseAggregateOptions(c)
+	if err := opts.validate(s.cfg.MaxFeedsPerRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	feedEvents, _, _ := s.collectEvents(c.Request.Context(), opts)
+	c.JSON(http.StatusOK, gin.H{"summaries": countSummaries(feedEvents)})
+}
+
+// End, summaries.go
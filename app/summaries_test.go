@@ -0,0 +1,45 @@
+// summaries_test.go
+// This file contains tests for the endpoint listing the distinct event summaries.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSummaries tests that /summaries lists each distinct SUMMARY of the mock
+// calendars once, sorted, with the number of events carrying it.
+func TestSummaries(t *testing.T) {
+	cfg := newTestConfig(t)
+	// A second Canadian feed serves the same holidays again.
+	cfg.Feeds = append(cfg.Feeds, FeedConfig{Name: "Canada Mirror", URL: cfg.Feeds[1].URL, Country: "CA"})
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	var got struct {
+		Summaries []summaryCount `json:"summaries"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/summaries")), &got); err != nil {
+		t.Fatalf("Error decoding summaries: %v", err)
+	}
+	want := []summaryCount{
+		{Summary: "Canada Day", Count: 2},
+		{Summary: "Canadian New Year", Count: 2},
+		{Summary: "Colombian Independence Day", Count: 1},
+		{Summary: "Colombian New Year", Count: 1},
+	}
+	if fmt.Sprint(got.Summaries) != fmt.Sprint(want) {
+		t.Errorf("Expected summaries %v, got %v", want, got.Summaries)
+	}
+
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/summaries?feed=Colombia")), &got); err != nil {
+		t.Fatalf("Error decoding summaries: %v", err)
+	}
+	if len(got.Summaries) != 2 || got.Summaries[0].Summary != "Colombian Independence Day" {
+		t.Errorf("Expected only Colombia's summaries, got %v", got.Summaries)
+	}
+}
+
+// End, summaries_test.go
@@ -0,0 +1,79 @@
+// title.go
+// This file contains the title_template rewriting of event summaries.
+package main
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// titleFields are the fields a title_template can use.
+type titleFields struct {
+	// Source is the name of the feed the event came from.
+	Source string
+	// Country is the feed's country code.
+	Country string
+	// Summary is the event's SUMMARY.
+	Summary string
+	// Year is the year of DTSTART, e.g. "2023".
+	Year string
+	// Date is the date of DTSTART as YYYY-MM-DD.
+	Date string
+}
+
+// parseTitleTemplate parses a title_template, trying it on an empty event so
+// that references to unknown fields fail as well as syntax errors.
+//
+// Parameters:
+// - text: The template, e.g. "{{.Source}}: {{.Summary}} ({{.Year}})".
+//
+// Returns:
+// - The parsed template, or nil if text is empty.
+// - An error if the template is invalid.
+func parseTitleTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("title_template").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, titleFields{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// applyTitleTemplate rewrites an event's SUMMARY with the title template. An
+// event the template fails on is a warning and keeps its SUMMARY.
+//
+// Parameters:
+// - ctx: The context of the request being served, used for warnings.
+// - tmpl: The parsed title_template.
+// - feed: The feed the event came from.
+// - event: The event to edit.
+func applyTitleTemplate(ctx context.Context, tmpl *template.Template, feed FeedConfig, event *ics.VEvent) {
+	fields := titleFields{
+		Source:  feed.Name,
+		Country: feed.Country,
+		Summary: propertyValue(event, ics.ComponentPropertySummary),
+	}
+	if start, err := eventStart(event); err == nil {
+		fields.Year = strconv.Itoa(start.Year())
+		fields.Date = start.Format(time.DateOnly)
+	}
+	var title strings.Builder
+	if err := tmpl.Execute(&title, fields); err != nil {
+		warnf(ctx, "Event %q can't be titled from the template: %v", fields.Summary, err)
+		return
+	}
+	event.SetSummary(title.String())
+}
+
+// End, title.go
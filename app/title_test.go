@@ -0,0 +1,37 @@
+// title_test.go
+// This file contains tests for the title template.
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestApplyTitleTemplate tests that a templated summary is rendered from the
+// event's source, summary, and date.
+func TestApplyTitleTemplate(t *testing.T) {
+	tmpl, err := parseTitleTemplate("{{.Source}}: {{.Summary}} ({{.Year}}, {{.Date}})")
+	if err != nil {
+		t.Fatalf("Error parsing the template: %v", err)
+	}
+	event := parseMockEvent(t, mockCanadianCalendar)
+	applyTitleTemplate(context.Background(), tmpl, FeedConfig{Name: "Canada"}, event)
+	if got, want := propertyValue(event, ics.ComponentPropertySummary), "Canada: Canadian New Year (2023, 2023-01-01)"; got != want {
+		t.Errorf("Expected SUMMARY %q, got %q", want, got)
+	}
+}
+
+// TestLoadConfigTitleTemplate tests that invalid templates fail at load.
+func TestLoadConfigTitleTemplate(t *testing.T) {
+	for _, text := range []string{"{{.Summary", "{{.Holiday}}"} {
+		_, err := loadConfig(writeConfig(t, "title_template: \""+text+"\"\n"))
+		if err == nil || !strings.Contains(err.Error(), "title_template") {
+			t.Errorf("%q: expected a title_template error, got %v", text, err)
+		}
+	}
+}
+
+// End, title_test.go
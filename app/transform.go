@@ -0,0 +1,302 @@
+// transform.go
+// This file contains the configurable pipeline of per-event transforms.
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// Transformer edits an event on its way into the aggregate.
+type Transformer interface {
+	// Transform returns the edited event, and false if it should be dropped.
+	Transform(event *ics.VEvent) (*ics.VEvent, bool)
+}
+
+// feedTransformer is a Transformer that needs the feed the event came from.
+type feedTransformer interface {
+	Transformer
+	// TransformFeed is Transform for an event of the given feed.
+	TransformFeed(feed FeedConfig, event *ics.VEvent) (*ics.VEvent, bool)
+}
+
+// pipeline runs its transformers in order, stopping at the first that drops the event.
+type pipeline []Transformer
+
+// Transform applies every transformer of the pipeline to the event.
+func (p pipeline) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	for _, t := range p {
+		var keep bool
+		if event, keep = t.Transform(event); !keep {
+			return nil, false
+		}
+	}
+	return event, true
+}
+
+// TransformFeed applies every transformer of the pipeline to an event of the
+// given feed, passing the feed on to the transformers that need it.
+func (p pipeline) TransformFeed(feed FeedConfig, event *ics.VEvent) (*ics.VEvent, bool) {
+	for _, t := range p {
+		var keep bool
+		if ft, ok := t.(feedTransformer); ok {
+			event, keep = ft.TransformFeed(feed, event)
+		} else {
+			event, keep = t.Transform(event)
+		}
+		if !keep {
+			return nil, false
+		}
+	}
+	return event, true
+}
+
+// prefixSummary prepends a fixed string to the event's SUMMARY.
+type prefixSummary struct {
+	prefix string
+}
+
+// Transform prefixes the SUMMARY.
+func (t prefixSummary) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	event.SetSummary(t.prefix + propertyValue(event, ics.ComponentPropertySummary))
+	return event, true
+}
+
+// addCategories appends categories the event does not list yet.
+type addCategories struct {
+	categories []string
+}
+
+// Transform adds the missing categories as one more CATEGORIES property.
+func (t addCategories) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	existing := map[string]bool{}
+	for _, category := range eventCategories(event) {
+		existing[strings.ToLower(category)] = true
+	}
+	var missing []string
+	for _, category := range t.categories {
+		if !existing[strings.ToLower(category)] {
+			missing = append(missing, category)
+		}
+	}
+	if len(missing) > 0 {
+		event.AddProperty(ics.ComponentPropertyCategories, strings.Join(missing, ","))
+	}
+	return event, true
+}
+
+// stripAlarms removes every VALARM, so subscribers aren't reminded of holidays.
+type stripAlarms struct{}
+
+// Transform drops the event's alarms.
+func (stripAlarms) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	kept := event.Components[:0]
+	for _, component := range event.Components {
+		if _, ok := component.(*ics.VAlarm); !ok {
+			kept = append(kept, component)
+		}
+	}
+	event.Components = kept
+	return event, true
+}
+
+// setTransp sets the event's TRANSP to a fixed value.
+type setTransp struct {
+	transparency ics.TimeTransparency
+}
+
+// Transform sets TRANSP.
+func (t setTransp) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	event.SetTimeTransparency(t.transparency)
+	return event, true
+}
+
+// markFreeTransform marks the event as free time, as mark_free does for every feed.
+type markFreeTransform struct{}
+
+// Transform marks the event free.
+func (markFreeTransform) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	markFree(event)
+	return event, true
+}
+
+// propertyAltDesc is the property Outlook and other rich clients read an
+// alternate, formatted DESCRIPTION from.
+const propertyAltDesc ics.ComponentProperty = "X-ALT-DESC"
+
+// altDescription attaches an HTML rendering of the plain DESCRIPTION, linking
+// to the event's URL when it has one.
+type altDescription struct{}
+
+// Transform sets X-ALT-DESC;FMTTYPE=text/html on events with a DESCRIPTION.
+func (altDescription) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	description := propertyValue(event, ics.ComponentPropertyDescription)
+	if strings.TrimSpace(description) == "" {
+		return event, true
+	}
+
+	var b strings.Builder
+	b.WriteString("<html><body><p>")
+	b.WriteString(strings.ReplaceAll(html.EscapeString(description), "\n", "<br>"))
+	b.WriteString("</p>")
+	if link := propertyValue(event, ics.ComponentPropertyUrl); link != "" {
+		fmt.Fprintf(&b, `<p><a href="%s">%s</a></p>`, html.EscapeString(link), html.EscapeString(link))
+	}
+	b.WriteString("</body></html>")
+	event.SetProperty(propertyAltDesc, b.String(), ics.WithFmtType("text/html"))
+	return event, true
+}
+
+// utcLayout is the form of a UTC DATE-TIME value.
+const utcLayout = "20060102T150405Z"
+
+// floatingLayout is the form of a floating or TZID-qualified DATE-TIME value.
+const floatingLayout = "20060102T150405"
+
+// setTimezone rewrites UTC start and end times as local times in a fixed
+// zone, for clients that display UTC times as-is. The calendar writers declare
+// the zone; see timezoneComponents.
+type setTimezone struct {
+	location *time.Location
+}
+
+// Transform converts UTC DTSTART and DTEND values to the zone, with a TZID.
+// Dates, floating times, and times already carrying a TZID are left alone.
+func (t setTimezone) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	for _, property := range []ics.ComponentProperty{ics.ComponentPropertyDtStart, ics.ComponentPropertyDtEnd} {
+		prop := event.GetProperty(property)
+		if prop == nil {
+			continue
+		}
+		utc, err := time.Parse(utcLayout, prop.Value)
+		if err != nil {
+			continue
+		}
+		prop.Value = utc.In(t.location).Format(floatingLayout)
+		prop.ICalParameters[string(ics.ParameterTzid)] = []string{t.location.String()}
+	}
+	return event, true
+}
+
+// propertySourceURL is the property naming the feed an event came from.
+const propertySourceURL ics.ComponentProperty = "X-SOURCE-URL"
+
+// sourceURL annotates events with the URL of their feed, for traceability.
+type sourceURL struct{}
+
+// Transform leaves an event of an unknown feed alone.
+func (t sourceURL) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	return event, true
+}
+
+// TransformFeed sets X-SOURCE-URL to the feed's URL, without the user
+// credentials, query, or fragment it carries, since private feeds keep their
+// secret tokens there.
+func (t sourceURL) TransformFeed(feed FeedConfig, event *ics.VEvent) (*ics.VEvent, bool) {
+	source := feed.URL
+	if u, err := url.Parse(feed.URL); err == nil {
+		u.User, u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = nil, "", false, "", ""
+		source = u.String()
+	}
+	event.SetProperty(propertySourceURL, source)
+	return event, true
+}
+
+// uppercaseTokens writes the listed words in capitals wherever they appear as
+// whole words of a SUMMARY, whatever their case, e.g. "uk" as "UK".
+type uppercaseTokens struct {
+	pattern *regexp.Regexp
+}
+
+// newUppercaseTokens builds the casing fix for the uppercase_tokens setting.
+//
+// Parameters:
+// - tokens: The words to capitalize, e.g. "usa" and "uk".
+//
+// Returns:
+// - The transformer.
+func newUppercaseTokens(tokens []string) uppercaseTokens {
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		quoted[i] = regexp.QuoteMeta(token)
+	}
+	return uppercaseTokens{pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// Transform capitalizes the tokens in the SUMMARY.
+func (t uppercaseTokens) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	if summary := propertyValue(event, ics.ComponentPropertySummary); summary != "" {
+		event.SetSummary(t.pattern.ReplaceAllStringFunc(summary, strings.ToUpper))
+	}
+	return event, true
+}
+
+// newTransformer builds the transformer described by a transforms entry.
+//
+// Parameters:
+// - tc: The transform's configuration.
+//
+// Returns:
+// - The transformer.
+// - An error if the type is unknown or its value is invalid.
+func newTransformer(tc TransformConfig) (Transformer, error) {
+	switch tc.Type {
+	case "prefix_summary":
+		return prefixSummary{prefix: tc.Value}, nil
+	case "add_categories":
+		categories := parseList(tc.Value)
+		if len(categories) == 0 {
+			return nil, fmt.Errorf("add_categories needs a comma-separated value")
+		}
+		return addCategories{categories: categories}, nil
+	case "strip_alarms":
+		return stripAlarms{}, nil
+	case "set_transp":
+		switch transparency := ics.TimeTransparency(strings.ToUpper(tc.Value)); transparency {
+		case ics.TransparencyOpaque, ics.TransparencyTransparent:
+			return setTransp{transparency: transparency}, nil
+		}
+		return nil, fmt.Errorf("set_transp value must be OPAQUE or TRANSPARENT, got %q", tc.Value)
+	case "mark_free":
+		return markFreeTransform{}, nil
+	case "alt_desc":
+		return altDescription{}, nil
+	case "source_url":
+		return sourceURL{}, nil
+	case "set_tz":
+		location, err := time.LoadLocation(tc.Value)
+		if err != nil || tc.Value == "" {
+			return nil, fmt.Errorf("set_tz value must be an IANA time zone, got %q", tc.Value)
+		}
+		return setTimezone{location: location}, nil
+	}
+	return nil, fmt.Errorf("unknown transform type %q", tc.Type)
+}
+
+// newPipeline builds the pipeline described by the transforms setting.
+//
+// Parameters:
+// - configs: The transforms, in the order they run.
+//
+// Returns:
+// - The pipeline.
+// - An error describing the first invalid transform.
+func newPipeline(configs []TransformConfig) (pipeline, error) {
+	var p pipeline
+	for i, tc := range configs {
+		t, err := newTransformer(tc)
+		if err != nil {
+			return nil, fmt.Errorf("transforms[%d]: %w", i, err)
+		}
+		p = append(p, t)
+	}
+	return p, nil
+}
+
+// End, transform.go
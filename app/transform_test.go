@@ -0,0 +1,195 @@
+// transform_test.go
+// This file contains tests for the transform pipeline.
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// dropSummary drops events whose SUMMARY starts with a prefix.
+type dropSummary struct {
+	prefix string
+}
+
+// Transform drops matching events.
+func (t dropSummary) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	return event, !strings.HasPrefix(propertyValue(event, ics.ComponentPropertySummary), t.prefix)
+}
+
+// TestPipelineComposesTransforms tests that configured transforms combine in order.
+func TestPipelineComposesTransforms(t *testing.T) {
+	p, err := newPipeline([]TransformConfig{
+		{Type: "prefix_summary", Value: "[Holiday] "},
+		{Type: "add_categories", Value: "Holiday, CA"},
+		{Type: "prefix_summary", Value: "CA: "},
+	})
+	if err != nil {
+		t.Fatalf("Error building pipeline: %v", err)
+	}
+
+	event, keep := p.Transform(parseMockEvent(t, mockCanadianCalendar))
+	if !keep {
+		t.Fatalf("Expected the event to be kept")
+	}
+	if got, want := propertyValue(event, ics.ComponentPropertySummary), "CA: [Holiday] Canadian New Year"; got != want {
+		t.Errorf("Expected SUMMARY %q, got %q", want, got)
+	}
+	if got := strings.Join(eventCategories(event), ","); got != "Holiday,CA" {
+		t.Errorf("Expected categories Holiday,CA, got %s", got)
+	}
+}
+
+// TestPipelineStopsAtDrop tests that transforms after a dropping one don't run.
+func TestPipelineStopsAtDrop(t *testing.T) {
+	ran := false
+	p := pipeline{
+		prefixSummary{prefix: "Skip "},
+		dropSummary{prefix: "Skip"},
+		transformFunc(func(event *ics.VEvent) (*ics.VEvent, bool) {
+			ran = true
+			return event, true
+		}),
+	}
+	if _, keep := p.Transform(parseMockEvent(t, mockCanadianCalendar)); keep {
+		t.Errorf("Expected the event to be dropped")
+	}
+	if ran {
+		t.Errorf("Expected the pipeline to stop at the dropping transform")
+	}
+
+	// In the other order the prefix is added after the check, so the event survives.
+	p = pipeline{dropSummary{prefix: "Skip"}, prefixSummary{prefix: "Skip "}}
+	if _, keep := p.Transform(parseMockEvent(t, mockCanadianCalendar)); !keep {
+		t.Errorf("Expected the event to be kept when the check runs first")
+	}
+}
+
+// transformFunc adapts a function to the Transformer interface.
+type transformFunc func(*ics.VEvent) (*ics.VEvent, bool)
+
+// Transform calls the function.
+func (f transformFunc) Transform(event *ics.VEvent) (*ics.VEvent, bool) {
+	return f(event)
+}
+
+// TestNewPipelineRejectsUnknown tests that an unknown transform type is an error.
+func TestNewPipelineRejectsUnknown(t *testing.T) {
+	if _, err := newPipeline([]TransformConfig{{Type: "shout"}}); err == nil {
+		t.Errorf("Expected an error for an unknown transform type")
+	}
+}
+
+// TestAltDescription tests that alt_desc adds an HTML X-ALT-DESC, linking the
+// event's URL, next to the plain DESCRIPTION.
+func TestAltDescription(t *testing.T) {
+	event := parseMockEvent(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Canada Day
+DTSTART;VALUE=DATE:20230701
+DESCRIPTION:Fireworks & parades\nNationwide
+URL:https://example.com/canada-day
+END:VEVENT
+END:VCALENDAR`)
+	transform, err := newTransformer(TransformConfig{Type: "alt_desc"})
+	if err != nil {
+		t.Fatalf("Error building transform: %v", err)
+	}
+	event, _ = transform.Transform(event)
+
+	prop := event.GetProperty(propertyAltDesc)
+	if prop == nil {
+		t.Fatalf("Expected an X-ALT-DESC property, got:\n%s", event.Serialize())
+	}
+	if got := prop.ICalParameters["FMTTYPE"]; len(got) != 1 || got[0] != "text/html" {
+		t.Errorf("Expected FMTTYPE text/html, got %v", got)
+	}
+	want := `<html><body><p>Fireworks &amp; parades<br>Nationwide</p><p><a href="https://example.com/canada-day">https://example.com/canada-day</a></p></body></html>`
+	if prop.Value != want {
+		t.Errorf("Expected X-ALT-DESC %s, got %s", want, prop.Value)
+	}
+	if got := propertyValue(event, ics.ComponentPropertyDescription); got != "Fireworks & parades\nNationwide" {
+		t.Errorf("Expected the plain DESCRIPTION to be kept, got %q", got)
+	}
+}
+
+// TestSourceURL tests that every aggregated event names the URL of the feed
+// it came from in X-SOURCE-URL, without its credentials, query, or fragment.
+func TestSourceURL(t *testing.T) {
+	cfg := newTestConfig(t)
+	canada := cfg.Feeds[1].URL
+	cfg.Feeds[1].URL = strings.Replace(canada, "://", "://user:secret@", 1) + "?token=secret#private"
+	cfg.Transforms = []TransformConfig{{Type: "source_url"}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	cal, err := ics.ParseCalendar(strings.NewReader(getBody(t, srv.URL+"/aggregate_ics")))
+	if err != nil {
+		t.Fatalf("Error parsing aggregate: %v", err)
+	}
+	want := map[string]string{
+		"Colombian New Year": cfg.Feeds[0].URL, "Colombian Independence Day": cfg.Feeds[0].URL,
+		"Canadian New Year": canada, "Canada Day": canada,
+	}
+	for _, event := range cal.Events() {
+		summary := propertyValue(event, ics.ComponentPropertySummary)
+		if got := propertyValue(event, propertySourceURL); got != want[summary] {
+			t.Errorf("%s: expected X-SOURCE-URL %q, got %q", summary, want[summary], got)
+		}
+	}
+	if len(cal.Events()) != len(want) {
+		t.Errorf("Expected %d events, got %d", len(want), len(cal.Events()))
+	}
+}
+
+// TestSetTimezoneDeclaresZone tests that the aggregate declares the zone of
+// set_tz once, before the events, whether streamed or buffered.
+func TestSetTimezoneDeclaresZone(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Transforms = []TransformConfig{{Type: "set_tz", Value: "America/Bogota"}}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	for _, path := range []string{"/aggregate_ics", "/aggregate_ics?sort=start"} {
+		body := getBody(t, srv.URL+path)
+		zone := strings.Index(body, "BEGIN:VTIMEZONE\r\nTZID:America/Bogota\r\n")
+		if zone < 0 || zone > strings.Index(body, "BEGIN:VEVENT") || strings.Count(body, "BEGIN:VTIMEZONE") != 1 {
+			t.Errorf("%s: Expected one America/Bogota VTIMEZONE before the events, got:\n%s", path, body)
+		}
+	}
+}
+
+// TestUppercaseTokens tests that the listed words are capitalized as whole
+// words of summaries, after the configured transforms have rewritten them.
+func TestUppercaseTokens(t *testing.T) {
+	upper := newUppercaseTokens([]string{"usa", "uk"})
+	tests := map[string]string{
+		"uk bank holiday":         "UK bank holiday",
+		"Usa day (usa, Uk)":       "USA day (USA, UK)",
+		"Ukraine and Busan":       "Ukraine and Busan",
+		"Independence Day of USA": "Independence Day of USA",
+	}
+	for summary, want := range tests {
+		event := ics.NewEvent("tokens@test")
+		event.SetSummary(summary)
+		upper.Transform(event)
+		if got := propertyValue(event, ics.ComponentPropertySummary); got != want {
+			t.Errorf("Expected %q to become %q, got %q", summary, want, got)
+		}
+	}
+
+	cfg := newTestConfig(t)
+	cfg.Transforms = []TransformConfig{{Type: "prefix_summary", Value: "uk mirror: "}}
+	cfg.UppercaseTokens = []string{"uk"}
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+	if body := getBody(t, srv.URL+"/aggregate_ics?feed=Canada"); !strings.Contains(body, "SUMMARY:UK mirror: Canada Day\r\n") {
+		t.Errorf("Expected the prefixed summary to be capitalized, got:\n%s", body)
+	}
+}
+
+// End, transform_test.go
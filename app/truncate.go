@@ -0,0 +1,61 @@
+// truncate.go
+// This file contains the cap on the serialized size of aggregated calendars.
+package main
+
+import (
+	"bytes"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// capOutput drops the furthest-future events until the serialized calendar
+// fits in max_output_bytes. The events kept stay in their feed and source order.
+//
+// Parameters:
+// - feedEvents: The events of each feed, in feed order.
+// - opts: The per-request aggregation settings.
+//
+// Returns:
+// - The events of each feed that fit.
+// - True if any event was dropped.
+func (s *server) capOutput(feedEvents [][]*ics.VEvent, opts aggregateOptions) ([][]*ics.VEvent, bool) {
+	counts := make([]int, len(feedEvents))
+	for i := range feedEvents {
+		counts[i] = len(feedEvents[i])
+	}
+	// The index event only shrinks as events are dropped, so measuring it with
+	// every event counted leaves room for the final one.
+	var frame bytes.Buffer
+	s.writeCalendarStart(&frame, opts)
+	s.writeIndexEvent(&frame, counts, opts.as, nil)
+	frame.WriteString(calendarFooter)
+	budget := s.cfg.MaxOutputBytes - frame.Len()
+
+	keep := map[*ics.VEvent]bool{}
+	truncated := false
+	for _, event := range sortEvents(feedEvents, sortByStart) {
+		// Only measured here, so overlong lines are left to the actual write.
+		size := len(serializeEvent(event, opts.as, s.cfg.FoldOctets, nil))
+		if truncated || size > budget {
+			truncated = true
+			continue
+		}
+		budget -= size
+		keep[event] = true
+	}
+	if !truncated {
+		return feedEvents, false
+	}
+
+	capped := make([][]*ics.VEvent, len(feedEvents))
+	for i, events := range feedEvents {
+		for _, event := range events {
+			if keep[event] {
+				capped[i] = append(capped[i], event)
+			}
+		}
+	}
+	return capped, true
+}
+
+// End, truncate.go
@@ -0,0 +1,272 @@
+// validate.go
+// This file contains the validation passes applied to aggregated events.
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+
+	"github.com/appliedmedia/calendar-feed-aggregator/fetcher"
+)
+
+// supportedVersion is the only iCalendar VERSION the aggregator accepts.
+const supportedVersion = "2.0"
+
+const (
+	// invertedDatesSwap exchanges DTSTART and DTEND.
+	invertedDatesSwap = "swap"
+	// invertedDatesDropEnd removes DTEND, leaving a single-point event.
+	invertedDatesDropEnd = "drop_end"
+	// invertedDatesExclude removes the event from the output.
+	invertedDatesExclude = "exclude"
+	// invertedDatesKeep leaves the event untouched.
+	invertedDatesKeep = "keep"
+)
+
+const (
+	// missingSummaryKeep leaves summary-less events untitled.
+	missingSummaryKeep = "keep"
+	// missingSummaryDrop removes summary-less events from the output.
+	missingSummaryDrop = "drop"
+	// missingSummaryDefault gives summary-less events the configured default SUMMARY.
+	missingSummaryDefault = "default"
+)
+
+const (
+	// parsingLenient skips the parts of a feed that can't be used, with a warning.
+	parsingLenient = "lenient"
+	// parsingStrict fails a feed on the first validation error, such as a
+	// cut-off event or a missing required property.
+	parsingStrict = "strict"
+)
+
+// requiredProperties lists the properties RFC 5545 requires of every VEVENT
+// in a calendar without a METHOD.
+var requiredProperties = []ics.ComponentProperty{
+	ics.ComponentPropertyUniqueId, ics.ComponentPropertyDtstamp, ics.ComponentPropertyDtStart,
+}
+
+// checkRequiredProperties rejects an event lacking a property RFC 5545
+// requires, for strict mode.
+//
+// Parameters:
+// - event: The event to check.
+//
+// Returns:
+// - An error naming the event and the first missing property.
+func checkRequiredProperties(event *ics.VEvent) error {
+	for _, property := range requiredProperties {
+		if strings.TrimSpace(propertyValue(event, property)) == "" {
+			return fmt.Errorf("event %q lacks the required %s", propertyValue(event, ics.ComponentPropertySummary), property)
+		}
+	}
+	return nil
+}
+
+// singletonProperties lists the VEVENT properties RFC 5545 allows at most once.
+var singletonProperties = map[string]bool{
+	"UID": true, "DTSTAMP": true, "DTSTART": true, "DTEND": true, "DURATION": true,
+	"CLASS": true, "CREATED": true, "DESCRIPTION": true, "GEO": true,
+	"LAST-MODIFIED": true, "LOCATION": true, "ORGANIZER": true, "PRIORITY": true,
+	"SEQUENCE": true, "STATUS": true, "SUMMARY": true, "TRANSP": true, "URL": true,
+	"RECURRENCE-ID": true,
+}
+
+// dropRepeatedProperties keeps only the first occurrence of each property RFC
+// 5545 allows at most once, so that later passes and the sort see a
+// deterministic value. Every dropped duplicate is a warning.
+//
+// Parameters:
+// - ctx: The context of the request being served, used for warnings.
+// - event: The event to edit.
+func dropRepeatedProperties(ctx context.Context, event *ics.VEvent) {
+	seen := map[string]bool{}
+	kept := event.Properties[:0]
+	for _, prop := range event.Properties {
+		name := strings.ToUpper(prop.IANAToken)
+		if singletonProperties[name] && seen[name] {
+			warnf(ctx, "Event %q repeats %s; keeping the first value and dropping %q", propertyValue(event, ics.ComponentPropertySummary), name, prop.Value)
+			continue
+		}
+		seen[name] = true
+		kept = append(kept, prop)
+	}
+	event.Properties = kept
+}
+
+// fixInvertedDates applies the configured policy to an event whose DTEND
+// precedes its DTSTART. Events with valid or unparsable dates are left alone.
+//
+// Parameters:
+// - ctx: The context of the request being served, used for warnings.
+// - event: The event to check.
+// - policy: One of "swap", "drop_end", "exclude", or "keep".
+//
+// Returns:
+// - False if the event should be excluded from the output.
+func fixInvertedDates(ctx context.Context, event *ics.VEvent, policy string) bool {
+	start, err := event.GetStartAt()
+	if err != nil {
+		return true
+	}
+	end, err := event.GetEndAt()
+	if err != nil || !end.Before(start) {
+		return true
+	}
+
+	warnf(ctx, "Event %q ends before it starts; applying %q policy", propertyValue(event, ics.ComponentPropertySummary), policy)
+	switch policy {
+	case invertedDatesSwap:
+		startProp := event.GetProperty(ics.ComponentPropertyDtStart)
+		endProp := event.GetProperty(ics.ComponentPropertyDtEnd)
+		startProp.Value, endProp.Value = endProp.Value, startProp.Value
+		startProp.ICalParameters, endProp.ICalParameters = endProp.ICalParameters, startProp.ICalParameters
+	case invertedDatesDropEnd:
+		removeProperty(event, ics.ComponentPropertyDtEnd)
+	case invertedDatesExclude:
+		return false
+	}
+	return true
+}
+
+// fixMissingSummary applies the configured policy to an event with no, or an
+// empty, SUMMARY.
+//
+// Parameters:
+// - event: The event to check.
+// - policy: One of "keep", "drop", or "default".
+// - defaultSummary: The SUMMARY assigned under the "default" policy.
+//
+// Returns:
+// - False if the event should be excluded from the output.
+func fixMissingSummary(event *ics.VEvent, policy, defaultSummary string) bool {
+	if strings.TrimSpace(propertyValue(event, ics.ComponentPropertySummary)) != "" {
+		return true
+	}
+
+	switch policy {
+	case missingSummaryDrop:
+		return false
+	case missingSummaryDefault:
+		event.SetSummary(defaultSummary)
+	}
+	return true
+}
+
+// calendarVersion returns the VERSION declared by the calendar's own
+// properties, read from the raw data so that legacy formats the parser may
+// mishandle are still recognized.
+//
+// Parameters:
+// - calendarData: A string containing the calendar data.
+//
+// Returns:
+// - The declared version, or "" if the calendar declares none.
+func calendarVersion(calendarData string) string {
+	return calendarProperty(calendarData, "VERSION")
+}
+
+// calendarProperty returns the value of one of the calendar's own properties,
+// read from the unfolded raw data before any component begins.
+//
+// Parameters:
+// - calendarData: A string containing the calendar data.
+// - name: The property name, e.g. "CALSCALE".
+//
+// Returns:
+// - The property's value, or "" if the calendar doesn't set it.
+func calendarProperty(calendarData, name string) string {
+	for _, line := range unfoldLines(calendarData) {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "BEGIN:") && line != "BEGIN:VCALENDAR" {
+			// Component properties follow; the calendar header is over.
+			break
+		}
+		if value, ok := strings.CutPrefix(line, name+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// checkVersion rejects calendars declaring a VERSION other than 2.0, such as
+// vCalendar 1.0 feeds. Calendars without a VERSION are accepted.
+//
+// Parameters:
+// - feed: The feed the calendar data came from.
+// - calendarData: A string containing the calendar data.
+//
+// Returns:
+// - An error naming the feed and its unsupported version.
+func checkVersion(feed FeedConfig, calendarData string) error {
+	version := calendarVersion(calendarData)
+	if version == "" || version == supportedVersion {
+		return nil
+	}
+	return fmt.Errorf("skipping %s: unsupported VERSION:%s (only %s is supported)", feed.Name, version, supportedVersion)
+}
+
+// legacyDateLayouts lists the date forms of vCalendar 1.0 feeds that RFC 5545
+// writes differently, in the order they are tried: date-only values, which
+// 2.0 marks with VALUE=DATE, and ISO 8601 extended dates and times.
+var legacyDateLayouts = []string{"20060102", "2006-01-02", "2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05"}
+
+// upgradeVersion rewrites a calendar declaring a VERSION other than 2.0 into
+// the forms RFC 5545 expects, so that its events can be combined under the
+// aggregate's VERSION:2.0: dates become basic-format RFC 5545 values, and the
+// vCalendar DCREATED becomes CREATED. Calendars declaring 2.0 or no VERSION
+// are returned unchanged.
+//
+// Parameters:
+// - calendarData: A string containing the calendar data.
+//
+// Returns:
+// - The upgraded calendar data.
+func upgradeVersion(calendarData string) string {
+	if version := calendarVersion(calendarData); version == "" || version == supportedVersion {
+		return calendarData
+	}
+	for _, layout := range legacyDateLayouts {
+		calendarData = fetcher.NormalizeDates(calendarData, layout)
+	}
+	lines := strings.Split(calendarData, "\n")
+	for i, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "DCREATED"); ok && (strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, ";")) {
+			lines[i] = string(ics.ComponentPropertyCreated) + rest
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+const (
+	// calScaleReject skips feeds declaring a CALSCALE other than GREGORIAN.
+	calScaleReject = "reject"
+	// calScaleIgnore combines feeds whatever their CALSCALE.
+	calScaleIgnore = "ignore"
+)
+
+// gregorianCalScale is the CALSCALE of the combined calendar, and the default
+// of calendars that declare none.
+const gregorianCalScale = "GREGORIAN"
+
+// checkCalScale rejects calendars declaring a non-Gregorian CALSCALE, whose
+// dates can't be mixed with those of the Gregorian combined calendar.
+//
+// Parameters:
+// - feed: The feed the calendar data came from.
+// - calendarData: A string containing the calendar data.
+//
+// Returns:
+// - An error naming the feed and its calendar scale.
+func checkCalScale(feed FeedConfig, calendarData string) error {
+	scale := calendarProperty(calendarData, "CALSCALE")
+	if scale == "" || strings.EqualFold(scale, gregorianCalScale) {
+		return nil
+	}
+	return fmt.Errorf("skipping %s: unsupported CALSCALE:%s (only %s can be combined)", feed.Name, scale, gregorianCalScale)
+}
+
+// End, validate.go
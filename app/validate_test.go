@@ -0,0 +1,225 @@
+// validate_test.go
+// This file contains tests for the event validation passes.
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// mockInvertedCalendar holds an event whose DTEND precedes its DTSTART.
+const mockInvertedCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Backwards Holiday
+DTSTART;VALUE=DATE:20230105
+DTEND;VALUE=DATE:20230104
+END:VEVENT
+END:VCALENDAR`
+
+// parseMockEvent parses calendarData and returns its first event.
+func parseMockEvent(t *testing.T, calendarData string) *ics.VEvent {
+	t.Helper()
+	cal, err := ics.ParseCalendar(strings.NewReader(calendarData))
+	if err != nil {
+		t.Fatalf("Error parsing mock calendar: %v", err)
+	}
+	events := cal.Events()
+	if len(events) == 0 {
+		t.Fatalf("Expected mock calendar to contain an event")
+	}
+	return events[0]
+}
+
+// TestFixInvertedDates tests that each policy is applied to an inverted-date event.
+func TestFixInvertedDates(t *testing.T) {
+	tests := []struct {
+		policy    string
+		wantKeep  bool
+		wantStart string
+		wantEnd   string
+	}{
+		{policy: invertedDatesSwap, wantKeep: true, wantStart: "20230104", wantEnd: "20230105"},
+		{policy: invertedDatesDropEnd, wantKeep: true, wantStart: "20230105", wantEnd: ""},
+		{policy: invertedDatesExclude, wantKeep: false, wantStart: "20230105", wantEnd: "20230104"},
+		{policy: invertedDatesKeep, wantKeep: true, wantStart: "20230105", wantEnd: "20230104"},
+	}
+
+	for _, tt := range tests {
+		event := parseMockEvent(t, mockInvertedCalendar)
+		if keep := fixInvertedDates(context.Background(), event, tt.policy); keep != tt.wantKeep {
+			t.Errorf("%s: expected keep=%v, got %v", tt.policy, tt.wantKeep, keep)
+		}
+		if got := propertyValue(event, ics.ComponentPropertyDtStart); got != tt.wantStart {
+			t.Errorf("%s: expected DTSTART %s, got %s", tt.policy, tt.wantStart, got)
+		}
+		if got := propertyValue(event, ics.ComponentPropertyDtEnd); got != tt.wantEnd {
+			t.Errorf("%s: expected DTEND %q, got %q", tt.policy, tt.wantEnd, got)
+		}
+	}
+}
+
+// TestFixInvertedDatesValidEvent tests that correctly ordered events are untouched.
+func TestFixInvertedDatesValidEvent(t *testing.T) {
+	event := parseMockEvent(t, strings.Replace(mockInvertedCalendar, "DTEND;VALUE=DATE:20230104", "DTEND;VALUE=DATE:20230106", 1))
+	if !fixInvertedDates(context.Background(), event, invertedDatesExclude) {
+		t.Errorf("Expected a valid event to be kept")
+	}
+	if got := propertyValue(event, ics.ComponentPropertyDtEnd); got != "20230106" {
+		t.Errorf("Expected DTEND to be unchanged, got %s", got)
+	}
+}
+
+// TestFixMissingSummary tests that each policy is applied to a summary-less event.
+func TestFixMissingSummary(t *testing.T) {
+	const untitled = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20230101
+END:VEVENT
+END:VCALENDAR`
+	tests := []struct {
+		policy      string
+		wantKeep    bool
+		wantSummary string
+	}{
+		{policy: missingSummaryKeep, wantKeep: true, wantSummary: ""},
+		{policy: missingSummaryDrop, wantKeep: false, wantSummary: ""},
+		{policy: missingSummaryDefault, wantKeep: true, wantSummary: "(Untitled)"},
+	}
+
+	for _, tt := range tests {
+		event := parseMockEvent(t, untitled)
+		if keep := fixMissingSummary(event, tt.policy, "(Untitled)"); keep != tt.wantKeep {
+			t.Errorf("%s: expected keep=%v, got %v", tt.policy, tt.wantKeep, keep)
+		}
+		if got := propertyValue(event, ics.ComponentPropertySummary); got != tt.wantSummary {
+			t.Errorf("%s: expected SUMMARY %q, got %q", tt.policy, tt.wantSummary, got)
+		}
+	}
+
+	titled := parseMockEvent(t, mockCanadianCalendar)
+	if !fixMissingSummary(titled, missingSummaryDrop, "") {
+		t.Errorf("Expected an event with a SUMMARY to be kept")
+	}
+}
+
+// TestCheckVersion tests that a vCalendar 1.0 feed is skipped with a clear message.
+func TestCheckVersion(t *testing.T) {
+	legacy := strings.Replace(mockCanadianCalendar, "VERSION:2.0", "VERSION:1.0", 1)
+	cfg := defaultConfig()
+	cfg.Feeds = []FeedConfig{
+		{Name: "Legacy", URL: newFeedServer(t, legacy).URL},
+		{Name: "Colombia", URL: newFeedServer(t, mockColombianCalendar).URL},
+	}
+	s := newServer(cfg)
+
+	_, err := s.feedEvents(context.Background(), cfg.Feeds[0], false)
+	if err == nil {
+		t.Fatalf("Expected the VERSION:1.0 feed to be rejected")
+	}
+	if want := "skipping Legacy: unsupported VERSION:1.0 (only 2.0 is supported)"; err.Error() != want {
+		t.Errorf("Expected error %q, got %q", want, err.Error())
+	}
+
+	events, err := s.feedEvents(context.Background(), cfg.Feeds[1], false)
+	if err != nil || len(events) != 2 {
+		t.Errorf("Expected the 2.0 feed to load 2 events, got %d (err %v)", len(events), err)
+	}
+
+	if err := checkVersion(cfg.Feeds[0], "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VEVENT\nEND:VCALENDAR"); err != nil {
+		t.Errorf("Expected a calendar without VERSION to be accepted, got %v", err)
+	}
+}
+
+// TestUpgradeVersion tests that the aggregate declares VERSION:2.0 exactly
+// once whatever its feeds declare, and that a vCalendar 1.0 feed combined with
+// enforce_version off has its dates upgraded.
+func TestUpgradeVersion(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.EnforceVersion = false
+	versionless := strings.Replace(mockColombianCalendar, "VERSION:2.0\n", "", 1)
+	legacy := "BEGIN:VCALENDAR\nVERSION:1.0\nBEGIN:VEVENT\nSUMMARY:Canada Day\nDCREATED:20230101T000000Z\nDTSTART:2023-07-01T09:00:00Z\nDTEND:20230702\nEND:VEVENT\nEND:VCALENDAR\n"
+	cfg.Feeds[0].URL = newFeedServer(t, versionless).URL
+	cfg.Feeds[1].URL = newFeedServer(t, legacy).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	if got := strings.Count(body, "VERSION:"); got != 1 || !strings.Contains(body, "\r\nVERSION:2.0\r\n") {
+		t.Errorf("Expected the aggregate to declare VERSION:2.0 once, got:\n%s", body)
+	}
+	for _, want := range []string{"SUMMARY:Colombian New Year", "DTSTART:20230701T090000Z", "DTEND;VALUE=DATE:20230702", "CREATED:20230101T000000Z"} {
+		if !strings.Contains(body, want+"\r\n") {
+			t.Errorf("Expected the aggregate to contain %s, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "DCREATED") {
+		t.Errorf("Expected DCREATED to become CREATED, got:\n%s", body)
+	}
+
+	if got := upgradeVersion(mockCanadianCalendar); got != mockCanadianCalendar {
+		t.Errorf("Expected a 2.0 calendar to be left alone, got:\n%s", got)
+	}
+}
+
+// TestCheckCalScale tests that a non-Gregorian feed is skipped under the
+// reject policy and combined under ignore.
+func TestCheckCalScale(t *testing.T) {
+	hebrew := strings.Replace(mockCanadianCalendar, "VERSION:2.0", "VERSION:2.0\nCALSCALE:HEBREW", 1)
+	cfg := defaultConfig()
+	cfg.Feeds = []FeedConfig{{Name: "Hebrew", URL: newFeedServer(t, hebrew).URL}}
+
+	_, err := newServer(cfg).feedEvents(context.Background(), cfg.Feeds[0], false)
+	if want := "skipping Hebrew: unsupported CALSCALE:HEBREW (only GREGORIAN can be combined)"; err == nil || err.Error() != want {
+		t.Errorf("Expected error %q, got %v", want, err)
+	}
+
+	cfg.CalScale = calScaleIgnore
+	events, err := newServer(cfg).feedEvents(context.Background(), cfg.Feeds[0], false)
+	if err != nil || len(events) != 2 {
+		t.Errorf("Expected the feed to load 2 events when ignoring CALSCALE, got %d (err %v)", len(events), err)
+	}
+
+	gregorian := strings.Replace(mockCanadianCalendar, "VERSION:2.0", "VERSION:2.0\nCALSCALE:gregorian", 1)
+	if err := checkCalScale(cfg.Feeds[0], gregorian); err != nil {
+		t.Errorf("Expected a Gregorian calendar to be accepted, got %v", err)
+	}
+}
+
+// TestDropRepeatedProperties tests that a double-DTSTART event keeps its first DTSTART.
+func TestDropRepeatedProperties(t *testing.T) {
+	event := parseMockEvent(t, `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Twice Started
+DTSTART;VALUE=DATE:20230301
+DTSTART;VALUE=DATE:20230101
+CATEGORIES:Holiday
+CATEGORIES:Observance
+END:VEVENT
+END:VCALENDAR`)
+	dropRepeatedProperties(context.Background(), event)
+
+	starts := 0
+	for _, prop := range event.Properties {
+		if prop.IANAToken == string(ics.ComponentPropertyDtStart) {
+			starts++
+		}
+	}
+	if starts != 1 {
+		t.Errorf("Expected a single DTSTART, got %d", starts)
+	}
+	if got := propertyValue(event, ics.ComponentPropertyDtStart); got != "20230301" {
+		t.Errorf("Expected the first DTSTART 20230301 to be kept, got %s", got)
+	}
+	if got := len(eventCategories(event)); got != 2 {
+		t.Errorf("Expected repeatable CATEGORIES to be kept, got %d", got)
+	}
+}
+
+// End, validate_test.go
@@ -0,0 +1,26 @@
+// version.go
+// This file contains the build version identifying the aggregator in its output.
+package main
+
+import "strings"
+
+// version is the build version of the aggregator, injected at build time with
+// go build -ldflags "-X main.version=1.4.0".
+var version = "dev"
+
+// prodID returns the PRODID of combined calendars: prodid_base with the build
+// version appended to its product name, e.g.
+// "-//appliedmedia//Calendar Feed Aggregator 1.4.0//EN".
+//
+// Returns:
+// - The PRODID value.
+func (cfg *Config) prodID() string {
+	base := cfg.ProdIDBase
+	// The language code follows the last "//" of a formal public identifier.
+	if i := strings.LastIndex(base, "//"); i > 0 {
+		return base[:i] + " " + version + base[i:]
+	}
+	return strings.TrimSpace(base + " " + version)
+}
+
+// End, version.go
@@ -0,0 +1,31 @@
+// version_test.go
+// This file contains tests for the versioned PRODID.
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestProdID tests that the combined calendar's PRODID names the aggregator
+// and its build version.
+func TestProdID(t *testing.T) {
+	defer func(built string) { version = built }(version)
+	version = "1.4.0"
+
+	srv := httptest.NewServer(newRouter(newTestConfig(t)))
+	defer srv.Close()
+	body := getBody(t, srv.URL+"/aggregate_ics")
+	if want := "PRODID:-//appliedmedia//Calendar Feed Aggregator 1.4.0//EN\r\n"; !strings.Contains(body, want) {
+		t.Errorf("Expected %q, got:\n%s", want, body)
+	}
+
+	cfg := defaultConfig()
+	cfg.ProdIDBase = "Holiday Feeds"
+	if got := cfg.prodID(); got != "Holiday Feeds 1.4.0" {
+		t.Errorf("Expected a base without // to end with the version, got %q", got)
+	}
+}
+
+// End, version_test.go
@@ -0,0 +1,176 @@
+// vtimezone.go
+// This file contains the VTIMEZONE components declaring the zones set_tz
+// writes times in, as RFC 5545 requires of every TZID used.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// rruleWeekdays are the RRULE BYDAY names of the days of the week.
+var rruleWeekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// zoneTransition is a change of UTC offset of a time zone.
+type zoneTransition struct {
+	// at is the first instant of the new offset.
+	at   time.Time
+	from int
+	to   int
+	name string
+	dst  bool
+}
+
+// timezoneComponents returns a VTIMEZONE for each distinct zone the set_tz
+// transforms convert to.
+//
+// Parameters:
+// - configs: The transforms, in the order they run.
+// - now: The time whose year's rules describe the zones.
+//
+// Returns:
+// - The VTIMEZONE components, or "" if no set_tz transform is configured.
+func timezoneComponents(configs []TransformConfig, now time.Time) string {
+	var b strings.Builder
+	seen := map[string]bool{}
+	for _, tc := range configs {
+		if tc.Type != "set_tz" || seen[tc.Value] {
+			continue
+		}
+		seen[tc.Value] = true
+		location, err := time.LoadLocation(tc.Value)
+		if err != nil || tc.Value == "" {
+			// newTransformer has already rejected it.
+			continue
+		}
+		b.WriteString(vtimezone(location, now.Year()))
+	}
+	return b.String()
+}
+
+// vtimezone describes a zone by the offset changes of one year, each repeated
+// yearly from 1970 on the same weekday of the month, e.g. the second Sunday of
+// March. Zones without changes that year get a single STANDARD observance.
+//
+// Parameters:
+// - location: The zone, named by its IANA name.
+// - year: The year whose rules are described.
+//
+// Returns:
+// - The VTIMEZONE component.
+func vtimezone(location *time.Location, year int) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VTIMEZONE\r\nTZID:" + location.String() + "\r\n")
+	transitions := zoneTransitions(location, year)
+	if len(transitions) == 0 {
+		name, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, location).Zone()
+		fmt.Fprintf(&b, "BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:%s\r\nTZOFFSETTO:%s\r\nTZNAME:%s\r\nEND:STANDARD\r\n",
+			formatUTCOffset(offset), formatUTCOffset(offset), name)
+	}
+	for _, tr := range transitions {
+		kind := "STANDARD"
+		if tr.dst {
+			kind = "DAYLIGHT"
+		}
+		// The onset is given in the local time in effect before it.
+		local := tr.at.In(time.FixedZone("", tr.from))
+		n := (local.Day()-1)/7 + 1
+		if local.Day()+7 > daysIn(local.Month(), local.Year()) {
+			n = -1
+		}
+		start := nthWeekday(1970, local.Month(), local.Weekday(), n)
+		start = start.Add(time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second)
+		fmt.Fprintf(&b, "BEGIN:%s\r\nDTSTART:%s\r\nRRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s\r\nTZOFFSETFROM:%s\r\nTZOFFSETTO:%s\r\nTZNAME:%s\r\nEND:%s\r\n",
+			kind, start.Format(floatingLayout), int(local.Month()), n, rruleWeekdays[local.Weekday()],
+			formatUTCOffset(tr.from), formatUTCOffset(tr.to), tr.name, kind)
+	}
+	b.WriteString("END:VTIMEZONE\r\n")
+	return b.String()
+}
+
+// zoneTransitions finds the offset changes of a zone during a year, to the
+// second.
+//
+// Parameters:
+// - location: The zone.
+// - year: The year searched.
+//
+// Returns:
+// - The transitions, in order.
+func zoneTransitions(location *time.Location, year int) []zoneTransition {
+	var transitions []zoneTransition
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for day := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC); day.Before(end); day = day.Add(24 * time.Hour) {
+		lo, hi := day, day.Add(24*time.Hour)
+		_, from := lo.In(location).Zone()
+		if _, to := hi.In(location).Zone(); to == from {
+			continue
+		}
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, offset := mid.In(location).Zone(); offset == from {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		name, to := hi.In(location).Zone()
+		transitions = append(transitions, zoneTransition{at: hi, from: from, to: to, name: name, dst: hi.In(location).IsDST()})
+	}
+	return transitions
+}
+
+// nthWeekday returns the midnight starting the nth given weekday of a month,
+// counting from the end when n is -1.
+//
+// Parameters:
+// - year: The year.
+// - month: The month.
+// - weekday: The day of the week.
+// - n: The occurrence, 1 to 5, or -1 for the last.
+//
+// Returns:
+// - The day, as a floating time in UTC.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := time.Date(year, month, daysIn(month, year), 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -((int(last.Weekday()) - int(weekday) + 7) % 7))
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(n-1))
+}
+
+// daysIn returns the number of days of a month.
+//
+// Parameters:
+// - month: The month.
+// - year: The year, for February.
+//
+// Returns:
+// - The number of days.
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// formatUTCOffset writes an offset east of UTC the way TZOFFSETFROM and
+// TZOFFSETTO take it, e.g. -0500 or +0530.
+//
+// Parameters:
+// - seconds: The offset, in seconds.
+//
+// Returns:
+// - The RFC 5545 UTC-OFFSET value.
+func formatUTCOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	value := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		value += fmt.Sprintf("%02d", seconds%60)
+	}
+	return value
+}
+
+// End, vtimezone.go
@@ -0,0 +1,69 @@
+// vtimezone_test.go
+// This file contains tests for the VTIMEZONE components of set_tz.
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestVTimezone tests that a zone with daylight saving time gets an observance
+// per offset change, repeating on the right weekday, and that a zone without
+// gets a single STANDARD observance.
+func TestVTimezone(t *testing.T) {
+	for _, tc := range []struct {
+		zone string
+		want []string
+	}{
+		{"America/New_York", []string{
+			"TZID:America/New_York\r\n",
+			"BEGIN:DAYLIGHT\r\nDTSTART:19700308T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT\r\n",
+			"BEGIN:STANDARD\r\nDTSTART:19701101T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\nEND:STANDARD\r\n",
+		}},
+		{"Europe/Berlin", []string{
+			"BEGIN:DAYLIGHT\r\nDTSTART:19700329T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\n",
+			"BEGIN:STANDARD\r\nDTSTART:19701025T030000\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\n",
+		}},
+		{"America/Bogota", []string{
+			"BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0500\r\n",
+		}},
+	} {
+		location, err := time.LoadLocation(tc.zone)
+		if err != nil {
+			t.Fatalf("Error loading %s: %v", tc.zone, err)
+		}
+		got := vtimezone(location, 2023)
+		if !strings.HasPrefix(got, "BEGIN:VTIMEZONE\r\n") || !strings.HasSuffix(got, "END:VTIMEZONE\r\n") {
+			t.Errorf("%s: Expected a VTIMEZONE component, got:\n%s", tc.zone, got)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: Expected %q, got:\n%s", tc.zone, want, got)
+			}
+		}
+		if _, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + got + "END:VCALENDAR\r\n")); err != nil {
+			t.Errorf("%s: Error parsing the VTIMEZONE: %v", tc.zone, err)
+		}
+	}
+}
+
+// TestTimezoneComponentsDeduplicates tests that each set_tz zone is declared
+// once, and that other transforms declare none.
+func TestTimezoneComponentsDeduplicates(t *testing.T) {
+	got := timezoneComponents([]TransformConfig{
+		{Type: "set_tz", Value: "America/Bogota"},
+		{Type: "prefix_summary", Value: "America/Toronto"},
+		{Type: "set_tz", Value: "America/Bogota"},
+	}, time.Now())
+	if n := strings.Count(got, "BEGIN:VTIMEZONE"); n != 1 || !strings.Contains(got, "TZID:America/Bogota\r\n") {
+		t.Errorf("Expected a single America/Bogota VTIMEZONE, got:\n%s", got)
+	}
+	if got := timezoneComponents(nil, time.Now()); got != "" {
+		t.Errorf("Expected no VTIMEZONE without set_tz, got:\n%s", got)
+	}
+}
+
+// End, vtimezone_test.go
@@ -0,0 +1,140 @@
+// warnings.go
+// This file contains the collection of non-fatal parse warnings.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+)
+
+// warningsKey is the context key under which the parse warnings collector is stored.
+type warningsKey struct{}
+
+// parseWarnings collects the non-fatal problems found while loading a feed.
+type parseWarnings struct {
+	mu       sync.Mutex
+	messages []string
+	// invalid holds the messages that are validation errors, such as a cut-off
+	// event, rather than advisory notes; only they fail strict mode.
+	invalid []string
+	// parent, when set, is the collector the messages are passed on to, so that
+	// a feed's own collector doesn't hide them from the request's.
+	parent *parseWarnings
+}
+
+// withWarnings returns a copy of ctx recording warnings into w.
+//
+// Parameters:
+// - ctx: The parent context.
+// - w: The collector receiving the warnings.
+//
+// Returns:
+// - The derived context.
+func withWarnings(ctx context.Context, w *parseWarnings) context.Context {
+	return context.WithValue(ctx, warningsKey{}, w)
+}
+
+// warnf logs a non-fatal problem like logf and records it in the collector
+// carried by ctx, if any.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - format: The fmt format string of the warning.
+// - args: The format arguments.
+func warnf(ctx context.Context, format string, args ...any) {
+	logf(ctx, format, args...)
+	w, _ := ctx.Value(warningsKey{}).(*parseWarnings)
+	for ; w != nil; w = w.parent {
+		w.mu.Lock()
+		w.messages = append(w.messages, fmt.Sprintf(format, args...))
+		w.mu.Unlock()
+	}
+}
+
+// invalidf reports a validation error that lenient parsing skipped past: it is
+// logged and recorded like a warning, and also as a failure for strict mode.
+//
+// Parameters:
+// - ctx: The context of the request being served.
+// - format: The fmt format string of the error.
+// - args: The format arguments.
+func invalidf(ctx context.Context, format string, args ...any) {
+	warnf(ctx, format, args...)
+	w, _ := ctx.Value(warningsKey{}).(*parseWarnings)
+	for ; w != nil; w = w.parent {
+		w.mu.Lock()
+		w.invalid = append(w.invalid, fmt.Sprintf(format, args...))
+		w.mu.Unlock()
+	}
+}
+
+// list returns the recorded warnings.
+func (w *parseWarnings) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.messages...)
+}
+
+// errors returns the recorded warnings that are validation errors.
+func (w *parseWarnings) errors() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.invalid...)
+}
+
+// knownProperties lists the VEVENT properties of RFC 5545 and RFC 7986, plus
+// the extensions the aggregator itself reads or writes.
+var knownProperties = map[string]bool{
+	"ATTACH": true, "ATTENDEE": true, "CATEGORIES": true, "CLASS": true,
+	"COMMENT": true, "CONTACT": true, "CREATED": true, "DESCRIPTION": true,
+	"DTEND": true, "DTSTAMP": true, "DTSTART": true, "DURATION": true,
+	"EXDATE": true, "GEO": true, "LAST-MODIFIED": true, "LOCATION": true,
+	"ORGANIZER": true, "PRIORITY": true, "RDATE": true, "RECURRENCE-ID": true,
+	"RELATED-TO": true, "REQUEST-STATUS": true, "RESOURCES": true, "RRULE": true,
+	"SEQUENCE": true, "STATUS": true, "SUMMARY": true, "TRANSP": true,
+	"UID": true, "URL": true, "COLOR": true, "CONFERENCE": true, "IMAGE": true,
+	string(propertyBusyStatus): true,
+}
+
+// checkUnknownProperties warns about every property of an event that is
+// neither standard nor a known extension. The properties are kept.
+//
+// Parameters:
+// - ctx: The context of the request being served, used for warnings.
+// - event: The event to check.
+func checkUnknownProperties(ctx context.Context, event *ics.VEvent) {
+	for _, prop := range event.Properties {
+		if name := strings.ToUpper(prop.IANAToken); !knownProperties[name] {
+			warnf(ctx, "Event %q has unknown property %s", propertyValue(event, ics.ComponentPropertySummary), name)
+		}
+	}
+}
+
+// feedWarnings is the /warnings report for one feed.
+type feedWarnings struct {
+	Feed     string   `json:"feed"`
+	Warnings []string `json:"warnings"`
+}
+
+// warnings loads every feed selected by the request and reports the parse
+// warnings each produced.
+func (s *server) warnings(c *gin.Context) {
+	opts := parseAggregateOptions(c)
+	_, warnings, _ := s.collectEvents(c.Request.Context(), opts)
+
+	report := []feedWarnings{}
+	for i, feed := range s.cfg.Feeds {
+		if opts.includesFeed(feed) {
+			report = append(report, feedWarnings{Feed: feed.Name, Warnings: warnings[i].list()})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"feeds": report})
+}
+
+// End, warnings.go
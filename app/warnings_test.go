@@ -0,0 +1,58 @@
+// warnings_test.go
+// This file contains tests for parse warnings.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mockUnknownPropertyCalendar holds an event with a property no standard defines.
+const mockUnknownPropertyCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Provider Day
+DTSTART;VALUE=DATE:20230301
+X-PROVIDER-RANK:7
+END:VEVENT
+END:VCALENDAR`
+
+// TestWarningsUnknownProperty tests that an unknown X-property is reported per
+// feed and counted in X-Parse-Warnings, without failing the aggregate.
+func TestWarningsUnknownProperty(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Feeds[1].URL = newFeedServer(t, mockUnknownPropertyCalendar).URL
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+
+	var report struct {
+		Feeds []feedWarnings `json:"feeds"`
+	}
+	if err := json.Unmarshal([]byte(getBody(t, srv.URL+"/warnings")), &report); err != nil {
+		t.Fatalf("Error decoding warnings: %v", err)
+	}
+	if len(report.Feeds) != 2 {
+		t.Fatalf("Expected a report for 2 feeds, got %d", len(report.Feeds))
+	}
+	if got := report.Feeds[0].Warnings; len(got) != 0 {
+		t.Errorf("Expected no warnings for Colombia, got %q", got)
+	}
+	canada := report.Feeds[1]
+	if len(canada.Warnings) != 1 || !strings.Contains(canada.Warnings[0], "X-PROVIDER-RANK") {
+		t.Errorf("Expected one warning naming X-PROVIDER-RANK for %s, got %q", canada.Feed, canada.Warnings)
+	}
+
+	resp, err := http.Get(srv.URL + "/aggregate_ics?warnings=header")
+	if err != nil {
+		t.Fatalf("Error requesting aggregate: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("X-Parse-Warnings"); got != "1" {
+		t.Errorf("Expected X-Parse-Warnings 1, got %q", got)
+	}
+}
+
+// End, warnings_test.go
@@ -0,0 +1,125 @@
+// webhook.go
+// This file contains the webhooks notified when a refresh changes a feed.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// feedChange is the JSON payload POSTed to webhooks.
+type feedChange struct {
+	Feed    string `json:"feed"`
+	Events  int    `json:"events"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Changed int    `json:"changed"`
+}
+
+// changeTracker remembers the content hash of the events each feed had at its
+// last refresh, by instance, to tell which refreshes changed them.
+type changeTracker struct {
+	mu    sync.Mutex
+	feeds map[string]map[string]string
+}
+
+// newChangeTracker creates an empty tracker.
+//
+// Returns:
+// - A ready-to-use changeTracker.
+func newChangeTracker() *changeTracker {
+	return &changeTracker{feeds: map[string]map[string]string{}}
+}
+
+// observe records a feed's refreshed events and compares them with the
+// previous refresh. Events are matched by UID and overridden instance, and
+// changed when any property but DTSTAMP and SEQUENCE differs; events without a
+// UID are matched by their content, so an edit to one counts as a removal and
+// an addition. A feed's first refresh is never a change.
+//
+// Parameters:
+// - feed: The name of the feed.
+// - events: The feed's events.
+//
+// Returns:
+// - The change since the previous refresh.
+// - True if events were added, removed, or changed.
+func (ct *changeTracker) observe(feed string, events []*ics.VEvent) (feedChange, bool) {
+	hashes := make(map[string]string, len(events))
+	for _, event := range events {
+		hash := eventContentHash(event)
+		key := instanceKey(event)
+		if key == "" {
+			key = "content\n" + hash
+		}
+		hashes[key] = hash
+	}
+
+	ct.mu.Lock()
+	previous, seen := ct.feeds[feed]
+	ct.feeds[feed] = hashes
+	ct.mu.Unlock()
+
+	change := feedChange{Feed: feed, Events: len(events)}
+	if !seen {
+		return change, false
+	}
+	for key, hash := range hashes {
+		switch before, ok := previous[key]; {
+		case !ok:
+			change.Added++
+		case before != hash:
+			change.Changed++
+		}
+	}
+	for key := range previous {
+		if _, ok := hashes[key]; !ok {
+			change.Removed++
+		}
+	}
+	return change, change.Added > 0 || change.Removed > 0 || change.Changed > 0
+}
+
+// notifyWebhooks POSTs a change to every configured webhook in the
+// background. Failures are logged and not retried.
+//
+// Parameters:
+// - ctx: The context of the refresh, used for logging.
+// - change: The change to report.
+func (s *server) notifyWebhooks(ctx context.Context, change feedChange) {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		logf(ctx, "Error encoding the change of %s: %v", change.Feed, err)
+		return
+	}
+	// Deliveries outlive the refresh that triggered them.
+	ctx = context.WithoutCancel(ctx)
+	client := &http.Client{Timeout: time.Duration(s.cfg.HTTPTimeoutSeconds * float64(time.Second))}
+	for _, webhook := range s.cfg.Webhooks {
+		go func(url string) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+			if err != nil {
+				logf(ctx, "Error notifying webhook %s: %v", url, err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				logf(ctx, "Error notifying webhook %s: %v", url, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				logf(ctx, "Webhook %s answered %s", url, resp.Status)
+			}
+		}(webhook.URL)
+	}
+}
+
+// End, webhook.go
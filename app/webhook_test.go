@@ -0,0 +1,94 @@
+// webhook_test.go
+// This file contains tests for the change webhooks.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// TestWebhookOnChange tests that a refresh changing a feed POSTs the change
+// to the webhook, while the first refresh and unchanged refreshes don't.
+func TestWebhookOnChange(t *testing.T) {
+	var body atomic.Value
+	body.Store(mockCanadianCalendar)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body.Load().(string))
+	}))
+	defer upstream.Close()
+
+	changes := make(chan feedChange, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var change feedChange
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			t.Errorf("Error decoding webhook payload: %v", err)
+		}
+		changes <- change
+	}))
+	defer receiver.Close()
+
+	cfg := newTestConfig(t)
+	cfg.Cache.TTLSeconds = 0
+	cfg.Feeds = []FeedConfig{{Name: "Canada", URL: upstream.URL}}
+	cfg.Webhooks = []WebhookConfig{{URL: receiver.URL}}
+	s := newServer(cfg)
+
+	refresh := func() {
+		if err := s.refresh(context.Background()); err != nil {
+			t.Fatalf("Error refreshing: %v", err)
+		}
+	}
+	refresh()
+	refresh()
+	body.Store(strings.Replace(mockCanadianCalendar, "SUMMARY:Canada Day", "SUMMARY:Canada Day (observed)", 1))
+	refresh()
+
+	select {
+	case change := <-changes:
+		want := feedChange{Feed: "Canada", Events: 2, Added: 1, Removed: 1}
+		if change != want {
+			t.Errorf("Expected %+v, got %+v", want, change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a webhook call after the change")
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Expected a single webhook call, got another: %+v", change)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestChangeTrackerChangedEvents tests that an edit to any property of an
+// event with a UID is reported as a change, while a new DTSTAMP is not.
+func TestChangeTrackerChangedEvents(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\nUID:canada-day@example.com\nDTSTAMP:20230101T000000Z\nSUMMARY:Canada Day\nDTSTART;VALUE=DATE:20230701\nLOCATION:Ottawa\nEND:VEVENT\nEND:VCALENDAR\n"
+	events := func(body string) []*ics.VEvent {
+		cal, err := ics.ParseCalendar(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error parsing the feed: %v", err)
+		}
+		return cal.Events()
+	}
+
+	ct := newChangeTracker()
+	ct.observe("Canada", events(feed))
+	if change, changed := ct.observe("Canada", events(strings.Replace(feed, "DTSTAMP:20230101", "DTSTAMP:20230201", 1))); changed {
+		t.Errorf("Expected a new DTSTAMP not to be a change, got %+v", change)
+	}
+	change, changed := ct.observe("Canada", events(strings.Replace(feed, "LOCATION:Ottawa", "LOCATION:Toronto", 1)))
+	if want := (feedChange{Feed: "Canada", Events: 1, Changed: 1}); !changed || change != want {
+		t.Errorf("Expected %+v for an edited LOCATION, got %+v", want, change)
+	}
+}
+
+// End, webhook_test.go
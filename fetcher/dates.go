@@ -0,0 +1,123 @@
+// dates.go
+
+package fetcher
+
+import (
+	"strings"
+	"time"
+)
+
+// dateProperties lists the properties whose values NormalizeDates rewrites.
+var dateProperties = []string{"DTSTART", "DTEND"}
+
+// splitContentLine splits a content line into its name-and-parameters part and
+// its value, at the first colon outside a quoted parameter value.
+//
+// Parameters:
+// - line: The content line to split.
+//
+// Returns:
+// - The name and parameters, e.g. "DTSTART;TZID=America/Bogota".
+// - The value.
+// - False if the line has no value separator.
+func splitContentLine(line string) (string, string, bool) {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			return line[:i], line[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// layoutHasClock reports whether a Go time layout includes an hour field.
+func layoutHasClock(layout string) bool {
+	return strings.Contains(layout, "15") || strings.Contains(layout, "3")
+}
+
+// layoutHasZone reports whether a Go time layout includes a zone field.
+func layoutHasZone(layout string) bool {
+	return strings.Contains(layout, "-07") || strings.Contains(layout, "Z07") || strings.Contains(layout, "MST")
+}
+
+// NormalizeDates rewrites DTSTART and DTEND values written in a provider's
+// non-standard layout into RFC 5545 form. Values that don't match the layout,
+// including ones already in RFC 5545 form, are left untouched.
+//
+// Parameters:
+// - calendarData: A string containing the calendar data.
+// - layout: The Go time layout the provider uses, e.g. "2006/01/02".
+//
+// Returns:
+// - The calendar data with matching date values normalized.
+func NormalizeDates(calendarData, layout string) string {
+	lines := strings.Split(calendarData, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r")
+		head, value, ok := splitContentLine(trimmed)
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(head, ";")
+		if !isDateProperty(name) {
+			continue
+		}
+		t, err := time.Parse(layout, strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+
+		var normalized string
+		switch {
+		case !layoutHasClock(layout):
+			params = setParam(params, "VALUE", "DATE")
+			normalized = t.Format("20060102")
+		case layoutHasZone(layout):
+			normalized = t.UTC().Format("20060102T150405Z")
+		default:
+			normalized = t.Format("20060102T150405")
+		}
+		if params != "" {
+			name += ";" + params
+		}
+		// Keep the original line ending.
+		lines[i] = name + ":" + normalized + line[len(trimmed):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isDateProperty reports whether name is one of the properties NormalizeDates rewrites.
+func isDateProperty(name string) bool {
+	for _, property := range dateProperties {
+		if strings.EqualFold(name, property) {
+			return true
+		}
+	}
+	return false
+}
+
+// setParam sets a parameter in a semicolon-separated parameter list, replacing
+// any existing value.
+//
+// Parameters:
+// - params: The parameter list without the leading semicolon.
+// - key: The parameter name.
+// - value: The parameter value.
+//
+// Returns:
+// - The updated parameter list.
+func setParam(params, key, value string) string {
+	kept := []string{}
+	for _, param := range strings.Split(params, ";") {
+		name, _, _ := strings.Cut(param, "=")
+		if param != "" && !strings.EqualFold(name, key) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(append(kept, key+"="+value), ";")
+}
+
+// End, dates.go
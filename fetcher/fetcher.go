@@ -1,56 +1,250 @@
 // fetcher.go
 
+// Package fetcher retrieves remote iCalendar feeds and splits them into events.
 package fetcher
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"sync"
-
-	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strings"
 )
 
-const (
-	// ColombianHolidaysURL is the URL to fetch Colombian holidays in iCalendar format.
-	ColombianHolidaysURL = "https://www.officeholidays.com/ics/ics_country.php?tbl_country=Colombia"
-	// CanadianHolidaysURL is the URL to fetch Canadian holidays in iCalendar format.
-	CanadianHolidaysURL = "https://www.officeholidays.com/ics/ics_country.php?tbl_country=Canada"
-)
+// Request describes how to retrieve a feed from its provider.
+type Request struct {
+	// URL is the location of the feed.
+	URL string
+	// Method is the HTTP method to use; empty means GET.
+	Method string
+	// Body is sent verbatim as the request body when Form is empty.
+	Body string
+	// Form is sent URL-encoded as the request body when non-empty.
+	Form map[string]string
+	// CheckURL, when set, vets the URL and every redirect target before they
+	// are requested; an error aborts the fetch.
+	CheckURL func(*url.URL) error
+	// MaxBytes, when positive, abandons feeds larger than this many bytes with
+	// ErrTooLarge instead of reading them whole.
+	MaxBytes int64
+}
+
+// ErrTooLarge is returned by Fetch for feeds over the request's MaxBytes.
+var ErrTooLarge = errors.New("feed exceeds the size limit")
+
+// maxRedirects is the number of redirects followed, as by http.DefaultClient.
+const maxRedirects = 10
+
+// client returns the HTTP client to send req with, enforcing CheckURL on
+// redirects when it is set.
+func (req Request) client() *http.Client {
+	if req.CheckURL == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		CheckRedirect: func(next *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return req.CheckURL(next.URL)
+		},
+	}
+}
 
-// aggregateICS handles the aggregation of ICS files and streams the combined events.
-func aggregateICS(c *gin.Context) {
-	icsURLs := []string{ColombianHolidaysURL, CanadianHolidaysURL}
-	eventChan := make(chan string)
-	var wg sync.WaitGroup
-
-	// Fetch calendars concurrently
-	for _, url := range icsURLs {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			fetchICS(url, eventChan)
-		}(url)
-	}
-
-	// Close the channel once all goroutines are done
-	go func() {
-		wg.Wait()
-		close(eventChan)
-	}()
-
-	// Stream events to the client
-	c.Stream(func(w io.Writer) bool {
-		if event, ok := <-eventChan; ok {
-			c.Writer.Write([]byte(event))
-			return true
+// method returns the HTTP method to use, defaulting to GET.
+func (req Request) method() string {
+	if req.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(req.Method)
+}
+
+// encodedForm returns the form payload URL-encoded with its keys sorted.
+func (req Request) encodedForm() string {
+	form := url.Values{}
+	for key, value := range req.Form {
+		form.Set(key, value)
+	}
+	return form.Encode()
+}
+
+// newHTTPRequest builds the HTTP request described by req.
+//
+// Parameters:
+// - ctx: The context governing the request's lifetime.
+// - req: The feed request to translate.
+//
+// Returns:
+// - The HTTP request ready to send.
+// - An error if the method or URL are invalid.
+func newHTTPRequest(ctx context.Context, req Request) (*http.Request, error) {
+	var body io.Reader
+	contentType := ""
+	switch {
+	case len(req.Form) > 0:
+		body = strings.NewReader(req.encodedForm())
+		contentType = "application/x-www-form-urlencoded"
+	case req.Body != "":
+		body = strings.NewReader(req.Body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method(), req.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	return httpReq, nil
+}
+
+// Key identifies the request for caching, so that feeds sharing a URL but
+// sending different payloads are kept apart.
+//
+// Returns:
+// - A string unique to the request's method, URL, and payload.
+func (req Request) Key() string {
+	key := req.method() + " " + req.URL
+	if len(req.Form) > 0 {
+		return key + "\n" + req.encodedForm()
+	}
+	if req.Body != "" {
+		return key + "\n" + req.Body
+	}
+	return key
+}
+
+// Fetch retrieves the iCalendar feed described by req. A file URL reads a
+// local file with GET, decompressing gzipped files.
+//
+// Parameters:
+// - ctx: The context governing the request's lifetime.
+// - req: The request describing where and how to fetch the calendar data.
+//
+// Returns:
+// - A string containing the calendar data.
+// - An error if there was an issue fetching or reading the data.
+func Fetch(ctx context.Context, req Request) (string, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return "", err
+	}
+	if req.CheckURL != nil {
+		if err := req.CheckURL(u); err != nil {
+			return "", err
 		}
-		return false
-	})
+	}
+	if u.Scheme == "file" {
+		if req.method() != http.MethodGet {
+			return "", fmt.Errorf("reading %s: file feeds only support GET", req.URL)
+		}
+		return readFile(u, req.MaxBytes)
+	}
+
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := req.client().Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: unexpected status %s", req.URL, resp.Status)
+	}
+
+	if req.MaxBytes > 0 && resp.ContentLength > req.MaxBytes {
+		return "", fmt.Errorf("fetching %s: %w", req.URL, ErrTooLarge)
+	}
+	body, err := readLimited(resp.Body, req.MaxBytes)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", req.URL, err)
+	}
+
+	return string(body), nil
+}
+
+// readLimited reads r to the end, stopping as soon as it holds more than
+// maxBytes so an oversized feed is never buffered whole.
+//
+// Parameters:
+// - r: The reader to drain.
+// - maxBytes: The largest size accepted; 0 or less is unlimited.
+//
+// Returns:
+// - The data read.
+// - ErrTooLarge if r holds more than maxBytes, or the read error.
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	return data, nil
 }
 
-func main() {
-	r := gin.Default()
-	r.GET("/aggregate_ics", aggregateICS)
-	r.Run(":8080")
+// SplitEvents splits calendar data into its raw VEVENT blocks.
+//
+// Parameters:
+// - calendarData: A string containing the calendar data.
+//
+// Returns:
+// - One CRLF-terminated block per event, including its BEGIN and END lines.
+func SplitEvents(calendarData string) []string {
+	var events []string
+	var event strings.Builder
+	inEvent := false
+	scanner := bufio.NewScanner(strings.NewReader(calendarData))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "BEGIN:VEVENT" {
+			inEvent = true
+			event.Reset()
+		}
+		if !inEvent {
+			continue
+		}
+		event.WriteString(line)
+		event.WriteString("\r\n")
+		if line == "END:VEVENT" {
+			inEvent = false
+			events = append(events, event.String())
+		}
+	}
+	return events
+}
+
+// FetchICS fetches the iCalendar feed described by req and sends each raw VEVENT
+// block, including its BEGIN and END lines, to eventChan.
+//
+// Parameters:
+// - ctx: The context governing the request's lifetime.
+// - req: The request describing where and how to fetch the calendar data.
+// - eventChan: The channel receiving one CRLF-terminated VEVENT block per event.
+//
+// Returns:
+// - An error if there was an issue fetching or reading the data.
+func FetchICS(ctx context.Context, req Request, eventChan chan<- string) error {
+	calendarData, err := Fetch(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range SplitEvents(calendarData) {
+		eventChan <- event
+	}
+	return nil
 }
 
 // End, fetcher.go
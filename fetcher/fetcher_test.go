@@ -0,0 +1,183 @@
+// fetcher_test.go
+// This file contains tests for the fetcher package.
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Mock data for testing
+const mockCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:New Year
+DTSTART;VALUE=DATE:20230101
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Labour Day
+DTSTART;VALUE=DATE:20230501
+END:VEVENT
+END:VCALENDAR`
+
+// collectEvents runs FetchICS for req and returns the events it sends.
+func collectEvents(t *testing.T, req Request) []string {
+	t.Helper()
+	eventChan := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- FetchICS(context.Background(), req, eventChan)
+		close(eventChan)
+	}()
+
+	var events []string
+	for event := range eventChan {
+		events = append(events, event)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Error fetching feed: %v", err)
+	}
+	return events
+}
+
+// TestFetchICSSplitsEvents tests that each VEVENT is sent as its own block.
+func TestFetchICSSplitsEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mockCalendar)
+	}))
+	defer srv.Close()
+
+	events := collectEvents(t, Request{URL: srv.URL})
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if !strings.HasPrefix(events[0], "BEGIN:VEVENT\r\n") || !strings.HasSuffix(events[0], "END:VEVENT\r\n") {
+		t.Errorf("Expected a complete VEVENT block, got %q", events[0])
+	}
+}
+
+// TestFetchICSPost tests fetching a feed that only answers POST with form parameters.
+func TestFetchICSPost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.PostFormValue("country") != "CO" {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		io.WriteString(w, mockCalendar)
+	}))
+	defer srv.Close()
+
+	events := collectEvents(t, Request{
+		URL:    srv.URL,
+		Method: "post",
+		Form:   map[string]string{"country": "CO"},
+	})
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if !strings.Contains(events[1], "SUMMARY:Labour Day") {
+		t.Errorf("Expected second event to be 'Labour Day', got %q", events[1])
+	}
+}
+
+// TestFetchICSGetRejected tests that a POST-only provider's error is reported.
+func TestFetchICSGetRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+	}))
+	defer srv.Close()
+
+	eventChan := make(chan string, 1)
+	if err := FetchICS(context.Background(), Request{URL: srv.URL}, eventChan); err == nil {
+		t.Errorf("Expected an error for a non-200 response")
+	}
+}
+
+// TestFetchCheckURLRedirect tests that CheckURL vets redirect targets.
+func TestFetchCheckURLRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mockCalendar)
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	var checked []string
+	req := Request{URL: redirect.URL, CheckURL: func(u *url.URL) error {
+		checked = append(checked, u.String())
+		if u.Host != redirect.Listener.Addr().String() {
+			return fmt.Errorf("host %s is not allowed", u.Host)
+		}
+		return nil
+	}}
+	if _, err := Fetch(context.Background(), req); err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("Expected the redirect to be refused, got %v", err)
+	}
+	if len(checked) != 2 {
+		t.Errorf("Expected the URL and its redirect target to be checked, got %v", checked)
+	}
+}
+
+// writeGzipFile gzips data into a file named name in a temporary directory.
+func writeGzipFile(t *testing.T, name, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, data)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Error compressing fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Error writing fixture: %v", err)
+	}
+	return path
+}
+
+// TestFetchICSGzipFile tests that gzipped local feeds are decompressed, whether
+// named .gz or recognized by their magic bytes.
+func TestFetchICSGzipFile(t *testing.T) {
+	for _, name := range []string{"holidays.ics.gz", "holidays.ics"} {
+		path := writeGzipFile(t, name, mockCalendar)
+		events := collectEvents(t, Request{URL: "file://" + path})
+		if len(events) != 2 || !strings.Contains(events[0], "SUMMARY:New Year") || !strings.Contains(events[1], "SUMMARY:Labour Day") {
+			t.Errorf("%s: expected the New Year and Labour Day events, got %q", name, events)
+		}
+	}
+}
+
+// TestNormalizeDates tests rewriting non-standard dates into RFC 5545 form.
+func TestNormalizeDates(t *testing.T) {
+	tests := []struct {
+		layout string
+		line   string
+		want   string
+	}{
+		{layout: "2006/01/02", line: "DTSTART:2023/01/01", want: "DTSTART;VALUE=DATE:20230101"},
+		{layout: "2006/01/02", line: "DTEND;VALUE=DATE-TIME:2023/01/02", want: "DTEND;VALUE=DATE:20230102"},
+		{layout: "2006/01/02 15:04", line: "DTSTART;TZID=America/Bogota:2023/01/01 09:30", want: "DTSTART;TZID=America/Bogota:20230101T093000"},
+		{layout: "2006-01-02T15:04:05-07:00", line: "DTSTART:2023-01-01T09:30:00-05:00", want: "DTSTART:20230101T143000Z"},
+		{layout: "2006/01/02", line: "DTSTART;VALUE=DATE:20230101", want: "DTSTART;VALUE=DATE:20230101"},
+		{layout: "2006/01/02", line: "SUMMARY:2023/01/01", want: "SUMMARY:2023/01/01"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeDates(tt.line+"\r\n", tt.layout); got != tt.want+"\r\n" {
+			t.Errorf("NormalizeDates(%q, %q) = %q, want %q", tt.line, tt.layout, got, tt.want+"\r\n")
+		}
+	}
+}
+
+// End, fetcher_test.go
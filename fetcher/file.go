@@ -0,0 +1,69 @@
+// file.go
+
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gzipMagic opens every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// filePath returns the local path named by a file URL, accepting both
+// file:///absolute/path and file:relative/path.
+//
+// Parameters:
+// - u: The file URL.
+//
+// Returns:
+// - The path.
+func filePath(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Path
+}
+
+// readFile reads a feed stored in a local file, decompressing files that end
+// in .gz or start with the gzip magic bytes.
+//
+// Parameters:
+// - u: The file URL of the feed.
+// - maxBytes: The largest feed accepted, after decompression; 0 or less is unlimited.
+//
+// Returns:
+// - A string containing the calendar data.
+// - An error if the file could not be read or decompressed, or ErrTooLarge.
+func readFile(u *url.URL, maxBytes int64) (string, error) {
+	path := filePath(u)
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := readLimited(f, maxBytes)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", u, err)
+	}
+	if !strings.HasSuffix(path, ".gz") && !bytes.HasPrefix(data, gzipMagic) {
+		return string(data), nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	decompressed, err := readLimited(zr, maxBytes)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", u, err)
+	}
+	return string(decompressed), nil
+}
+
+// End, file.go